@@ -41,6 +41,8 @@ func main() {
 		log.Fatalf("server: %v", err)
 	}
 
+	go srv.LogHub.Run(context.Background())
+
 	httpSrv := &http.Server{
 		Addr:              cfg.HTTPAddr,
 		Handler:           srv.Router,
@@ -155,10 +155,14 @@ export default function DeploymentDetailPage() {
     if (!deploymentID) return;
     setLogs("");
     setLiveLogging(true);
-    const url = `${apiBase()}/api/deployments/${deploymentID}/logs`;
+    const url = `${apiBase()}/api/deployments/${deploymentID}/logs?stream=build`;
     const es = new EventSource(url, {
       withCredentials: true,
     } as EventSourceInit);
+    es.addEventListener("end", () => {
+      setLiveLogging(false);
+      es.close();
+    });
     es.addEventListener("log", (ev: MessageEvent) => {
       try {
         const data = JSON.parse(ev.data) as { chunk?: string };
@@ -191,7 +195,7 @@ export default function DeploymentDetailPage() {
         method: "POST",
         body: "{}",
       });
-      toast.success("Promoted to production");
+      toast.success("Promoting: production switches once the health check passes");
       // Refresh
       const [p, d] = await Promise.all([
         apiFetch(`/api/projects/${projectID}`) as Promise<Project>,
@@ -150,6 +150,7 @@ export default function ProjectPage() {
         // ignore
       }
     });
+    es.addEventListener("end", () => es.close());
     es.addEventListener("error", () => es.close());
     return () => es.close();
   }, [logsFor]);
@@ -160,7 +161,7 @@ export default function ProjectPage() {
         method: "POST",
         body: "{}",
       });
-      toast.success("Promoted to production");
+      toast.success("Promoting: production switches once the health check passes");
       await refresh();
     } catch (e: any) {
       toast.error(String(e?.message || e));
@@ -23,9 +23,19 @@ export default function LoginPage() {
   const [email, setEmail] = useState("");
   const [password, setPassword] = useState("");
   const [submitting, setSubmitting] = useState(false);
+  // Set once the password is accepted for an account with two-factor auth on.
+  // GitHub and SSO sign-ins land here with ?mfa=1 and the token in a cookie.
+  const [mfaStep, setMfaStep] = useState(false);
+  const [mfaToken, setMfaToken] = useState("");
+  const [code, setCode] = useState("");
+  const [returnTo, setReturnTo] = useState("/projects");
   const [gh, setGh] = useState<{ configured: boolean } | null>(null);
 
   useEffect(() => {
+    const params = new URLSearchParams(window.location.search);
+    const ret = params.get("return_to") || "";
+    if (ret.startsWith("/") && !ret.startsWith("//")) setReturnTo(ret);
+    if (params.get("mfa") === "1") setMfaStep(true);
     (async () => {
       try {
         const st = (await apiFetch("/api/setup/status")) as { needs_setup: boolean };
@@ -54,11 +64,30 @@ export default function LoginPage() {
   async function onSubmit() {
     setSubmitting(true);
     try {
-      await apiFetch("/api/auth/login", { method: "POST", body: JSON.stringify({ email, password }) });
+      if (mfaStep) {
+        await apiFetch("/api/auth/login/2fa", { method: "POST", body: JSON.stringify({ mfa_token: mfaToken, code }) });
+      } else {
+        const res = (await apiFetch("/api/auth/login", { method: "POST", body: JSON.stringify({ email, password }) })) as {
+          mfa_required?: boolean;
+          mfa_token?: string;
+        };
+        if (res.mfa_required && res.mfa_token) {
+          setMfaToken(res.mfa_token);
+          setMfaStep(true);
+          return;
+        }
+      }
       toast.success("Logged in");
-      router.replace("/projects");
+      router.replace(returnTo);
     } catch (e: any) {
-      toast.error(String(e?.message || e));
+      const msg = String(e?.message || e);
+      if (mfaStep && msg.includes("login expired")) {
+        // The MFA token lasts a few minutes; start over with the password.
+        setMfaStep(false);
+        setMfaToken("");
+        setCode("");
+      }
+      toast.error(msg);
     } finally {
       setSubmitting(false);
     }
@@ -77,7 +106,7 @@ export default function LoginPage() {
 
         <div className="space-y-4">
           {/* GitHub OAuth */}
-          {gh?.configured && (
+          {!mfaStep && gh?.configured && (
             <>
               <Button asChild variant="outline" className="h-11 w-full gap-2 border-[#333] bg-transparent text-[#ededed] hover:bg-[#111] hover:text-white">
                 <a href="/api/auth/github/start?return_to=/projects">
@@ -97,29 +126,45 @@ export default function LoginPage() {
             </>
           )}
 
-          {/* Email / Password */}
-          <div className="space-y-2">
-            <label className="text-sm text-[#888]">Email Address</label>
-            <Input
-              value={email}
-              onChange={(e) => setEmail(e.target.value)}
-              autoComplete="email"
-              placeholder="you@example.com"
-              className="h-11 border-[#333] bg-black text-white placeholder:text-[#555] focus-visible:ring-white"
-            />
-          </div>
+          {mfaStep ? (
+            <div className="space-y-2">
+              <label className="text-sm text-[#888]">Authentication Code</label>
+              <Input
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                autoComplete="one-time-code"
+                autoFocus
+                placeholder="6-digit code or recovery code"
+                className="h-11 border-[#333] bg-black text-white placeholder:text-[#555] focus-visible:ring-white"
+              />
+            </div>
+          ) : (
+            <>
+              {/* Email / Password */}
+              <div className="space-y-2">
+                <label className="text-sm text-[#888]">Email Address</label>
+                <Input
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                  autoComplete="email"
+                  placeholder="you@example.com"
+                  className="h-11 border-[#333] bg-black text-white placeholder:text-[#555] focus-visible:ring-white"
+                />
+              </div>
 
-          <div className="space-y-2">
-            <label className="text-sm text-[#888]">Password</label>
-            <Input
-              type="password"
-              value={password}
-              onChange={(e) => setPassword(e.target.value)}
-              autoComplete="current-password"
-              placeholder="Enter password"
-              className="h-11 border-[#333] bg-black text-white placeholder:text-[#555] focus-visible:ring-white"
-            />
-          </div>
+              <div className="space-y-2">
+                <label className="text-sm text-[#888]">Password</label>
+                <Input
+                  type="password"
+                  value={password}
+                  onChange={(e) => setPassword(e.target.value)}
+                  autoComplete="current-password"
+                  placeholder="Enter password"
+                  className="h-11 border-[#333] bg-black text-white placeholder:text-[#555] focus-visible:ring-white"
+                />
+              </div>
+            </>
+          )}
 
           <Button
             className="h-11 w-full gap-2 font-medium"
@@ -46,15 +46,69 @@ func main() {
 		}
 		return w.BuildAndDeploy(ctx, p.DeploymentID)
 	})
+	mux.HandleFunc(queue.TaskTeardownPreview, func(ctx context.Context, t *asynq.Task) error {
+		var p queue.TeardownPreviewPayload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return err
+		}
+		return w.TeardownPullRequest(ctx, p.ProjectID, p.PRNumber)
+	})
+	mux.HandleFunc(queue.TaskRollback, func(ctx context.Context, t *asynq.Task) error {
+		var p queue.RollbackPayload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return err
+		}
+		return w.Rollback(db.WithActor(ctx, p.ActorUserID), p.DeploymentID)
+	})
+	mux.HandleFunc(queue.TaskPromote, func(ctx context.Context, t *asynq.Task) error {
+		var p queue.PromotePayload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return err
+		}
+		return w.Promote(db.WithActor(ctx, p.ActorUserID), p.DeploymentID)
+	})
+	mux.HandleFunc(queue.TaskRedeploy, func(ctx context.Context, t *asynq.Task) error {
+		var p queue.RedeployPayload
+		if err := json.Unmarshal(t.Payload(), &p); err != nil {
+			return err
+		}
+		return w.Redeploy(db.WithActor(ctx, p.ActorUserID), p.DeploymentID, p.SourceDeploymentID)
+	})
+	mux.HandleFunc(queue.TaskCollectGarbage, func(ctx context.Context, t *asynq.Task) error {
+		return w.CollectGarbage(ctx)
+	})
 
-	go func() {
-		for {
-			time.Sleep(30 * time.Second)
+	if cfg.GCSchedule != "" {
+		sched := asynq.NewScheduler(asynq.RedisClientOpt{Addr: cfg.RedisAddr}, nil)
+		// Unique keeps several worker replicas from stacking up GC runs.
+		if _, err := sched.Register(cfg.GCSchedule, asynq.NewTask(queue.TaskCollectGarbage, nil), asynq.Unique(10*time.Minute), asynq.MaxRetry(0)); err != nil {
+			log.Fatalf("gc schedule %q: %v", cfg.GCSchedule, err)
 		}
-	}()
+		go func() {
+			if err := sched.Run(); err != nil {
+				log.Printf("scheduler: %v", err)
+			}
+		}()
+	}
+
+	// Canceled once the server has shut down, so the collector flushes what
+	// its followers still buffer before the process exits.
+	logsCtx, stopLogs := context.WithCancel(context.Background())
+	logsDone := make(chan struct{})
+	if cfg.RuntimeLogs {
+		go func() {
+			defer close(logsDone)
+			w.CollectRuntimeLogs(logsCtx)
+		}()
+	} else {
+		close(logsDone)
+	}
 
 	log.Printf("worker started")
-	if err := srv.Run(mux); err != nil {
+	err = srv.Run(mux)
+	stopLogs()
+	<-logsDone
+	if err != nil {
 		log.Fatalf("asynq: %v", err)
 	}
 }
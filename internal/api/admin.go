@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/hibiken/asynq"
@@ -32,6 +33,10 @@ func (s *Server) requireInstanceAdminMiddleware(next http.Handler) http.Handler
 			writeJSON(w, 403, map[string]any{"error": "forbidden"})
 			return
 		}
+		if t := apiTokenFromCtx(r.Context()); t != nil && !hasScope(t.Scopes, scopeAdmin) {
+			writeJSON(w, 403, map[string]any{"error": "token lacks the admin scope"})
+			return
+		}
 		ctx := context.WithValue(r.Context(), ctxIsInstanceAdmin, true)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -55,6 +60,9 @@ type adminSettingsResp struct {
 
 	AutoUpdatesEnabled  bool   `json:"auto_updates_enabled"`
 	AutoUpdatesInterval string `json:"auto_updates_interval"` // hourly | daily (UI only in M3)
+
+	OIDC                       *integrations.OIDCSettings `json:"oidc,omitempty"`
+	OIDCClientSecretConfigured bool                       `json:"oidc_client_secret_configured"`
 }
 
 func (s *Server) handleAdminGetSettings(w http.ResponseWriter, r *http.Request) {
@@ -101,6 +109,16 @@ func (s *Server) handleAdminGetSettings(w http.ResponseWriter, r *http.Request)
 		resp.GitHubAppPrivateKeyConfigured = keyOK
 	}
 
+	// OIDC single sign-on.
+	{
+		var v integrations.OIDCSettings
+		if ok, _ := s.Settings.GetJSON(ctx, integrations.KeyOIDC, &v); ok {
+			resp.OIDC = &v
+		}
+		secOK, _ := s.Settings.HasSecret(ctx, integrations.KeyOIDCClientSecret)
+		resp.OIDCClientSecretConfigured = secOK
+	}
+
 	writeJSON(w, 200, resp)
 }
 
@@ -118,6 +136,9 @@ type adminSettingsPutReq struct {
 
 	AutoUpdatesEnabled  *bool   `json:"auto_updates_enabled,omitempty"`
 	AutoUpdatesInterval *string `json:"auto_updates_interval,omitempty"` // hourly | daily
+
+	OIDC             *integrations.OIDCSettings `json:"oidc,omitempty"`
+	OIDCClientSecret *string                    `json:"oidc_client_secret,omitempty"` // write-only
 }
 
 func (s *Server) handleAdminPutSettings(w http.ResponseWriter, r *http.Request) {
@@ -128,6 +149,19 @@ func (s *Server) handleAdminPutSettings(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if req.OIDC != nil {
+		if msg := validateOIDCSettings(req.OIDC); msg != "" {
+			writeJSON(w, 400, map[string]any{"error": msg})
+			return
+		}
+		for _, m := range req.OIDC.RoleMappings {
+			if o, err := s.Store.GetOrganization(ctx, m.OrgID); err != nil || o == nil {
+				writeJSON(w, 400, map[string]any{"error": "role mapping names unknown org " + m.OrgID})
+				return
+			}
+		}
+	}
+
 	// Store settings (DB) first. Agent apply will later write to compose/env when needed.
 	if req.GitHubOAuthClientID != nil {
 		_ = s.Settings.SetJSON(ctx, integrations.KeyGitHubOAuthClientID, map[string]any{"client_id": strings.TrimSpace(*req.GitHubOAuthClientID)})
@@ -167,10 +201,48 @@ func (s *Server) handleAdminPutSettings(w http.ResponseWriter, r *http.Request)
 		_ = s.Settings.SetJSON(ctx, integrations.KeyAutoUpdates, m)
 	}
 
+	if req.OIDC != nil {
+		_ = s.Settings.SetJSON(ctx, integrations.KeyOIDC, req.OIDC)
+	}
+	if req.OIDCClientSecret != nil {
+		_ = s.Settings.SetSecret(ctx, integrations.KeyOIDCClientSecret, []byte(strings.TrimSpace(*req.OIDCClientSecret)))
+	}
+
 	s.GHProvider.Invalidate()
+	s.OIDC.Invalidate()
 	writeJSON(w, 200, map[string]any{"ok": true})
 }
 
+// validateOIDCSettings normalizes v and returns a message for the first problem.
+func validateOIDCSettings(v *integrations.OIDCSettings) string {
+	v.Issuer = strings.TrimRight(strings.TrimSpace(v.Issuer), "/")
+	v.ClientID = strings.TrimSpace(v.ClientID)
+	v.DisplayName = strings.TrimSpace(v.DisplayName)
+	v.GroupsClaim = strings.TrimSpace(v.GroupsClaim)
+	if v.Enabled && (v.Issuer == "" || v.ClientID == "") {
+		return "oidc issuer and client_id are required"
+	}
+	if v.Issuer != "" {
+		u, err := url.Parse(v.Issuer)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return "oidc issuer must be an http(s) URL"
+		}
+	}
+	for i := range v.RoleMappings {
+		m := &v.RoleMappings[i]
+		m.Group = strings.TrimSpace(m.Group)
+		m.OrgID = strings.TrimSpace(m.OrgID)
+		m.Role = strings.ToLower(strings.TrimSpace(m.Role))
+		if m.Group == "" || m.OrgID == "" {
+			return "role mappings need a group and an org_id"
+		}
+		if roleRank(m.Role) == 0 {
+			return "role mapping role must be member, admin or owner"
+		}
+	}
+	return ""
+}
+
 func (s *Server) handleAdminApply(w http.ResponseWriter, r *http.Request) {
 	uid := userIDFromCtx(r.Context())
 	j, err := s.Store.CreateAdminJob(r.Context(), "apply_settings", &uid)
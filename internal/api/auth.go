@@ -3,12 +3,9 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"strings"
-	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/opencel/opencel/internal/db"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -55,34 +52,47 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
 	}
+	// Checked before bcrypt, so a locked account costs no hashing.
+	key := loginLockoutKey(req.Email)
+	if s.accountLocked(w, r, key) {
+		return
+	}
 	u, err := s.Store.GetUserByEmail(r.Context(), req.Email)
+	if err == nil && u != nil {
+		err = bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password))
+	}
 	if err != nil || u == nil {
-		writeJSON(w, 401, map[string]any{"error": "invalid credentials"})
+		// Unknown emails count too, so lockouts do not reveal which exist.
+		if !s.authFailed(w, r, key, "password", strings.TrimSpace(req.Email)) {
+			writeJSON(w, 401, map[string]any{"error": "invalid credentials"})
+		}
 		return
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)); err != nil {
-		writeJSON(w, 401, map[string]any{"error": "invalid credentials"})
+	s.authSucceeded(r, key)
+	t, err := s.enabledTOTP(r.Context(), u.ID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
 		return
 	}
-	tok, err := s.signJWT(u.ID)
-	if err != nil {
+	if t != nil {
+		// The client finishes with POST /api/auth/login/2fa.
+		tok, err := s.signMFAToken(u.ID)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": "token error"})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"mfa_required": true, "mfa_token": tok})
+		return
+	}
+	if err := s.startSession(w, r, u.ID); err != nil {
 		writeJSON(w, 500, map[string]any{"error": "token error"})
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     authCookieName,
-		Value:    tok,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		// Secure should be true for HTTPS, including behind a reverse proxy.
-		Secure:  isHTTPS(r),
-		Expires: time.Now().Add(7 * 24 * time.Hour),
-	})
 	writeJSON(w, 200, map[string]any{"ok": true})
 }
 
 func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.revokeCookieSession(r)
 	http.SetCookie(w, &http.Cookie{
 		Name:     authCookieName,
 		Value:    "",
@@ -123,19 +133,59 @@ func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, 200, meResp{ID: u.ID, Email: u.Email, IsInstanceAdmin: u.IsInstanceAdmin})
 }
 
+// authMiddleware accepts an API token as "Authorization: Bearer ocl_..." or
+// else the session cookie.
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerAPIToken(r); ok {
+			t, herr := s.authenticateAPIToken(r.Context(), token)
+			if herr != nil {
+				writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+				return
+			}
+			if need := scopeForMethod(r.Method); !hasScope(t.Scopes, need) {
+				writeJSON(w, 403, map[string]any{"error": "token lacks the " + need + " scope"})
+				return
+			}
+			ctx := context.WithValue(r.Context(), ctxAPIToken, t)
+			ctx = db.WithActor(context.WithValue(ctx, ctxUserID, t.UserID), t.UserID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 		c, err := r.Cookie(authCookieName)
 		if err != nil || c.Value == "" {
 			writeJSON(w, 401, map[string]any{"error": "unauthorized"})
 			return
 		}
-		uid, err := s.verifyJWT(c.Value)
+		st, err := s.verifySession(r.Context(), c.Value)
 		if err != nil {
 			writeJSON(w, 401, map[string]any{"error": "unauthorized"})
 			return
 		}
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxUserID, uid)))
+		if st.Stale {
+			if st.SessionID == "" {
+				// A cookie from before sessions: give it a session with the
+				// same expiry, so it can be listed and signed out.
+				ss, err := s.Store.CreateSession(r.Context(), st.UserID, r.UserAgent(), clientIP(r), st.Expires)
+				if err != nil {
+					// E.g. the user has since been deleted.
+					writeJSON(w, 401, map[string]any{"error": "unauthorized"})
+					return
+				}
+				st.SessionID = ss.ID
+			}
+			// Move the session to the current secret, so the old one can be
+			// dropped once sessions have cycled.
+			if err := s.setSessionCookie(w, r, st.UserID, st.SessionID, st.Expires); err != nil {
+				writeJSON(w, 500, map[string]any{"error": err.Error()})
+				return
+			}
+		}
+		uid := st.UserID
+		// Deployment events recorded while serving the request name the user.
+		ctx := db.WithActor(context.WithValue(r.Context(), ctxUserID, uid), uid)
+		ctx = context.WithValue(ctx, ctxSessionID, st.SessionID)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -143,34 +193,3 @@ func userIDFromCtx(ctx context.Context) string {
 	v, _ := ctx.Value(ctxUserID).(string)
 	return v
 }
-
-func (s *Server) signJWT(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"sub": userID,
-		"exp": time.Now().Add(7 * 24 * time.Hour).Unix(),
-		"iat": time.Now().Unix(),
-	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString([]byte(s.Cfg.JWTSecret))
-}
-
-func (s *Server) verifyJWT(tokenStr string) (string, error) {
-	tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(s.Cfg.JWTSecret), nil
-	})
-	if err != nil || tok == nil || !tok.Valid {
-		return "", errors.New("invalid token")
-	}
-	claims, ok := tok.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", errors.New("invalid claims")
-	}
-	sub, _ := claims["sub"].(string)
-	if sub == "" {
-		return "", errors.New("missing sub")
-	}
-	return sub, nil
-}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/hibiken/asynq"
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/queue"
+	"github.com/opencel/opencel/internal/settings"
+)
+
+// buildQueue is the asynq queue build tasks are enqueued on (the client default).
+const buildQueue = "default"
+
+// errBuildQueued is returned by enqueueBuild when the deployment's build task
+// is still queued or running.
+var errBuildQueued = errors.New("build is already queued")
+
+// enqueueBuild queues the build task under the deployment's ID, so the task can
+// later be found again to cancel it. A task that used up its retries keeps the
+// ID in the archive; it is replaced.
+func (s *Server) enqueueBuild(deploymentID string) error {
+	task := asynq.NewTask(queue.TaskBuildDeploy, queue.MustJSON(queue.BuildDeployPayload{DeploymentID: deploymentID}), asynq.TaskID(deploymentID))
+	_, err := s.Queue.Enqueue(task)
+	if !errors.Is(err, asynq.ErrTaskIDConflict) {
+		return err
+	}
+	info, err := s.Inspector.GetTaskInfo(buildQueue, deploymentID)
+	if err != nil {
+		return err
+	}
+	if info.State != asynq.TaskStateArchived && info.State != asynq.TaskStateCompleted {
+		return errBuildQueued
+	}
+	if err := s.Inspector.DeleteTask(buildQueue, deploymentID); err != nil && !errors.Is(err, asynq.ErrTaskNotFound) {
+		return err
+	}
+	_, err = s.Queue.Enqueue(task)
+	return err
+}
+
+func (s *Server) handleCancelDeployment(w http.ResponseWriter, r *http.Request) {
+	d, _ := s.deploymentWithRole(w, r, "admin")
+	if d == nil {
+		return
+	}
+	if d.Status != "QUEUED" && d.Status != "BUILDING" {
+		writeJSON(w, 409, map[string]any{"error": fmt.Sprintf("deployment is %s, not in progress", d.Status)})
+		return
+	}
+	status, err := s.cancelDeployment(r.Context(), d, "Canceled by user")
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 202, map[string]any{"ok": true, "status": status})
+}
+
+// cancelDeployment stops d's build. A task that has not started yet is deleted
+// and the deployment is marked CANCELED right away; a running one has its
+// context canceled and the worker marks it once the build has stopped. It
+// returns the deployment status the caller can expect.
+func (s *Server) cancelDeployment(ctx context.Context, d *db.Deployment, reason string) (string, error) {
+	info, err := s.Inspector.GetTaskInfo(buildQueue, d.ID)
+	switch {
+	case errors.Is(err, asynq.ErrTaskNotFound), errors.Is(err, asynq.ErrQueueNotFound):
+		// Nothing left in the queue (e.g. the worker died mid-build); just close it out.
+	case err != nil:
+		return "", err
+	case info.State == asynq.TaskStateActive:
+		if err := s.Inspector.CancelProcessing(d.ID); err != nil {
+			return "", err
+		}
+		_ = s.Store.AddDeploymentEvent(ctx, d.ID, "CANCEL_REQUESTED", reason)
+		return d.Status, nil
+	default:
+		if err := s.Inspector.DeleteTask(buildQueue, d.ID); err != nil && !errors.Is(err, asynq.ErrTaskNotFound) {
+			return "", err
+		}
+	}
+	if err := s.Store.UpdateDeployment(ctx, d.ID, "CANCELED", nil, nil, nil, nil); err != nil {
+		return "", err
+	}
+	_ = s.Store.AddDeploymentStatusEvent(ctx, d.ID, "CANCELED", reason, nil)
+	return "CANCELED", nil
+}
+
+// cancelSupersededBuilds cancels the in-flight builds of dep's git ref when the
+// project has cancel_superseded_builds on. Failures are logged, not returned:
+// the new build is already queued either way.
+func (s *Server) cancelSupersededBuilds(ctx context.Context, dep *db.Deployment) {
+	ps, err := settings.LoadProject(ctx, s.Store, dep.ProjectID)
+	if err != nil || !ps.CancelSupersededBuilds {
+		return
+	}
+	ds, err := s.Store.ListInFlightDeployments(ctx, dep.ProjectID, dep.GitRef)
+	if err != nil {
+		log.Printf("cancel superseded builds: %v", err)
+		return
+	}
+	for i := range ds {
+		if ds[i].ID == dep.ID || ds[i].CreatedAt.After(dep.CreatedAt) {
+			continue
+		}
+		if _, err := s.cancelDeployment(ctx, &ds[i], fmt.Sprintf("Superseded by deployment %s", dep.ID)); err != nil {
+			log.Printf("cancel superseded build %s: %v", ds[i].ID, err)
+		}
+	}
+}
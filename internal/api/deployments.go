@@ -2,10 +2,11 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 
 	"github.com/hibiken/asynq"
+	"github.com/opencel/opencel/internal/deploy"
 	"github.com/opencel/opencel/internal/queue"
 )
 
@@ -71,45 +72,23 @@ type promoteReq struct {
 }
 
 func (s *Server) handlePromoteDeployment(w http.ResponseWriter, r *http.Request) {
-	uid := userIDFromCtx(r.Context())
-	id := chiURLParam(r, "id")
-	d, err := s.Store.GetDeployment(r.Context(), id)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": err.Error()})
-		return
-	}
+	d, _ := s.deploymentWithRole(w, r, "admin")
 	if d == nil {
-		writeJSON(w, 404, map[string]any{"error": "not found"})
-		return
-	}
-	p, err := s.Store.GetProject(r.Context(), d.ProjectID)
-	if err != nil {
-		writeJSON(w, 500, map[string]any{"error": err.Error()})
-		return
-	}
-	if p == nil {
-		writeJSON(w, 404, map[string]any{"error": "not found"})
 		return
 	}
-	if herr := s.requireOrgRole(r.Context(), uid, p.OrgID, "admin"); herr != nil {
-		writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+	if err := deploy.CheckRunning(d); err != nil {
+		writeJSON(w, 409, map[string]any{"error": err.Error()})
 		return
 	}
 
-	// Update project pointer.
-	if err := s.Store.SetProjectProductionDeployment(r.Context(), d.ProjectID, d.ID); err != nil {
+	// The worker health-checks the container first, which may take up to the
+	// project's health check timeout; production only moves once it passes.
+	task := asynq.NewTask(queue.TaskPromote, queue.MustJSON(queue.PromotePayload{DeploymentID: d.ID, ActorUserID: userIDFromCtx(r.Context())}), asynq.MaxRetry(0))
+	if _, err := s.Queue.Enqueue(task); err != nil {
 		writeJSON(w, 500, map[string]any{"error": err.Error()})
 		return
 	}
-
-	// Update traefik dynamic config for prod routing.
-	if err := s.writeTraefikProdRoute(r.Context(), d.ProjectID); err != nil {
-		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("traefik config update failed: %v", err)})
-		return
-	}
-
-	_ = s.Store.AddDeploymentEvent(r.Context(), d.ID, "PROMOTED", "Deployment promoted to production")
-	writeJSON(w, 200, map[string]any{"ok": true})
+	writeJSON(w, 202, map[string]any{"ok": true, "deployment_id": d.ID})
 }
 
 // Optional endpoint to manually enqueue a build (useful for dev).
@@ -121,8 +100,10 @@ func (s *Server) handleEnqueueBuild(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 400, map[string]any{"error": "invalid json"})
 		return
 	}
-	t := asynq.NewTask(queue.TaskBuildDeploy, queue.MustJSON(queue.BuildDeployPayload{DeploymentID: body.DeploymentID}))
-	if _, err := s.Queue.Enqueue(t); err != nil {
+	if err := s.enqueueBuild(body.DeploymentID); errors.Is(err, errBuildQueued) {
+		writeJSON(w, 409, map[string]any{"error": err.Error()})
+		return
+	} else if err != nil {
 		writeJSON(w, 500, map[string]any{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/traefik"
+)
+
+// DNS lookups are package vars so verification can be exercised without real DNS.
+var (
+	lookupTXT   = net.DefaultResolver.LookupTXT
+	lookupCNAME = net.DefaultResolver.LookupCNAME
+)
+
+const domainChallengePrefix = "_opencel-challenge."
+
+var domainRe = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+type domainReq struct {
+	Domain string  `json:"domain"`
+	Target string  `json:"target,omitempty"` // production (default) | branch
+	Branch *string `json:"branch,omitempty"`
+}
+
+type domainVerificationResp struct {
+	TXTName     string `json:"txt_name"`
+	TXTValue    string `json:"txt_value"`
+	CNAMETarget string `json:"cname_target"`
+}
+
+type domainResp struct {
+	ID            string                 `json:"id"`
+	Domain        string                 `json:"domain"`
+	Target        string                 `json:"target"`
+	Branch        *string                `json:"branch,omitempty"`
+	Verified      bool                   `json:"verified"`
+	VerifiedAt    *time.Time             `json:"verified_at,omitempty"`
+	LastCheckedAt *time.Time             `json:"last_checked_at,omitempty"`
+	LastError     *string                `json:"last_error,omitempty"`
+	Verification  domainVerificationResp `json:"verification"`
+	CreatedAt     time.Time              `json:"created_at"`
+}
+
+func (s *Server) toDomainResp(ctx context.Context, p *db.Project, d *db.ProjectDomain) domainResp {
+	out := domainResp{
+		ID:       d.ID,
+		Domain:   d.Domain,
+		Target:   d.Target,
+		Verified: d.VerifiedAt.Valid,
+		Verification: domainVerificationResp{
+			TXTName:     domainChallengePrefix + d.Domain,
+			TXTValue:    domainTXTValue(d),
+			CNAMETarget: s.domainCNAMETarget(ctx, p),
+		},
+		CreatedAt: d.CreatedAt,
+	}
+	if d.Branch.Valid {
+		v := d.Branch.String
+		out.Branch = &v
+	}
+	if d.VerifiedAt.Valid {
+		v := d.VerifiedAt.Time
+		out.VerifiedAt = &v
+	}
+	if d.LastCheckedAt.Valid {
+		v := d.LastCheckedAt.Time
+		out.LastCheckedAt = &v
+	}
+	if d.LastError.Valid {
+		v := d.LastError.String
+		out.LastError = &v
+	}
+	return out
+}
+
+func domainTXTValue(d *db.ProjectDomain) string {
+	return "opencel-verify=" + d.VerificationToken
+}
+
+// domainCNAMETarget is the built-in production host a custom domain can CNAME to.
+func (s *Server) domainCNAMETarget(ctx context.Context, p *db.Project) string {
+	org, err := s.Store.GetOrganization(ctx, p.OrgID)
+	if err != nil || org == nil {
+		return ""
+	}
+	return traefik.ProductionHost(s.Cfg, p.Slug, org.Slug)
+}
+
+func normalizeDomain(v string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(v)), ".")
+}
+
+// validateDomainTarget checks target/branch and returns the branch to store.
+func validateDomainTarget(target string, branch *string) (string, *string, error) {
+	switch target {
+	case "", "production":
+		return "production", nil, nil
+	case "branch":
+		if branch == nil || strings.TrimSpace(*branch) == "" {
+			return "", nil, fmt.Errorf("branch is required when target is branch")
+		}
+		b := strings.TrimSpace(*branch)
+		return "branch", &b, nil
+	default:
+		return "", nil, fmt.Errorf("target must be production or branch")
+	}
+}
+
+func (s *Server) handleListDomains(w http.ResponseWriter, r *http.Request) {
+	p := s.projectWithRole(w, r, "member")
+	if p == nil {
+		return
+	}
+	ds, err := s.Store.ListProjectDomains(r.Context(), p.ID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	out := make([]domainResp, 0, len(ds))
+	for i := range ds {
+		out = append(out, s.toDomainResp(r.Context(), p, &ds[i]))
+	}
+	writeJSON(w, 200, out)
+}
+
+func (s *Server) handleAddDomain(w http.ResponseWriter, r *http.Request) {
+	p := s.projectWithRole(w, r, "admin")
+	if p == nil {
+		return
+	}
+	var req domainReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	domain := normalizeDomain(req.Domain)
+	if len(domain) > 253 || !domainRe.MatchString(domain) {
+		writeJSON(w, 400, map[string]any{"error": "invalid domain"})
+		return
+	}
+	base := strings.ToLower(s.Cfg.BaseDomain)
+	if domain == base || strings.HasSuffix(domain, "."+base) {
+		writeJSON(w, 400, map[string]any{"error": "domains under the instance base domain are managed by OpenCel"})
+		return
+	}
+	target, branch, err := validateDomainTarget(strings.TrimSpace(req.Target), req.Branch)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	existing, err := s.Store.ListProjectDomains(r.Context(), p.ID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	for _, d := range existing {
+		if d.Domain == domain {
+			writeJSON(w, 409, map[string]any{"error": "domain already added"})
+			return
+		}
+	}
+	// Other projects may hold pending claims on the domain; only a verified
+	// one takes it.
+	if v, err := s.Store.GetVerifiedDomain(r.Context(), domain); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	} else if v != nil {
+		writeJSON(w, 409, map[string]any{"error": "domain is already in use"})
+		return
+	}
+
+	d, err := s.Store.CreateProjectDomain(r.Context(), p.ID, domain, target, branch, randB64URL(24))
+	if db.IsUniqueViolation(err) {
+		// Added concurrently to this project.
+		writeJSON(w, 409, map[string]any{"error": "domain already added"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 201, s.toDomainResp(r.Context(), p, d))
+}
+
+// domainForProject loads {domainID} and makes sure it belongs to p.
+func (s *Server) domainForProject(w http.ResponseWriter, r *http.Request, p *db.Project) *db.ProjectDomain {
+	d, err := s.Store.GetProjectDomain(r.Context(), chiURLParam(r, "domainID"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return nil
+	}
+	if d == nil || d.ProjectID != p.ID {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return nil
+	}
+	return d
+}
+
+func (s *Server) handleUpdateDomain(w http.ResponseWriter, r *http.Request) {
+	p := s.projectWithRole(w, r, "admin")
+	if p == nil {
+		return
+	}
+	d := s.domainForProject(w, r, p)
+	if d == nil {
+		return
+	}
+	var req domainReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	target, branch, err := validateDomainTarget(strings.TrimSpace(req.Target), req.Branch)
+	if err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := s.Store.UpdateProjectDomainTarget(r.Context(), d.ID, target, branch); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if d.VerifiedAt.Valid {
+		if err := s.writeTraefikProdRoute(r.Context(), p.ID); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("traefik config update failed: %v", err)})
+			return
+		}
+	}
+	d, err = s.Store.GetProjectDomain(r.Context(), d.ID)
+	if err != nil || d == nil {
+		writeJSON(w, 500, map[string]any{"error": "reload failed"})
+		return
+	}
+	writeJSON(w, 200, s.toDomainResp(r.Context(), p, d))
+}
+
+func (s *Server) handleVerifyDomain(w http.ResponseWriter, r *http.Request) {
+	p := s.projectWithRole(w, r, "admin")
+	if p == nil {
+		return
+	}
+	d := s.domainForProject(w, r, p)
+	if d == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	checkErr := s.checkDomainDNS(ctx, p, d)
+	var errMsg *string
+	if checkErr != nil {
+		errMsg = ptrString(checkErr.Error())
+	}
+	if err := s.Store.RecordProjectDomainCheck(r.Context(), d.ID, checkErr == nil, errMsg); db.IsUniqueViolation(err) {
+		writeJSON(w, 409, map[string]any{"error": "domain is already verified by another project"})
+		return
+	} else if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if checkErr == nil {
+		if err := s.writeTraefikProdRoute(r.Context(), p.ID); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("traefik config update failed: %v", err)})
+			return
+		}
+	}
+	d, err := s.Store.GetProjectDomain(r.Context(), d.ID)
+	if err != nil || d == nil {
+		writeJSON(w, 500, map[string]any{"error": "reload failed"})
+		return
+	}
+	writeJSON(w, 200, s.toDomainResp(r.Context(), p, d))
+}
+
+// checkDomainDNS accepts either the TXT challenge record or a CNAME pointing
+// at the project's production host. Apex domains can only use the TXT record.
+func (s *Server) checkDomainDNS(ctx context.Context, p *db.Project, d *db.ProjectDomain) error {
+	want := domainTXTValue(d)
+	if txts, err := lookupTXT(ctx, domainChallengePrefix+d.Domain); err == nil {
+		for _, t := range txts {
+			if strings.TrimSpace(t) == want {
+				return nil
+			}
+		}
+	}
+	target := s.domainCNAMETarget(ctx, p)
+	cname, err := lookupCNAME(ctx, d.Domain)
+	if err == nil && target != "" && strings.EqualFold(strings.TrimSuffix(cname, "."), target) {
+		return nil
+	}
+	return fmt.Errorf("no TXT record %q at %s and no CNAME to %s", want, domainChallengePrefix+d.Domain, target)
+}
+
+func (s *Server) handleDeleteDomain(w http.ResponseWriter, r *http.Request) {
+	p := s.projectWithRole(w, r, "admin")
+	if p == nil {
+		return
+	}
+	d := s.domainForProject(w, r, p)
+	if d == nil {
+		return
+	}
+	if err := s.Store.DeleteProjectDomain(r.Context(), d.ID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if d.VerifiedAt.Valid {
+		if err := s.writeTraefikProdRoute(r.Context(), p.ID); err != nil {
+			writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("traefik config update failed: %v", err)})
+			return
+		}
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyDomain(t *testing.T) {
+	s := newTestServer(t)
+	s.Cfg.TraefikDynamicPath = filepath.Join(t.TempDir(), "opencel.yml")
+	ctx := context.Background()
+	u, cookie := newTestUser(t, s, "")
+	org, err := s.Store.CreateOrganization(ctx, testName("org"), "Domains")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.AddOrgMember(ctx, org.ID, u.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.Store.CreateProject(ctx, org.ID, testName("proj"), testName("acme/repo"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	origTXT, origCNAME := lookupTXT, lookupCNAME
+	t.Cleanup(func() { lookupTXT, lookupCNAME = origTXT, origCNAME })
+
+	errNoSuchHost := errors.New("no such host")
+	for _, tc := range []struct {
+		name string
+		// txt and cname answer for the domain added; v is its verification
+		// instructions.
+		txt      func(v domainVerificationResp) ([]string, error)
+		cname    func(v domainVerificationResp) (string, error)
+		verified bool
+	}{
+		{
+			name: "txt match",
+			txt: func(v domainVerificationResp) ([]string, error) {
+				return []string{"unrelated", " " + v.TXTValue + " "}, nil
+			},
+			cname:    func(domainVerificationResp) (string, error) { return "", errNoSuchHost },
+			verified: true,
+		},
+		{
+			name:     "cname to production host",
+			txt:      func(domainVerificationResp) ([]string, error) { return nil, errNoSuchHost },
+			cname:    func(v domainVerificationResp) (string, error) { return v.CNAMETarget + ".", nil },
+			verified: true,
+		},
+		{
+			name:  "mismatch",
+			txt:   func(domainVerificationResp) ([]string, error) { return []string{"opencel-verify=someone-else"}, nil },
+			cname: func(domainVerificationResp) (string, error) { return "other-project.prod.opencel.test.", nil },
+		},
+		{
+			name:  "lookup error",
+			txt:   func(domainVerificationResp) ([]string, error) { return nil, errNoSuchHost },
+			cname: func(domainVerificationResp) (string, error) { return "", errNoSuchHost },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(s, "POST", "/api/projects/"+p.ID+"/domains", `{"domain":"`+testName("site")+`.example.com"}`, cookie)
+			if rec.Code != 201 {
+				t.Fatalf("add domain: %d %s", rec.Code, rec.Body)
+			}
+			var added domainResp
+			if err := json.Unmarshal(rec.Body.Bytes(), &added); err != nil {
+				t.Fatal(err)
+			}
+			var txtName, cnameName string
+			lookupTXT = func(_ context.Context, name string) ([]string, error) {
+				txtName = name
+				return tc.txt(added.Verification)
+			}
+			lookupCNAME = func(_ context.Context, name string) (string, error) {
+				cnameName = name
+				return tc.cname(added.Verification)
+			}
+
+			rec = serve(s, "POST", "/api/projects/"+p.ID+"/domains/"+added.ID+"/verify", "", cookie)
+			if rec.Code != 200 {
+				t.Fatalf("verify: %d %s", rec.Code, rec.Body)
+			}
+			var got domainResp
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if txtName != added.Verification.TXTName {
+				t.Errorf("TXT lookup of %q, want %q", txtName, added.Verification.TXTName)
+			}
+			if got.Verified != tc.verified {
+				t.Fatalf("verified = %v, want %v (last error %v)", got.Verified, tc.verified, got.LastError)
+			}
+			if tc.verified {
+				if got.LastError != nil {
+					t.Errorf("last_error = %q on a verified domain", *got.LastError)
+				}
+				return
+			}
+			if cnameName != added.Domain {
+				t.Errorf("CNAME lookup of %q, want %q", cnameName, added.Domain)
+			}
+			if got.LastError == nil || got.LastCheckedAt == nil {
+				t.Errorf("failed check not recorded: %+v", got)
+			}
+		})
+	}
+}
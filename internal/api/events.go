@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// handleListDeploymentEvents returns a deployment's timeline, oldest first.
+func (s *Server) handleListDeploymentEvents(w http.ResponseWriter, r *http.Request) {
+	d, _ := s.deploymentWithRole(w, r, "member")
+	if d == nil {
+		return
+	}
+	evs, err := s.Store.ListDeploymentEvents(r.Context(), d.ID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	out := make([]deploymentEventResp, 0, len(evs))
+	for i := range evs {
+		out = append(out, toDeploymentEventResp(&evs[i]))
+	}
+	writeJSON(w, 200, map[string]any{"deployment": toDeploymentResp(d), "events": out})
+}
+
+// handleProjectActivity is the project's activity feed: the events of all its
+// deployments, newest first. Pass the returned next_before as ?before= for the
+// next page.
+func (s *Server) handleProjectActivity(w http.ResponseWriter, r *http.Request) {
+	p := s.projectWithRole(w, r, "member")
+	if p == nil {
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			writeJSON(w, 400, map[string]any{"error": "limit must be between 1 and 200"})
+			return
+		}
+		limit = n
+	}
+	before, ok := beforeParam(w, r)
+	if !ok {
+		return
+	}
+	evs, err := s.Store.ListProjectEvents(r.Context(), p.ID, before, limit)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	out := make([]activityResp, 0, len(evs))
+	for i := range evs {
+		out = append(out, toActivityResp(&evs[i]))
+	}
+	resp := map[string]any{"events": out}
+	if len(evs) == limit {
+		resp["next_before"] = evs[len(evs)-1].ID
+	}
+	writeJSON(w, 200, resp)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProjectActivityPagination(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	u, cookie := newTestUser(t, s, "")
+	org, err := s.Store.CreateOrganization(ctx, testName("org"), "Activity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.AddOrgMember(ctx, org.ID, u.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.Store.CreateProject(ctx, org.ID, testName("proj"), testName("acme/repo"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.Store.CreateDeployment(ctx, p.ID, "abc123", "refs/heads/main", "production", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := s.Store.AddDeploymentEvent(ctx, d.ID, "LOG", fmt.Sprintf("event %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	seen := map[string]bool{}
+	path := "/api/projects/" + p.ID + "/activity?limit=2"
+	for page := 0; ; page++ {
+		if page > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		rec := serve(s, "GET", path, "", cookie)
+		if rec.Code != 200 {
+			t.Fatalf("page %d: got %d %s", page, rec.Code, rec.Body)
+		}
+		var resp struct {
+			Events []struct {
+				ID      string `json:"id"`
+				Message string `json:"message"`
+			} `json:"events"`
+			NextBefore string `json:"next_before"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range resp.Events {
+			if seen[e.ID] {
+				t.Fatalf("event %s returned twice", e.ID)
+			}
+			seen[e.ID] = true
+			got = append(got, e.Message)
+		}
+		if resp.NextBefore == "" {
+			break
+		}
+		path = "/api/projects/" + p.ID + "/activity?limit=2&before=" + resp.NextBefore
+	}
+	want := []string{"event 4", "event 3", "event 2", "event 1", "event 0"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestProjectActivityRejectsBadParams(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	u, cookie := newTestUser(t, s, "")
+	org, err := s.Store.CreateOrganization(ctx, testName("org"), "Activity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.AddOrgMember(ctx, org.ID, u.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.Store.CreateProject(ctx, org.ID, testName("proj"), testName("acme/repo"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{"before=not-an-id", "before=1%27%20OR%201=1", "limit=0", "limit=abc"} {
+		if rec := serve(s, "GET", "/api/projects/"+p.ID+"/activity?"+q, "", cookie); rec.Code != 400 {
+			t.Errorf("?%s: got %d %s", q, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestBeforeParam(t *testing.T) {
+	for q, want := range map[string]int{
+		"": 200,
+		"?before=0b6f4a1e-8d2c-4c57-9d0e-3f1a2b3c4d5e": 200,
+		"?before=xyz": 400,
+		"?before=0b6f4a1e-8d2c-4c57-9d0e-3f1a2b3c4d5": 400,
+	} {
+		rec := httptest.NewRecorder()
+		if _, ok := beforeParam(rec, httptest.NewRequest("GET", "/"+q, nil)); ok {
+			rec.WriteHeader(200)
+		}
+		if rec.Code != want {
+			t.Errorf("%q: got %d want %d", q, rec.Code, want)
+		}
+	}
+}
@@ -3,10 +3,24 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"regexp"
 )
 
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
 }
+
+// beforeParam returns the ?before= pagination cursor, which must be an event
+// id. A malformed cursor writes a 400 and returns ok=false.
+func beforeParam(w http.ResponseWriter, r *http.Request) (before string, ok bool) {
+	before = r.URL.Query().Get("before")
+	if before != "" && !uuidRe.MatchString(before) {
+		writeJSON(w, 400, map[string]any{"error": "before must be an event id"})
+		return "", false
+	}
+	return before, true
+}
@@ -6,7 +6,7 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/opencel/opencel/internal/queue"
+	"github.com/opencel/opencel/internal/settings"
 )
 
 type importProjectReq struct {
@@ -70,6 +70,20 @@ func (s *Server) handleImportProjectInOrg(w http.ResponseWriter, r *http.Request
 	}
 	owner, repo := parts[0], parts[1]
 
+	// Optional project settings. Template presets the worker does not know
+	// (e.g. "worker") fall back to auto-detection instead of failing the import.
+	var ps *settings.Project
+	if req.RootDir != "" || req.BuildPreset != "" || req.Branch != "" {
+		ps = &settings.Project{RootDir: req.RootDir, BuildPreset: strings.ToLower(strings.TrimSpace(req.BuildPreset)), Branch: req.Branch}
+		if !settings.ValidBuildPreset(ps.BuildPreset) {
+			ps.BuildPreset = ""
+		}
+		if herr := normalizeBuildSettings(ps); herr != nil {
+			writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+			return
+		}
+	}
+
 	gh, cfgd, err := s.GHProvider.Get(r.Context())
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": fmt.Sprintf("github config error: %v", err)})
@@ -107,13 +121,8 @@ func (s *Server) handleImportProjectInOrg(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Store optional project settings JSON.
-	if req.RootDir != "" || req.BuildPreset != "" || req.Branch != "" {
-		_ = s.Store.UpsertProjectSettingsJSON(r.Context(), p.ID, queue.MustJSON(map[string]any{
-			"root_dir":     strings.TrimSpace(req.RootDir),
-			"build_preset": strings.TrimSpace(req.BuildPreset),
-			"branch":       strings.TrimSpace(req.Branch),
-		}))
+	if ps != nil {
+		_ = settings.SaveProject(r.Context(), s.Store, p.ID, ps)
 	}
 
 	writeJSON(w, 201, map[string]any{
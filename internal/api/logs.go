@@ -8,7 +8,10 @@ import (
 	"time"
 )
 
-// SSE endpoint. Clients can pass ?after=<id> to resume.
+// SSE endpoint. Clients can pass ?after=<id> (or Last-Event-ID) to resume, and
+// ?stream=build to leave out runtime logs. The stream wakes on deployment_logs
+// notifications, sends heartbeat comments while idle and ends with an "end"
+// event once the deployment will write no more of the requested logs.
 func (s *Server) handleDeploymentLogsSSE(w http.ResponseWriter, r *http.Request) {
 	uid := userIDFromCtx(r.Context())
 	id := chiURLParam(r, "id")
@@ -41,6 +44,23 @@ func (s *Server) handleDeploymentLogsSSE(w http.ResponseWriter, r *http.Request)
 			afterID = n
 		}
 	}
+	buildOnly := false
+	switch r.URL.Query().Get("stream") {
+	case "":
+	case "build":
+		buildOnly = true
+	default:
+		writeJSON(w, 400, map[string]any{"error": "stream must be build or omitted"})
+		return
+	}
+	// Without runtime logs a READY deployment writes nothing more.
+	readyEnds := buildOnly || !s.Cfg.RuntimeLogs
+	// Browsers send the last id they saw when EventSource reconnects.
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > afterID {
+			afterID = n
+		}
+	}
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -52,27 +72,102 @@ func (s *Server) handleDeploymentLogsSSE(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	ticker := time.NewTicker(750 * time.Millisecond)
-	defer ticker.Stop()
+	wake, unsubscribe := s.LogHub.Subscribe(id)
+	defer unsubscribe()
 
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case <-ticker.C:
+	drain := func() error {
+		for {
 			chunks, err := s.Store.ListLogChunks(r.Context(), id, afterID, 500)
 			if err != nil {
-				fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
-				fl.Flush()
-				return
+				return err
 			}
 			for _, c := range chunks {
 				afterID = c.ID
+				if buildOnly && c.Stream == "runtime" {
+					continue
+				}
 				// Use id to support resume.
 				b, _ := json.Marshal(toLogChunkResp(c))
 				fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", c.ID, string(b))
 			}
+			if len(chunks) < 500 {
+				return nil
+			}
+		}
+	}
+	// send writes new chunks and reports whether the stream is over: the
+	// deployment reached a terminal status and its logs are drained.
+	send := func() (bool, error) {
+		if err := drain(); err != nil {
+			return false, err
+		}
+		cur, err := s.Store.GetDeployment(r.Context(), id)
+		if err != nil {
+			return false, err
+		}
+		if cur == nil || !(terminalStatus(cur.Status) || readyEnds && cur.Status == "READY") {
+			return false, nil
+		}
+		// Chunks written between the drain and the status change.
+		if err := drain(); err != nil {
+			return false, err
+		}
+		b, _ := json.Marshal(map[string]any{"status": cur.Status})
+		fmt.Fprintf(w, "event: end\ndata: %s\n\n", string(b))
+		return true, nil
+	}
+
+	heartbeat := time.NewTicker(logHeartbeatInterval)
+	defer heartbeat.Stop()
+	// Notifications wake the stream; polling only covers a missed one, or all
+	// of them while the hub's LISTEN connection is down.
+	poll := time.NewTicker(time.Second)
+	defer poll.Stop()
+
+	for {
+		done, err := send()
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
 			fl.Flush()
+			return
+		}
+		fl.Flush()
+		if done {
+			return
+		}
+		lastSend := time.Now()
+
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-wake:
+				break wait
+			case <-poll.C:
+				if !s.LogHub.Connected() || time.Since(lastSend) >= logPollInterval {
+					break wait
+				}
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				fl.Flush()
+			}
 		}
 	}
 }
+
+const (
+	logHeartbeatInterval = 15 * time.Second
+	logPollInterval      = 10 * time.Second
+)
+
+// terminalStatus reports whether a deployment will write no more logs. READY
+// is not terminal: its container keeps writing runtime logs, if the instance
+// collects them.
+func terminalStatus(status string) bool {
+	switch status {
+	case "FAILED", "CANCELED", "STOPPED", "EXPIRED":
+		return true
+	}
+	return false
+}
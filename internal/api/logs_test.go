@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDeploymentLogsEndWhenReady(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	u, cookie := newTestUser(t, s, "")
+	org, err := s.Store.CreateOrganization(ctx, testName("org"), "Logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.AddOrgMember(ctx, org.ID, u.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.Store.CreateProject(ctx, org.ID, testName("proj"), testName("acme/repo"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.Store.CreateDeployment(ctx, p.ID, "abc123", "refs/heads/main", "production", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.AppendLogChunk(ctx, d.ID, "build", "step 1/1\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.UpdateDeployment(ctx, d.ID, "READY", nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.AppendLogChunk(ctx, d.ID, "runtime", "listening on :3000\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Streams of a READY deployment only end when no runtime logs can follow,
+	// or none were asked for; otherwise they would block this test.
+	s.Cfg.RuntimeLogs = false
+	rec := serve(s, "GET", "/api/deployments/"+d.ID+"/logs", "", cookie)
+	if body := rec.Body.String(); !strings.Contains(body, "step 1/1") || !strings.Contains(body, "event: end") {
+		t.Fatalf("runtime logs off: %d %s", rec.Code, body)
+	}
+
+	s.Cfg.RuntimeLogs = true
+	rec = serve(s, "GET", "/api/deployments/"+d.ID+"/logs?stream=build", "", cookie)
+	body := rec.Body.String()
+	if !strings.Contains(body, "step 1/1") || !strings.Contains(body, "event: end") {
+		t.Fatalf("build logs: %d %s", rec.Code, body)
+	}
+	if strings.Contains(body, "listening on") {
+		t.Fatalf("build logs include runtime output: %s", body)
+	}
+
+	if rec := serve(s, "GET", "/api/deployments/"+d.ID+"/logs?stream=bogus", "", cookie); rec.Code != 400 {
+		t.Fatalf("unknown stream: got %d", rec.Code)
+	}
+}
@@ -241,8 +241,8 @@ func (s *Server) handleGitHubOAuthCallback(w http.ResponseWriter, r *http.Reques
 	// Determine current user (if already logged in).
 	currentUID := ""
 	if c, err := r.Cookie(authCookieName); err == nil && c.Value != "" {
-		if uid, err := s.verifyJWT(c.Value); err == nil && uid != "" {
-			currentUID = uid
+		if st, err := s.verifySession(r.Context(), c.Value); err == nil {
+			currentUID = st.UserID
 		}
 	}
 
@@ -285,21 +285,17 @@ func (s *Server) handleGitHubOAuthCallback(w http.ResponseWriter, r *http.Reques
 	}
 	_ = s.Store.UpsertGitHubOAuthToken(r.Context(), userID, enc, tr.Scope)
 
-	// Log in user.
-	tok, err := s.signJWT(userID)
+	// Log in user. Linking from a signed-in session needs no second factor;
+	// a sign-in does, if the user turned it on.
+	if currentUID != "" {
+		err = s.startSession(w, r, userID)
+	} else {
+		ret, err = s.startProviderSession(w, r, userID, ret)
+	}
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": "token error"})
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     authCookieName,
-		Value:    tok,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		Secure:   isHTTPS(r),
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-	})
 
 	// Clear oauth cookies.
 	for _, name := range []string{ghStateCookie, ghVerifierCookie, ghReturnCookie} {
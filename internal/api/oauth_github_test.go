@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencel/opencel/internal/integrations"
+	"github.com/opencel/opencel/internal/totp"
+)
+
+// fakeGitHub answers the OAuth calls handleGitHubOAuthCallback makes.
+type fakeGitHub struct {
+	userID int64
+	login  string
+}
+
+func (f fakeGitHub) RoundTrip(r *http.Request) (*http.Response, error) {
+	status, body := 200, ""
+	switch r.URL.Host + r.URL.Path {
+	case "github.com/login/oauth/access_token":
+		body = `{"access_token":"gho_test","scope":"repo"}`
+	case "api.github.com/user":
+		body = fmt.Sprintf(`{"id":%d,"login":%q}`, f.userID, f.login)
+	default:
+		status, body = 404, `{}`
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+// githubSignIn runs the OAuth callback for the GitHub account ghID.
+func githubSignIn(t *testing.T, s *Server, ghID int64) *httptest.ResponseRecorder {
+	t.Helper()
+	orig := http.DefaultClient
+	http.DefaultClient = &http.Client{Transport: fakeGitHub{userID: ghID, login: "octo" + strconv.FormatInt(ghID, 10)}}
+	t.Cleanup(func() { http.DefaultClient = orig })
+
+	req := httptest.NewRequest("GET", "/api/auth/github/callback?code=c1&state=st1", nil)
+	req.AddCookie(&http.Cookie{Name: ghStateCookie, Value: "st1"})
+	req.AddCookie(&http.Cookie{Name: ghVerifierCookie, Value: "verifier"})
+	req.AddCookie(&http.Cookie{Name: ghReturnCookie, Value: "/projects/abc"})
+	rec := httptest.NewRecorder()
+	s.Router.ServeHTTP(rec, req)
+	return rec
+}
+
+func configureGitHubOAuth(t *testing.T, s *Server) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.Settings.SetJSON(ctx, integrations.KeyGitHubOAuthClientID, map[string]string{"client_id": "cid"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Settings.SetSecret(ctx, integrations.KeyGitHubOAuthClientSecret, []byte("csecret")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// finishSecondFactor completes a provider sign-in that was sent to the code
+// step, using the MFA cookie it set.
+func finishSecondFactor(t *testing.T, s *Server, rec *httptest.ResponseRecorder, secret string) *httptest.ResponseRecorder {
+	t.Helper()
+	mfa := responseCookie(rec, mfaCookie)
+	if mfa == nil || mfa.Value == "" {
+		t.Fatal("no MFA cookie")
+	}
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveFrom(s, testIP(), "POST", "/api/auth/login/2fa", fmt.Sprintf(`{"code":%q}`, code), mfa)
+}
+
+func TestGitHubSignInRequiresSecondFactor(t *testing.T) {
+	s := newTestServer(t)
+	configureGitHubOAuth(t, s)
+	ctx := context.Background()
+	u, _ := newTestUser(t, s, "")
+	secret := enableTestTOTP(t, s, u.ID)
+	ghID := time.Now().UnixNano()
+	if _, err := s.Store.UpsertUserIdentity(ctx, u.ID, "github", strconv.FormatInt(ghID, 10), "octo"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := githubSignIn(t, s, ghID)
+	if rec.Code != 302 || !strings.HasPrefix(rec.Header().Get("Location"), "/login?mfa=1&return_to=%2Fprojects%2Fabc") {
+		t.Fatalf("got %d Location=%q", rec.Code, rec.Header().Get("Location"))
+	}
+	if c := responseCookie(rec, authCookieName); c != nil && c.Value != "" {
+		t.Fatal("session cookie issued before the second factor")
+	}
+	rec = finishSecondFactor(t, s, rec, secret)
+	if rec.Code != 200 {
+		t.Fatalf("2fa step: got %d %s", rec.Code, rec.Body)
+	}
+	if c := responseCookie(rec, authCookieName); c == nil || c.Value == "" {
+		t.Fatal("no session cookie after the second factor")
+	}
+}
+
+func TestGitHubSignInWithoutSecondFactor(t *testing.T) {
+	s := newTestServer(t)
+	configureGitHubOAuth(t, s)
+	u, _ := newTestUser(t, s, "")
+	ghID := time.Now().UnixNano()
+	if _, err := s.Store.UpsertUserIdentity(context.Background(), u.ID, "github", strconv.FormatInt(ghID, 10), "octo"); err != nil {
+		t.Fatal(err)
+	}
+	rec := githubSignIn(t, s, ghID)
+	if rec.Code != 302 || rec.Header().Get("Location") != "/projects/abc" {
+		t.Fatalf("got %d Location=%q", rec.Code, rec.Header().Get("Location"))
+	}
+	if c := responseCookie(rec, authCookieName); c == nil || c.Value == "" {
+		t.Fatal("no session cookie")
+	}
+}
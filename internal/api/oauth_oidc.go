@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opencel/opencel/internal/integrations"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	oidcStateCookie    = "opencel_oidc_state"
+	oidcVerifierCookie = "opencel_oidc_verifier"
+	oidcNonceCookie    = "opencel_oidc_nonce"
+	oidcReturnCookie   = "opencel_oidc_return_to"
+)
+
+// oidcProvider is the user_identities provider name for OIDC sign-ins.
+const oidcProvider = "oidc"
+
+func oidcRedirectURI(r *http.Request) string {
+	scheme := "http"
+	if isHTTPS(r) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/auth/oidc/callback", scheme, r.Host)
+}
+
+func setFlowCookie(w http.ResponseWriter, r *http.Request, name, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   isHTTPS(r),
+		Expires:  time.Now().Add(10 * time.Minute),
+	})
+}
+
+func (s *Server) handleOIDCStatus(w http.ResponseWriter, r *http.Request) {
+	cfg, ok, err := integrations.LoadOIDCSettings(r.Context(), s.Settings)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "oidc config error"})
+		return
+	}
+	name := strings.TrimSpace(cfg.DisplayName)
+	if name == "" {
+		name = "SSO"
+	}
+	writeJSON(w, 200, map[string]any{"configured": ok, "display_name": name})
+}
+
+func (s *Server) handleOIDCStart(w http.ResponseWriter, r *http.Request) {
+	cli, _, ok, err := s.OIDC.Get(r.Context())
+	if err != nil {
+		writeJSON(w, 502, map[string]any{"error": "identity provider unavailable: " + err.Error()})
+		return
+	}
+	if !ok {
+		writeJSON(w, 400, map[string]any{"error": "single sign-on not configured"})
+		return
+	}
+	returnTo := strings.TrimSpace(r.URL.Query().Get("return_to"))
+	// "//host" would leave the site.
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+		returnTo = "/projects"
+	}
+
+	state := randB64URL(24)
+	nonce := randB64URL(24)
+	verifier := randB64URL(48)
+	setFlowCookie(w, r, oidcStateCookie, state)
+	setFlowCookie(w, r, oidcNonceCookie, nonce)
+	setFlowCookie(w, r, oidcVerifierCookie, verifier)
+	setFlowCookie(w, r, oidcReturnCookie, returnTo)
+
+	http.Redirect(w, r, cli.AuthCodeURL(oidcRedirectURI(r), state, nonce, pkceChallenge(verifier)), http.StatusFound)
+}
+
+// handleOIDCCallback signs the user in, creating or linking their account, and
+// syncs org roles from their groups. Users with two-factor authentication on
+// still enter their code, as after a password.
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	cli, cfg, ok, err := s.OIDC.Get(r.Context())
+	if err != nil {
+		writeJSON(w, 502, map[string]any{"error": "identity provider unavailable: " + err.Error()})
+		return
+	}
+	if !ok {
+		writeJSON(w, 400, map[string]any{"error": "single sign-on not configured"})
+		return
+	}
+	if e := r.URL.Query().Get("error"); e != "" {
+		writeJSON(w, 401, map[string]any{"error": "sign-in failed: " + e})
+		return
+	}
+	code := strings.TrimSpace(r.URL.Query().Get("code"))
+	state := strings.TrimSpace(r.URL.Query().Get("state"))
+	if code == "" || state == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing code/state"})
+		return
+	}
+	stateC, err := r.Cookie(oidcStateCookie)
+	if err != nil || stateC.Value == "" || stateC.Value != state {
+		writeJSON(w, 400, map[string]any{"error": "invalid oauth state"})
+		return
+	}
+	verC, err := r.Cookie(oidcVerifierCookie)
+	if err != nil || verC.Value == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing oauth verifier"})
+		return
+	}
+	nonceC, err := r.Cookie(oidcNonceCookie)
+	if err != nil || nonceC.Value == "" {
+		writeJSON(w, 400, map[string]any{"error": "missing oauth nonce"})
+		return
+	}
+	ret := "/projects"
+	if rc, err := r.Cookie(oidcReturnCookie); err == nil && strings.HasPrefix(rc.Value, "/") && !strings.HasPrefix(rc.Value, "//") {
+		ret = rc.Value
+	}
+
+	rawID, err := cli.Exchange(r.Context(), oidcRedirectURI(r), code, verC.Value)
+	if err != nil {
+		writeJSON(w, 502, map[string]any{"error": err.Error()})
+		return
+	}
+	claims, err := cli.VerifyIDToken(r.Context(), rawID, nonceC.Value)
+	if err != nil {
+		writeJSON(w, 401, map[string]any{"error": err.Error()})
+		return
+	}
+
+	// Determine current user (if already logged in), to link the identity.
+	currentUID := ""
+	if c, err := r.Cookie(authCookieName); err == nil && c.Value != "" {
+		if st, err := s.verifySession(r.Context(), c.Value); err == nil {
+			currentUID = st.UserID
+		}
+	}
+	userID, herr := s.oidcUser(r.Context(), currentUID, claims.Subject, claims.Email, claims.EmailVerified, cfg.AllowSignup)
+	if herr != nil {
+		writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+		return
+	}
+	login := claims.PreferredUsername
+	if login == "" {
+		login = claims.Email
+	}
+	if _, err := s.Store.UpsertUserIdentity(r.Context(), userID, oidcProvider, claims.Subject, login); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "link identity failed"})
+		return
+	}
+	if err := s.syncOIDCRoles(r.Context(), userID, claims.Groups, cfg.RoleMappings); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "role sync failed: " + err.Error()})
+		return
+	}
+
+	if currentUID != "" {
+		err = s.startSession(w, r, userID)
+	} else {
+		ret, err = s.startProviderSession(w, r, userID, ret)
+	}
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": "token error"})
+		return
+	}
+	for _, name := range []string{oidcStateCookie, oidcVerifierCookie, oidcNonceCookie, oidcReturnCookie} {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: isHTTPS(r)})
+	}
+	http.Redirect(w, r, ret, http.StatusFound)
+}
+
+// oidcUser resolves the account to sign in: the signed-in user (linking the
+// identity), the user already linked to it, an existing user with the same
+// verified email unless they are an instance admin or use two-factor
+// authentication, or a new user if signups are allowed.
+func (s *Server) oidcUser(ctx context.Context, currentUID, subject, email string, emailVerified, allowSignup bool) (string, *httpErr) {
+	ident, err := s.Store.GetUserIdentity(ctx, oidcProvider, subject)
+	if err != nil {
+		return "", &httpErr{status: 500, msg: "db error"}
+	}
+	if currentUID != "" {
+		if ident != nil && ident.UserID != currentUID {
+			return "", &httpErr{status: 409, msg: "this identity is linked to another account"}
+		}
+		return currentUID, nil
+	}
+	if ident != nil {
+		return ident.UserID, nil
+	}
+	email = strings.TrimSpace(email)
+	if email == "" || !emailVerified {
+		return "", &httpErr{status: 403, msg: "identity provider did not return a verified email"}
+	}
+	u, err := s.Store.GetUserByEmail(ctx, email)
+	if err != nil {
+		return "", &httpErr{status: 500, msg: "db error"}
+	}
+	if u != nil {
+		// The provider vouching for the email is not enough to take over an
+		// instance admin or an account with a second factor; those link from
+		// a signed-in session.
+		if u.IsInstanceAdmin {
+			return "", &httpErr{status: 403, msg: "sign in and link single sign-on from your account first"}
+		}
+		t, err := s.enabledTOTP(ctx, u.ID)
+		if err != nil {
+			return "", &httpErr{status: 500, msg: "db error"}
+		}
+		if t != nil {
+			return "", &httpErr{status: 403, msg: "sign in and link single sign-on from your account first"}
+		}
+		return u.ID, nil
+	}
+	if !allowSignup {
+		return "", &httpErr{status: 403, msg: "no account for " + email}
+	}
+	// Non-reusable password: the account signs in through the provider.
+	hash, _ := bcrypt.GenerateFromPassword([]byte(randB64URL(24)), bcrypt.DefaultCost)
+	u, err = s.Store.CreateUser(ctx, email, string(hash))
+	if err != nil {
+		return "", &httpErr{status: 500, msg: "create user failed"}
+	}
+	return u.ID, nil
+}
+
+// mapOIDCRoles returns the role groups grant in each org named by mappings,
+// "" where none of the user's groups match. Groups compare without a leading
+// slash, as Keycloak reports full group paths.
+func mapOIDCRoles(groups []string, mappings []integrations.OIDCRoleMapping) map[string]string {
+	have := map[string]bool{}
+	for _, g := range groups {
+		have[strings.TrimPrefix(g, "/")] = true
+	}
+	out := map[string]string{}
+	for _, m := range mappings {
+		cur, seen := out[m.OrgID]
+		if !seen {
+			out[m.OrgID] = ""
+		}
+		if have[strings.TrimPrefix(m.Group, "/")] && roleRank(m.Role) > roleRank(cur) {
+			out[m.OrgID] = m.Role
+		}
+	}
+	return out
+}
+
+// syncOIDCRoles applies mapOIDCRoles to the user's memberships. It never
+// removes or demotes an org's last owner.
+func (s *Server) syncOIDCRoles(ctx context.Context, userID string, groups []string, mappings []integrations.OIDCRoleMapping) error {
+	for orgID, role := range mapOIDCRoles(groups, mappings) {
+		if role != "owner" {
+			m, err := s.Store.GetOrgMembership(ctx, orgID, userID)
+			if err != nil {
+				return err
+			}
+			if m != nil && m.Role == "owner" {
+				n, err := s.Store.CountOrgOwners(ctx, orgID)
+				if err != nil {
+					return err
+				}
+				if n <= 1 {
+					log.Printf("oidc role sync: keeping %s as the last owner of org %s", userID, orgID)
+					continue
+				}
+			}
+		}
+		if role == "" {
+			if err := s.Store.RemoveOrgMember(ctx, orgID, userID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.Store.AddOrgMember(ctx, orgID, userID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
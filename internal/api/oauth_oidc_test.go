@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/integrations"
+)
+
+func TestMapOIDCRoles(t *testing.T) {
+	mappings := []integrations.OIDCRoleMapping{
+		{Group: "/engineering", OrgID: "org-a", Role: "member"},
+		{Group: "platform", OrgID: "org-a", Role: "admin"},
+		{Group: "finance", OrgID: "org-b", Role: "member"},
+	}
+	got := mapOIDCRoles([]string{"engineering", "/platform"}, mappings)
+	want := map[string]string{"org-a": "admin", "org-b": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	// Orgs without mappings are left alone.
+	if got := mapOIDCRoles([]string{"engineering"}, nil); len(got) != 0 {
+		t.Fatalf("got %v without mappings", got)
+	}
+}
+
+func TestValidateOIDCSettings(t *testing.T) {
+	ok := integrations.OIDCSettings{
+		Enabled:      true,
+		Issuer:       " https://sso.example.com/realms/acme/ ",
+		ClientID:     "opencel",
+		RoleMappings: []integrations.OIDCRoleMapping{{Group: "devs", OrgID: "org-a", Role: "Admin"}},
+	}
+	if msg := validateOIDCSettings(&ok); msg != "" {
+		t.Fatal(msg)
+	}
+	if ok.Issuer != "https://sso.example.com/realms/acme" || ok.RoleMappings[0].Role != "admin" {
+		t.Fatalf("not normalized: %+v", ok)
+	}
+	for name, v := range map[string]integrations.OIDCSettings{
+		"no client":   {Enabled: true, Issuer: "https://sso.example.com"},
+		"bad issuer":  {Issuer: "sso.example.com", ClientID: "x"},
+		"bad role":    {RoleMappings: []integrations.OIDCRoleMapping{{Group: "g", OrgID: "o", Role: "superuser"}}},
+		"empty group": {RoleMappings: []integrations.OIDCRoleMapping{{OrgID: "o", Role: "member"}}},
+	} {
+		if msg := validateOIDCSettings(&v); msg == "" {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestOIDCUserRefusesPrivilegedAutoLink(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	plain, _ := newTestUser(t, s, "")
+	admin, _ := newTestUser(t, s, "")
+	if err := s.Store.SetInstanceAdmin(ctx, admin.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	mfa, _ := newTestUser(t, s, "")
+	if err := s.Store.SetPendingUserTOTP(ctx, mfa.ID, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.EnableUserTOTP(ctx, mfa.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if uid, herr := s.oidcUser(ctx, "", testName("sub"), plain.Email, true, false); herr != nil || uid != plain.ID {
+		t.Fatalf("plain user: %q %v", uid, herr)
+	}
+	for _, u := range []*db.User{admin, mfa} {
+		if _, herr := s.oidcUser(ctx, "", testName("sub"), u.Email, true, false); herr == nil || herr.status != 403 {
+			t.Fatalf("%s auto-linked: %v", u.Email, herr)
+		}
+		// Linking from their own session still works.
+		if uid, herr := s.oidcUser(ctx, u.ID, testName("sub"), u.Email, true, false); herr != nil || uid != u.ID {
+			t.Fatalf("%s explicit link: %q %v", u.Email, uid, herr)
+		}
+	}
+}
+
+func TestSyncOIDCRolesKeepsLastOwner(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	owner, _ := newTestUser(t, s, "")
+	org, err := s.Store.CreateOrganization(ctx, testName("org"), "SSO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.AddOrgMember(ctx, org.ID, owner.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	mappings := []integrations.OIDCRoleMapping{{Group: "devs", OrgID: org.ID, Role: "member"}}
+	role := func() string {
+		t.Helper()
+		m, err := s.Store.GetOrgMembership(ctx, org.ID, owner.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m == nil {
+			return ""
+		}
+		return m.Role
+	}
+
+	for _, groups := range [][]string{nil, {"devs"}} {
+		if err := s.syncOIDCRoles(ctx, owner.ID, groups, mappings); err != nil {
+			t.Fatal(err)
+		}
+		if got := role(); got != "owner" {
+			t.Fatalf("groups %v: last owner became %q", groups, got)
+		}
+	}
+
+	other, _ := newTestUser(t, s, "")
+	if err := s.Store.AddOrgMember(ctx, org.ID, other.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.syncOIDCRoles(ctx, owner.ID, []string{"devs"}, mappings); err != nil {
+		t.Fatal(err)
+	}
+	if got := role(); got != "member" {
+		t.Fatalf("with another owner: got %q, want member", got)
+	}
+}
+
+// newFakeOIDC starts an OpenID provider that signs subject in for any code,
+// and configures s to use it.
+func newFakeOIDC(t *testing.T, s *Server, subject, email string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []any{map[string]any{
+			"kty": "RSA", "kid": "k1", "use": "sig", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            srv.URL,
+			"aud":            "opencel",
+			"sub":            subject,
+			"email":          email,
+			"email_verified": true,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(5 * time.Minute).Unix(),
+			"nonce":          "nonce1",
+		})
+		tok.Header["kid"] = "k1"
+		raw, err := tok.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"id_token": raw, "access_token": "at"})
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	if err := s.Settings.SetJSON(ctx, integrations.KeyOIDC, integrations.OIDCSettings{Enabled: true, Issuer: srv.URL, ClientID: "opencel"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Settings.SetSecret(ctx, integrations.KeyOIDCClientSecret, []byte("s3cret")); err != nil {
+		t.Fatal(err)
+	}
+	s.OIDC.Invalidate()
+}
+
+// oidcSignIn runs the callback as the browser would after the provider
+// signed the user in.
+func oidcSignIn(s *Server) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/auth/oidc/callback?code=c1&state=st1", nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "st1"})
+	req.AddCookie(&http.Cookie{Name: oidcVerifierCookie, Value: "verifier"})
+	req.AddCookie(&http.Cookie{Name: oidcNonceCookie, Value: "nonce1"})
+	req.AddCookie(&http.Cookie{Name: oidcReturnCookie, Value: "/projects/abc"})
+	rec := httptest.NewRecorder()
+	s.Router.ServeHTTP(rec, req)
+	return rec
+}
+
+// A linked identity signs in directly until the user turns on two-factor
+// authentication; from then on it goes through the code step.
+func TestOIDCSignInRequiresSecondFactor(t *testing.T) {
+	s := newTestServer(t)
+	u, _ := newTestUser(t, s, "")
+	subject := testName("sub")
+	if _, err := s.Store.UpsertUserIdentity(context.Background(), u.ID, oidcProvider, subject, u.Email); err != nil {
+		t.Fatal(err)
+	}
+	newFakeOIDC(t, s, subject, u.Email)
+
+	rec := oidcSignIn(s)
+	if rec.Code != 302 || rec.Header().Get("Location") != "/projects/abc" {
+		t.Fatalf("before 2fa: got %d Location=%q %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	if c := responseCookie(rec, authCookieName); c == nil || c.Value == "" {
+		t.Fatal("before 2fa: no session cookie")
+	}
+
+	secret := enableTestTOTP(t, s, u.ID)
+	rec = oidcSignIn(s)
+	if rec.Code != 302 || !strings.HasPrefix(rec.Header().Get("Location"), "/login?mfa=1&return_to=%2Fprojects%2Fabc") {
+		t.Fatalf("with 2fa: got %d Location=%q %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+	if c := responseCookie(rec, authCookieName); c != nil && c.Value != "" {
+		t.Fatal("session cookie issued before the second factor")
+	}
+	rec = finishSecondFactor(t, s, rec, secret)
+	if rec.Code != 200 {
+		t.Fatalf("2fa step: got %d %s", rec.Code, rec.Body)
+	}
+	if c := responseCookie(rec, authCookieName); c == nil || c.Value == "" {
+		t.Fatal("no session cookie after the second factor")
+	}
+}
@@ -3,6 +3,9 @@ package api
 import (
 	"context"
 	"errors"
+	"net/http"
+
+	"github.com/opencel/opencel/internal/db"
 )
 
 type httpErr struct {
@@ -24,6 +27,9 @@ func roleRank(role string) int {
 }
 
 func (s *Server) requireOrgRole(ctx context.Context, userID, orgID, minRole string) *httpErr {
+	if !orgAllowed(ctx, orgID) {
+		return &httpErr{status: 403, msg: "forbidden"}
+	}
 	role, err := s.Store.GetOrgRole(ctx, userID, orgID)
 	if err != nil {
 		return &httpErr{status: 500, msg: err.Error()}
@@ -34,9 +40,30 @@ func (s *Server) requireOrgRole(ctx context.Context, userID, orgID, minRole stri
 	if roleRank(role) < roleRank(minRole) {
 		return &httpErr{status: 403, msg: "forbidden"}
 	}
+	missing, err := s.Store.MissingRequired2FA(ctx, userID, orgID)
+	if err != nil {
+		return &httpErr{status: 500, msg: err.Error()}
+	}
+	if missing {
+		return &httpErr{status: 403, msg: "two-factor authentication required by this org"}
+	}
 	return nil
 }
 
+// isOrgMember is Store.IsUserOrgMember that also honors org tokens and the
+// org's two-factor requirement.
+func (s *Server) isOrgMember(ctx context.Context, userID, orgID string) (bool, error) {
+	if !orgAllowed(ctx, orgID) {
+		return false, nil
+	}
+	ok, err := s.Store.IsUserOrgMember(ctx, userID, orgID)
+	if err != nil || !ok {
+		return false, err
+	}
+	missing, err := s.Store.MissingRequired2FA(ctx, userID, orgID)
+	return !missing, err
+}
+
 func (s *Server) requireProjectMember(ctx context.Context, userID, projectID string) (*string, error) {
 	p, err := s.Store.GetProject(ctx, projectID)
 	if err != nil {
@@ -45,7 +72,7 @@ func (s *Server) requireProjectMember(ctx context.Context, userID, projectID str
 	if p == nil {
 		return nil, errors.New("not found")
 	}
-	ok, err := s.Store.IsUserOrgMember(ctx, userID, p.OrgID)
+	ok, err := s.isOrgMember(ctx, userID, p.OrgID)
 	if err != nil {
 		return nil, err
 	}
@@ -54,3 +81,49 @@ func (s *Server) requireProjectMember(ctx context.Context, userID, projectID str
 	}
 	return &p.OrgID, nil
 }
+
+// projectWithRole loads the project named by the {id} URL param and checks the
+// caller's org role. On failure it writes the error response and returns nil.
+func (s *Server) projectWithRole(w http.ResponseWriter, r *http.Request, minRole string) *db.Project {
+	p, err := s.Store.GetProject(r.Context(), chiURLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return nil
+	}
+	if p == nil {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return nil
+	}
+	if herr := s.requireOrgRole(r.Context(), userIDFromCtx(r.Context()), p.OrgID, minRole); herr != nil {
+		writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+		return nil
+	}
+	return p
+}
+
+// deploymentWithRole is projectWithRole for routes keyed by a deployment {id}.
+func (s *Server) deploymentWithRole(w http.ResponseWriter, r *http.Request, minRole string) (*db.Deployment, *db.Project) {
+	d, err := s.Store.GetDeployment(r.Context(), chiURLParam(r, "id"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return nil, nil
+	}
+	if d == nil {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return nil, nil
+	}
+	p, err := s.Store.GetProject(r.Context(), d.ProjectID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return nil, nil
+	}
+	if p == nil {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return nil, nil
+	}
+	if herr := s.requireOrgRole(r.Context(), userIDFromCtx(r.Context()), p.OrgID, minRole); herr != nil {
+		writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+		return nil, nil
+	}
+	return d, p
+}
@@ -14,6 +14,8 @@ type orgResp struct {
 	Name      string    `json:"name"`
 	CreatedAt time.Time `json:"created_at"`
 	Role      string    `json:"role"`
+	// Require2FA is set when members need two-factor authentication.
+	Require2FA bool `json:"require_2fa"`
 }
 
 type orgMemberResp struct {
@@ -34,12 +36,15 @@ func (s *Server) handleListOrgs(w http.ResponseWriter, r *http.Request) {
 	}
 	out := make([]orgResp, 0, len(orgs))
 	for _, o := range orgs {
+		if !orgAllowed(r.Context(), o.ID) {
+			continue
+		}
 		role, err := s.Store.GetOrgRole(r.Context(), uid, o.ID)
 		if err != nil {
 			writeJSON(w, 500, map[string]any{"error": err.Error()})
 			return
 		}
-		out = append(out, orgResp{ID: o.ID, Slug: o.Slug, Name: o.Name, CreatedAt: o.CreatedAt, Role: role})
+		out = append(out, orgResp{ID: o.ID, Slug: o.Slug, Name: o.Name, CreatedAt: o.CreatedAt, Role: role, Require2FA: o.Require2FA})
 	}
 	writeJSON(w, 200, out)
 }
@@ -70,13 +75,13 @@ func (s *Server) handleCreateOrg(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 500, map[string]any{"error": err.Error()})
 		return
 	}
-	writeJSON(w, 201, orgResp{ID: o.ID, Slug: o.Slug, Name: o.Name, CreatedAt: o.CreatedAt, Role: "owner"})
+	writeJSON(w, 201, orgResp{ID: o.ID, Slug: o.Slug, Name: o.Name, CreatedAt: o.CreatedAt, Role: "owner", Require2FA: o.Require2FA})
 }
 
 func (s *Server) handleGetOrg(w http.ResponseWriter, r *http.Request) {
 	uid := userIDFromCtx(r.Context())
 	orgID := chiURLParam(r, "orgID")
-	ok, err := s.Store.IsUserOrgMember(r.Context(), uid, orgID)
+	ok, err := s.isOrgMember(r.Context(), uid, orgID)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": err.Error()})
 		return
@@ -95,7 +100,7 @@ func (s *Server) handleGetOrg(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	role, _ := s.Store.GetOrgRole(r.Context(), uid, orgID)
-	writeJSON(w, 200, orgResp{ID: o.ID, Slug: o.Slug, Name: o.Name, CreatedAt: o.CreatedAt, Role: role})
+	writeJSON(w, 200, orgResp{ID: o.ID, Slug: o.Slug, Name: o.Name, CreatedAt: o.CreatedAt, Role: role, Require2FA: o.Require2FA})
 }
 
 func (s *Server) handleListOrgMembers(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/opencel/opencel/internal/settings"
+)
+
+type projectSettingsResp struct {
+	Settings  *settings.Project        `json:"settings"`
+	Effective projectSettingsEffective `json:"effective"`
+}
+
+// projectSettingsEffective shows the values in force once instance defaults are applied.
+type projectSettingsEffective struct {
+	HealthCheckPath           string             `json:"health_check_path"`
+	HealthCheckTimeoutSeconds int                `json:"health_check_timeout_seconds"`
+	PreviewRetention          int                `json:"preview_retention"`
+	Resources                 settings.Resources `json:"resources"`
+}
+
+func (s *Server) toProjectSettingsResp(ps *settings.Project) projectSettingsResp {
+	path, timeout := ps.HealthCheck(s.Cfg)
+	return projectSettingsResp{
+		Settings: ps,
+		Effective: projectSettingsEffective{
+			HealthCheckPath:           path,
+			HealthCheckTimeoutSeconds: int(timeout.Seconds()),
+			PreviewRetention:          ps.Retention(s.Cfg),
+			Resources:                 ps.Resources.Effective(s.Cfg),
+		},
+	}
+}
+
+func (s *Server) handleGetProjectSettings(w http.ResponseWriter, r *http.Request) {
+	p := s.projectWithRole(w, r, "member")
+	if p == nil {
+		return
+	}
+	ps, err := settings.LoadProject(r.Context(), s.Store, p.ID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, s.toProjectSettingsResp(ps))
+}
+
+// handleUpdateProjectSettings applies a partial update: fields missing from the
+// body keep their stored values.
+func (s *Server) handleUpdateProjectSettings(w http.ResponseWriter, r *http.Request) {
+	p := s.projectWithRole(w, r, "admin")
+	if p == nil {
+		return
+	}
+	ps, err := settings.LoadProject(r.Context(), s.Store, p.ID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(ps); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json: " + err.Error()})
+		return
+	}
+	if herr := normalizeBuildSettings(ps); herr != nil {
+		writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+		return
+	}
+	ps.HealthCheckPath = strings.TrimSpace(ps.HealthCheckPath)
+	if ps.HealthCheckTimeoutSeconds < 0 || ps.HealthCheckTimeoutSeconds > 600 {
+		writeJSON(w, 400, map[string]any{"error": "health_check_timeout_seconds must be between 0 and 600"})
+		return
+	}
+	if ps.PreviewRetention < 0 {
+		writeJSON(w, 400, map[string]any{"error": "preview_retention must not be negative"})
+		return
+	}
+	if err := ps.Resources.Validate(s.Cfg); err != nil {
+		writeJSON(w, 400, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := settings.SaveProject(r.Context(), s.Store, p.ID, ps); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, s.toProjectSettingsResp(ps))
+}
+
+// normalizeBuildSettings validates and cleans root_dir, build_preset and branch.
+func normalizeBuildSettings(ps *settings.Project) *httpErr {
+	rootDir, err := settings.CleanRootDir(ps.RootDir)
+	if err != nil {
+		return &httpErr{status: 400, msg: err.Error()}
+	}
+	ps.RootDir = rootDir
+	ps.BuildPreset = strings.ToLower(strings.TrimSpace(ps.BuildPreset))
+	if !settings.ValidBuildPreset(ps.BuildPreset) {
+		return &httpErr{status: 400, msg: fmt.Sprintf("build_preset must be one of %s", strings.Join(settings.BuildPresets, ", "))}
+	}
+	pats, err := settings.BranchPatterns(ps.Branch)
+	if err != nil {
+		return &httpErr{status: 400, msg: err.Error()}
+	}
+	ps.Branch = strings.Join(pats, ",")
+	return nil
+}
@@ -21,10 +21,12 @@ func (s *Server) firstOrgIDForUser(ctx context.Context, userID string) (string,
 	if err != nil {
 		return "", err
 	}
-	if len(orgs) == 0 {
-		return "", nil
+	for _, o := range orgs {
+		if orgAllowed(ctx, o.ID) {
+			return o.ID, nil
+		}
 	}
-	return orgs[0].ID, nil
+	return "", nil
 }
 
 func (s *Server) handleCreateProjectInOrg(w http.ResponseWriter, r *http.Request) {
@@ -148,6 +150,10 @@ func (s *Server) handleListProjects(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 200, []any{})
 		return
 	}
+	if err := s.requireOrgRole(r.Context(), uid, orgID, "member"); err != nil {
+		writeJSON(w, err.status, map[string]any{"error": err.msg})
+		return
+	}
 	ps, err := s.Store.ListProjectsByOrg(r.Context(), orgID)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": err.Error()})
@@ -197,7 +203,7 @@ func (s *Server) handleGetProject(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 404, map[string]any{"error": "not found"})
 		return
 	}
-	ok, err := s.Store.IsUserOrgMember(r.Context(), uid, p.OrgID)
+	ok, err := s.isOrgMember(r.Context(), uid, p.OrgID)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": err.Error()})
 		return
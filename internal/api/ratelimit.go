@@ -0,0 +1,103 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencel/opencel/internal/ratelimit"
+)
+
+// Per-IP limit on the endpoints that check passwords or codes. bcrypt makes
+// each attempt expensive, so this also bounds the CPU one client can use.
+const (
+	authIPLimit  = 20
+	authIPWindow = time.Minute
+)
+
+// loginLockout locks an account out after repeated failed sign-ins: 1 minute
+// after 5 failures, doubling for each further lockout within a day.
+var loginLockout = ratelimit.Lockout{
+	Threshold: 5,
+	Window:    15 * time.Minute,
+	Base:      time.Minute,
+	Max:       time.Hour,
+	Decay:     24 * time.Hour,
+}
+
+const auditLockout = "auth.lockout"
+
+func loginLockoutKey(email string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func twoFactorLockoutKey(userID string) string {
+	return "2fa:" + userID
+}
+
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, msg string) {
+	secs := max(int(math.Ceil(retryAfter.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	writeJSON(w, 429, map[string]any{"error": msg, "retry_after": secs})
+}
+
+// limitByIP allows each client IP limit requests per window on the routes it
+// wraps. Limits fail open: if Redis is down, requests go through.
+func (s *Server) limitByIP(scope string, limit int, window time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := s.Limiter.Allow(r.Context(), scope+":ip:"+clientIP(r), limit, window)
+			if err != nil {
+				log.Printf("ratelimit %s: %v", scope, err)
+			} else if !res.Allowed {
+				writeTooManyRequests(w, res.RetryAfter, "too many requests, try again later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// accountLocked writes a 429 and returns true if key is locked out.
+func (s *Server) accountLocked(w http.ResponseWriter, r *http.Request, key string) bool {
+	left, err := s.Limiter.Locked(r.Context(), key)
+	if err != nil {
+		log.Printf("ratelimit lockout: %v", err)
+		return false
+	}
+	if left > 0 {
+		writeTooManyRequests(w, left, "too many failed attempts, try again later")
+		return true
+	}
+	return false
+}
+
+// authFailed counts a failed attempt against key. If that locks the account
+// out, it records the lockout in the audit trail, writes a 429 and returns
+// true; otherwise the caller reports the failure itself.
+func (s *Server) authFailed(w http.ResponseWriter, r *http.Request, key, reason, subject string) bool {
+	d, level, err := s.Limiter.Fail(r.Context(), loginLockout, key)
+	if err != nil {
+		log.Printf("ratelimit lockout: %v", err)
+		return false
+	}
+	if d == 0 {
+		return false
+	}
+	meta := map[string]any{"reason": reason, "level": level, "duration_s": int(d.Seconds())}
+	if err := s.Store.AddAuditEvent(r.Context(), auditLockout, "", subject, clientIP(r), meta); err != nil {
+		log.Printf("audit %s: %v", auditLockout, err)
+	}
+	writeTooManyRequests(w, d, "too many failed attempts, try again later")
+	return true
+}
+
+// authSucceeded clears key's failure count.
+func (s *Server) authSucceeded(r *http.Request, key string) {
+	if err := s.Limiter.Reset(r.Context(), key); err != nil {
+		log.Printf("ratelimit reset: %v", err)
+	}
+}
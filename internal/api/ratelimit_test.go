@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestWriteTooManyRequests(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeTooManyRequests(rec, 1500*time.Millisecond, "slow down")
+	if rec.Code != 429 || rec.Header().Get("Retry-After") != "2" {
+		t.Fatalf("got %d Retry-After=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	rec = httptest.NewRecorder()
+	writeTooManyRequests(rec, 0, "slow down")
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Retry-After=%q for an elapsed window", rec.Header().Get("Retry-After"))
+	}
+}
+
+// Without Redis, limits fail open rather than lock everyone out.
+func TestLimitByIPFailsOpen(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 50 * time.Millisecond, MaxRetries: -1})
+	defer rdb.Close()
+	s := &Server{Limiter: ratelimit.New(rdb)}
+	h := s.limitByIP("login", 1, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	}))
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/api/auth/login", nil))
+		if rec.Code != 204 {
+			t.Fatalf("request %d: got %d", i+1, rec.Code)
+		}
+	}
+}
+
+// lockoutEvent returns the newest auth.lockout audit event about subject.
+func lockoutEvent(t *testing.T, s *Server, subject string) *db.AuditEvent {
+	t.Helper()
+	evs, err := s.Store.ListAuditEvents(context.Background(), auditLockout, "", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range evs {
+		if evs[i].Subject == subject {
+			return &evs[i]
+		}
+	}
+	return nil
+}
+
+func TestLoginLockout(t *testing.T) {
+	requireTestRedis(t)
+	s := newTestServer(t)
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := newTestUser(t, s, string(hash))
+	ip := testIP()
+	login := func(password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"email":%q,"password":%q}`, u.Email, password)
+		return serveFrom(s, ip, "POST", "/api/auth/login", body, nil)
+	}
+
+	for i := 1; i < loginLockout.Threshold; i++ {
+		if rec := login("wrong"); rec.Code != 401 {
+			t.Fatalf("attempt %d: got %d %s", i, rec.Code, rec.Body)
+		}
+	}
+	rec := login("wrong")
+	if rec.Code != 429 || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("locking attempt: got %d Retry-After=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// The right password does not help while locked out.
+	if rec := login("correct horse"); rec.Code != 429 || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("while locked: got %d Retry-After=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	ev := lockoutEvent(t, s, u.Email)
+	if ev == nil {
+		t.Fatal("no auth.lockout audit event")
+	}
+	if ev.Metadata["reason"] != "password" || ev.IP != ip {
+		t.Fatalf("audit event: %+v", ev)
+	}
+
+	admin, adminCookie := newTestUser(t, s, "")
+	if err := s.Store.SetInstanceAdmin(ctx, admin.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(s, "POST", "/api/admin/users/"+u.ID+"/unlock", "", adminCookie); rec.Code != 200 {
+		t.Fatalf("unlock: got %d %s", rec.Code, rec.Body)
+	}
+	rec = login("correct horse")
+	if rec.Code != 200 {
+		t.Fatalf("after unlock: got %d %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Header().Get("Set-Cookie"), authCookieName+"=") {
+		t.Fatal("no session cookie after unlock")
+	}
+}
+
+func TestLogin2FALockout(t *testing.T) {
+	requireTestRedis(t)
+	s := newTestServer(t)
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := newTestUser(t, s, string(hash))
+	if err := s.Store.SetPendingUserTOTP(ctx, u.ID, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.EnableUserTOTP(ctx, u.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	ip := testIP()
+	rec := serveFrom(s, ip, "POST", "/api/auth/login", fmt.Sprintf(`{"email":%q,"password":"correct horse"}`, u.Email), nil)
+	var resp struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || !resp.MFARequired || resp.MFAToken == "" {
+		t.Fatalf("login: %d %s", rec.Code, rec.Body)
+	}
+	// Not a code the user has: a recovery code that was never issued.
+	attempt := func() *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"mfa_token":%q,"code":"aaaa-bbbb"}`, resp.MFAToken)
+		return serveFrom(s, ip, "POST", "/api/auth/login/2fa", body, nil)
+	}
+
+	for i := 1; i < loginLockout.Threshold; i++ {
+		if rec := attempt(); rec.Code != 401 {
+			t.Fatalf("attempt %d: got %d %s", i, rec.Code, rec.Body)
+		}
+	}
+	if rec := attempt(); rec.Code != 429 || rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("locking attempt: got %d Retry-After=%q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := attempt(); rec.Code != 429 {
+		t.Fatalf("while locked: got %d", rec.Code)
+	}
+	if ev := lockoutEvent(t, s, u.Email); ev == nil || ev.Metadata["reason"] != "2fa" {
+		t.Fatalf("audit event: %+v", ev)
+	}
+
+	admin, adminCookie := newTestUser(t, s, "")
+	if err := s.Store.SetInstanceAdmin(ctx, admin.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(s, "POST", "/api/admin/users/"+u.ID+"/unlock", "", adminCookie); rec.Code != 200 {
+		t.Fatalf("unlock: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := attempt(); rec.Code != 401 {
+		t.Fatalf("after unlock: got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAdminListAuditEventsRejectsBadCursor(t *testing.T) {
+	s := newTestServer(t)
+	admin, cookie := newTestUser(t, s, "")
+	if err := s.Store.SetInstanceAdmin(context.Background(), admin.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(s, "GET", "/api/admin/audit-events?before=nope", "", cookie); rec.Code != 400 {
+		t.Fatalf("got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(s, "GET", "/api/admin/audit-events", "", cookie); rec.Code != 200 {
+		t.Fatalf("got %d %s", rec.Code, rec.Body)
+	}
+}
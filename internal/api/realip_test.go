@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/opencel/opencel/internal/config"
+	"github.com/opencel/opencel/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+func defaultTrustedProxies() []netip.Prefix {
+	var out []netip.Prefix
+	for _, p := range config.DefaultTrustedProxies {
+		out = append(out, netip.MustParsePrefix(p))
+	}
+	return out
+}
+
+func TestForwardedClientIP(t *testing.T) {
+	trusted := defaultTrustedProxies()
+	for _, tc := range []struct {
+		name    string
+		peer    string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer", "203.0.113.9:4000", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"}, ""},
+		{"proxy", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"client-written hop", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.9"}, "203.0.113.9"},
+		{"two proxies", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "203.0.113.9, 10.0.0.7"}, "203.0.113.9"},
+		{"x-real-ip", "10.0.0.5:4000", map[string]string{"X-Real-IP": "203.0.113.9"}, "203.0.113.9"},
+		{"true-client-ip", "10.0.0.5:4000", map[string]string{"True-Client-IP": "203.0.113.9"}, ""},
+		{"garbage", "10.0.0.5:4000", map[string]string{"X-Forwarded-For": "not-an-ip"}, ""},
+		{"mapped peer", "[::ffff:10.0.0.5]:4000", map[string]string{"X-Forwarded-For": "2001:db8::1"}, "2001:db8::1"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.peer
+		for k, v := range tc.headers {
+			r.Header.Set(k, v)
+		}
+		if got := forwardedClientIP(r, trusted); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.5:4000"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	if got := forwardedClientIP(r, nil); got != "" {
+		t.Errorf("no trusted proxies: got %q", got)
+	}
+}
+
+func TestLimitByIPIgnoresSpoofedHeaders(t *testing.T) {
+	addr := os.Getenv("OPENCEL_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("OPENCEL_TEST_REDIS_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	defer rdb.Close()
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("redis: %v", err)
+	}
+	s := &Server{Cfg: &config.Config{TrustedProxies: defaultTrustedProxies()}, Limiter: ratelimit.New(rdb)}
+	h := s.realIP(s.limitByIP(testName("spoof"), 2, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})))
+	do := func(peer string, headers map[string]string) int {
+		r := httptest.NewRequest("POST", "/api/auth/login", nil)
+		r.RemoteAddr = peer
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	client := "203.0.113.50:4000"
+	for i := 0; i < 2; i++ {
+		if code := do(client, nil); code != 204 {
+			t.Fatalf("request %d: got %d", i+1, code)
+		}
+	}
+	for _, hdr := range []string{"X-Forwarded-For", "X-Real-IP", "True-Client-IP"} {
+		if code := do(client, map[string]string{hdr: "198.51.100.1"}); code != 429 {
+			t.Errorf("spoofed %s: got %d, want 429", hdr, code)
+		}
+	}
+	// Through a proxy, a hop the client wrote itself does not count either.
+	if code := do("10.0.0.2:4000", map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.50"}); code != 429 {
+		t.Errorf("spoofed hop behind a proxy: got %d, want 429", code)
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hibiken/asynq"
+	"github.com/opencel/opencel/internal/queue"
+)
+
+// handleRedeployDeployment starts the deployment's existing image again as a
+// new deployment, picking up the project's current env vars without a rebuild.
+func (s *Server) handleRedeployDeployment(w http.ResponseWriter, r *http.Request) {
+	src, _ := s.deploymentWithRole(w, r, "admin")
+	if src == nil {
+		return
+	}
+	if src.Status == "EXPIRED" || !src.ImageRef.Valid || src.ImageRef.String == "" {
+		writeJSON(w, 409, map[string]any{"error": "deployment has no image to redeploy"})
+		return
+	}
+
+	var prNumber *int
+	if src.PRNumber.Valid {
+		v := int(src.PRNumber.Int64)
+		prNumber = &v
+	}
+	dep, err := s.Store.CreateDeployment(r.Context(), src.ProjectID, src.GitSHA, src.GitRef, src.Type, prNumber)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	imageRef, port := src.ImageRef.String, src.ServicePort
+	if err := s.Store.UpdateDeployment(r.Context(), dep.ID, "", &imageRef, nil, &port, nil); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := s.Store.SetDeploymentAppConfig(r.Context(), dep.ID, src.HealthCheckPath.String, src.EnvDefaults); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := s.Store.SetDeploymentCommit(r.Context(), dep.ID, src.CommitMessage.String, src.CommitAuthor.String); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	_ = s.Store.AddDeploymentEvent(r.Context(), dep.ID, "QUEUED", fmt.Sprintf("Redeploy of %s queued", src.ID))
+
+	task := asynq.NewTask(queue.TaskRedeploy, queue.MustJSON(queue.RedeployPayload{DeploymentID: dep.ID, SourceDeploymentID: src.ID, ActorUserID: userIDFromCtx(r.Context())}), asynq.TaskID(dep.ID), asynq.MaxRetry(0))
+	if _, err := s.Queue.Enqueue(task); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 202, map[string]any{"ok": true, "deployment_id": dep.ID})
+}
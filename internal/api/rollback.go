@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hibiken/asynq"
+	"github.com/opencel/opencel/internal/queue"
+)
+
+type rollbackReq struct {
+	DeploymentID string `json:"deployment_id,omitempty"`
+}
+
+// handleRollback re-promotes an earlier deployment: the one given in the body,
+// or else the deployment that was production before the current one. The
+// worker does the actual work since the container may need recreating.
+func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request) {
+	p := s.projectWithRole(w, r, "admin")
+	if p == nil {
+		return
+	}
+	var req rollbackReq
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, 400, map[string]any{"error": "invalid json"})
+			return
+		}
+	}
+
+	current := ""
+	if p.ProductionDeploymentID.Valid {
+		current = p.ProductionDeploymentID.String
+	}
+	targetID := req.DeploymentID
+	if targetID == "" {
+		prev, err := s.Store.GetPreviousProductionDeployment(r.Context(), p.ID, current)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		if prev == nil {
+			writeJSON(w, 409, map[string]any{"error": "no previous production deployment to roll back to"})
+			return
+		}
+		targetID = prev.ID
+	}
+
+	d, err := s.Store.GetDeployment(r.Context(), targetID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if d == nil || d.ProjectID != p.ID {
+		writeJSON(w, 404, map[string]any{"error": "deployment not found"})
+		return
+	}
+	if d.Type != "production" {
+		writeJSON(w, 409, map[string]any{"error": "only production deployments can be rolled back to"})
+		return
+	}
+	if d.ID == current {
+		writeJSON(w, 409, map[string]any{"error": "deployment is already production"})
+		return
+	}
+	if d.Status == "EXPIRED" || !d.ImageRef.Valid || d.ImageRef.String == "" {
+		writeJSON(w, 409, map[string]any{"error": "deployment has no image to roll back to"})
+		return
+	}
+
+	// A half-finished rollback should be retried by the user, not silently by the queue.
+	task := asynq.NewTask(queue.TaskRollback, queue.MustJSON(queue.RollbackPayload{DeploymentID: d.ID, ActorUserID: userIDFromCtx(r.Context())}), asynq.MaxRetry(0))
+	if _, err := s.Queue.Enqueue(task); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 202, map[string]any{"ok": true, "deployment_id": d.ID})
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRollbackWithoutProductionDeployment(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	u, cookie := newTestUser(t, s, "")
+	org, err := s.Store.CreateOrganization(ctx, testName("org"), "Rollback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.AddOrgMember(ctx, org.ID, u.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.Store.CreateProject(ctx, org.ID, testName("proj"), testName("acme/repo"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev, err := s.Store.GetPreviousProductionDeployment(ctx, p.ID, "")
+	if err != nil || prev != nil {
+		t.Fatalf("GetPreviousProductionDeployment = %+v, %v; want nil, nil", prev, err)
+	}
+	if rec := serve(s, "POST", "/api/projects/"+p.ID+"/rollback", "", cookie); rec.Code != 409 {
+		t.Fatalf("rollback: got %d %s, want 409", rec.Code, rec.Body)
+	}
+
+	d, err := s.Store.CreateDeployment(ctx, p.ID, "abc123", "refs/heads/main", "production", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.SetProjectProductionDeployment(ctx, p.ID, d.ID); err != nil {
+		t.Fatal(err)
+	}
+	if prev, err := s.Store.GetPreviousProductionDeployment(ctx, p.ID, ""); err != nil || prev == nil || prev.ID != d.ID {
+		t.Fatalf("without a current deployment: %+v, %v; want %s", prev, err, d.ID)
+	}
+	if prev, err := s.Store.GetPreviousProductionDeployment(ctx, p.ID, d.ID); err != nil || prev != nil {
+		t.Fatalf("excluding the current deployment: %+v, %v; want nil, nil", prev, err)
+	}
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/opencel/opencel/internal/appconfig"
+)
+
+// handleAppConfigSchema serves the JSON Schema of opencel.json. It is public
+// so editors can fetch it from the "$schema" URL.
+func (s *Server) handleAppConfigSchema(w http.ResponseWriter, r *http.Request) {
+	b, err := appconfig.Schema()
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_, _ = w.Write(b)
+}
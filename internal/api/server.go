@@ -11,7 +11,10 @@ import (
 	"github.com/opencel/opencel/internal/config"
 	"github.com/opencel/opencel/internal/db"
 	"github.com/opencel/opencel/internal/integrations"
+	"github.com/opencel/opencel/internal/logstream"
+	"github.com/opencel/opencel/internal/ratelimit"
 	"github.com/opencel/opencel/internal/settings"
+	"github.com/redis/go-redis/v9"
 )
 
 type Server struct {
@@ -19,7 +22,13 @@ type Server struct {
 	Store      *db.Store
 	Settings   *settings.Store
 	Queue      *asynq.Client
+	Inspector  *asynq.Inspector
 	GHProvider *integrations.GitHubAppProvider
+	OIDC       *integrations.OIDCProvider
+	// LogHub wakes log streams; run it with LogHub.Run.
+	LogHub *logstream.Hub
+	// Limiter keeps rate limits and login lockouts in Redis.
+	Limiter *ratelimit.Limiter
 
 	Router http.Handler
 }
@@ -31,12 +40,16 @@ func NewServer(cfg *config.Config, store *db.Store) (*Server, error) {
 		Store:      store,
 		Settings:   st,
 		Queue:      asynq.NewClient(asynq.RedisClientOpt{Addr: cfg.RedisAddr}),
+		Inspector:  asynq.NewInspector(asynq.RedisClientOpt{Addr: cfg.RedisAddr}),
 		GHProvider: integrations.NewGitHubAppProvider(cfg, st),
+		OIDC:       integrations.NewOIDCProvider(st),
+		LogHub:     logstream.NewHub(cfg.DSN),
+		Limiter:    ratelimit.New(redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})),
 	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(s.realIP)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
 	r.Use(cors.Handler(cors.Options{
@@ -65,24 +78,59 @@ func NewServer(cfg *config.Config, store *db.Store) (*Server, error) {
 			w.WriteHeader(200)
 			_, _ = w.Write([]byte("ok"))
 		})
+		r.Get("/schema/opencel.json", s.handleAppConfigSchema)
 		r.Get("/setup/status", s.handleSetupStatus)
-		r.Post("/setup", s.handleSetup)
+		r.With(s.limitByIP("setup", authIPLimit, authIPWindow)).Post("/setup", s.handleSetup)
 		r.Get("/integrations/github/status", s.handleGitHubStatus) // compat
 		r.Get("/integrations/github/app/status", s.handleGitHubAppStatus)
 		r.Get("/integrations/github/app/install-url", s.handleGitHubAppInstallURL)
-		r.Post("/auth/login", s.handleLogin)
+		r.Group(func(r chi.Router) {
+			r.Use(s.limitByIP("login", authIPLimit, authIPWindow))
+			r.Post("/auth/login", s.handleLogin)
+			r.Post("/auth/login/2fa", s.handleLogin2FA)
+		})
 		r.Post("/auth/logout", s.handleLogout)
 		r.Get("/auth/github/status", s.handleGitHubOAuthStatus)
 		r.Get("/auth/github/start", s.handleGitHubOAuthStart)
 		r.Get("/auth/github/callback", s.handleGitHubOAuthCallback)
+		r.Get("/auth/oidc/status", s.handleOIDCStatus)
+		r.Get("/auth/oidc/start", s.handleOIDCStart)
+		r.Get("/auth/oidc/callback", s.handleOIDCCallback)
 
 		r.Group(func(r chi.Router) {
 			r.Use(s.authMiddleware)
 			r.Get("/me", s.handleMe)
 
-			r.Get("/github/me", s.handleGitHubMe)
-			r.Get("/github/repos", s.handleGitHubRepos)
-			r.Post("/auth/github/disconnect", s.handleGitHubDisconnect)
+			r.Group(func(r chi.Router) {
+				r.Use(denyOrgTokens)
+				r.Get("/github/me", s.handleGitHubMe)
+				r.Get("/github/repos", s.handleGitHubRepos)
+				r.Post("/auth/github/disconnect", s.handleGitHubDisconnect)
+				r.Post("/orgs", s.handleCreateOrg)
+			})
+
+			r.Route("/sessions", func(r chi.Router) {
+				r.Use(requireSession)
+				r.Get("/", s.handleListSessions)
+				r.Delete("/", s.handleRevokeOtherSessions)
+				r.Delete("/{sessionID}", s.handleRevokeSession)
+			})
+
+			r.Route("/auth/2fa", func(r chi.Router) {
+				r.Use(requireSession)
+				r.Get("/", s.handleTwoFactorStatus)
+				r.Post("/enroll", s.handleTwoFactorEnroll)
+				r.Post("/enable", s.handleTwoFactorEnable)
+				r.Post("/disable", s.handleTwoFactorDisable)
+				r.Post("/recovery-codes", s.handleRegenerateRecoveryCodes)
+			})
+
+			r.Route("/tokens", func(r chi.Router) {
+				r.Use(requireSession)
+				r.Get("/", s.handleListAPITokens)
+				r.Post("/", s.handleCreateAPIToken)
+				r.Delete("/{tokenID}", s.handleRevokeAPIToken)
+			})
 
 			r.Route("/admin", func(r chi.Router) {
 				r.Use(s.requireInstanceAdminMiddleware)
@@ -92,14 +140,18 @@ func NewServer(cfg *config.Config, store *db.Store) (*Server, error) {
 				r.Post("/self-update", s.handleAdminSelfUpdate)
 				r.Get("/jobs/{jobID}", s.handleAdminGetJob)
 				r.Get("/jobs/{jobID}/logs", s.handleAdminGetJobLogs)
+				r.Post("/users/{userID}/sign-out", s.handleAdminSignOutUser)
+				r.Post("/users/{userID}/unlock", s.handleAdminUnlockUser)
+				r.Get("/audit-events", s.handleAdminListAuditEvents)
 			})
 
 			r.Get("/orgs", s.handleListOrgs)
-			r.Post("/orgs", s.handleCreateOrg)
 			r.Get("/orgs/{orgID}", s.handleGetOrg)
 			r.Get("/orgs/{orgID}/members", s.handleListOrgMembers)
 			r.Post("/orgs/{orgID}/members", s.handleAddOrgMember)
 			r.Delete("/orgs/{orgID}/members/{userID}", s.handleRemoveOrgMember)
+			r.With(requireSession).Get("/orgs/{orgID}/tokens", s.handleListOrgAPITokens)
+			r.With(requireSession).Put("/orgs/{orgID}/security", s.handleUpdateOrgSecurity)
 
 			r.Post("/orgs/{orgID}/projects", s.handleCreateProjectInOrg)
 			r.Post("/orgs/{orgID}/projects/import", s.handleImportProjectInOrg)
@@ -113,10 +165,22 @@ func NewServer(cfg *config.Config, store *db.Store) (*Server, error) {
 			r.Post("/projects/{id}/env", s.handleSetEnvVar)
 			r.Get("/projects/{id}/env", s.handleListEnvVars)
 			r.Get("/projects/{id}/deployments", s.handleListDeployments)
+			r.Get("/projects/{id}/activity", s.handleProjectActivity)
+			r.Post("/projects/{id}/rollback", s.handleRollback)
+			r.Get("/projects/{id}/settings", s.handleGetProjectSettings)
+			r.Put("/projects/{id}/settings", s.handleUpdateProjectSettings)
+			r.Get("/projects/{id}/domains", s.handleListDomains)
+			r.Post("/projects/{id}/domains", s.handleAddDomain)
+			r.Put("/projects/{id}/domains/{domainID}", s.handleUpdateDomain)
+			r.Post("/projects/{id}/domains/{domainID}/verify", s.handleVerifyDomain)
+			r.Delete("/projects/{id}/domains/{domainID}", s.handleDeleteDomain)
 
 			r.Get("/deployments/{id}", s.handleGetDeployment)
 			r.Post("/deployments/{id}/promote", s.handlePromoteDeployment)
+			r.Post("/deployments/{id}/cancel", s.handleCancelDeployment)
+			r.Post("/deployments/{id}/redeploy", s.handleRedeployDeployment)
 			r.Get("/deployments/{id}/logs", s.handleDeploymentLogsSSE)
+			r.Get("/deployments/{id}/events", s.handleListDeploymentEvents)
 		})
 
 		// GitHub webhooks do not require auth cookie, but must verify signature.
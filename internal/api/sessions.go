@@ -0,0 +1,290 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const sessionTTL = 7 * 24 * time.Hour
+
+const ctxSessionID ctxKey = "session_id"
+
+func sessionIDFromCtx(ctx context.Context) string {
+	v, _ := ctx.Value(ctxSessionID).(string)
+	return v
+}
+
+// jwtKeyID names a signing secret in the "kid" header without revealing it.
+func jwtKeyID(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:4])
+}
+
+// jwtKey returns the secret for kid: the current one or, during a rotation, a
+// previous one.
+func (s *Server) jwtKey(kid string) (string, bool) {
+	if kid == jwtKeyID(s.Cfg.JWTSecret) {
+		return s.Cfg.JWTSecret, true
+	}
+	for _, prev := range s.Cfg.JWTPreviousSecrets {
+		if kid == jwtKeyID(prev) {
+			return prev, true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) signJWT(userID, sessionID string, expires time.Time) (string, error) {
+	claims := jwt.MapClaims{
+		"sub": userID,
+		"jti": sessionID,
+		"exp": expires.Unix(),
+		"iat": time.Now().Unix(),
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t.Header["kid"] = jwtKeyID(s.Cfg.JWTSecret)
+	return t.SignedString([]byte(s.Cfg.JWTSecret))
+}
+
+// sessionToken is a verified session cookie.
+type sessionToken struct {
+	UserID    string
+	SessionID string
+	Expires   time.Time
+	// IssuedAt is zero if the token has no iat.
+	IssuedAt time.Time
+	// Stale tokens are signed with a previous secret, or predate sessions,
+	// and should be re-issued.
+	Stale bool
+}
+
+func (s *Server) parseJWT(tokenStr string) (*sessionToken, error) {
+	kid := ""
+	tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ = t.Header["kid"].(string)
+		if kid == "" {
+			// Cookies from before key ids were signed with the secret of
+			// their day, which may since have been rotated out.
+			keys := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{[]byte(s.Cfg.JWTSecret)}}
+			for _, prev := range s.Cfg.JWTPreviousSecrets {
+				keys.Keys = append(keys.Keys, []byte(prev))
+			}
+			return keys, nil
+		}
+		secret, ok := s.jwtKey(kid)
+		if !ok {
+			return nil, errors.New("unknown key id")
+		}
+		return []byte(secret), nil
+	})
+	if err != nil || tok == nil || !tok.Valid {
+		return nil, errors.New("invalid token")
+	}
+	claims, ok := tok.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid claims")
+	}
+	st := &sessionToken{}
+	st.UserID, _ = claims["sub"].(string)
+	st.SessionID, _ = claims["jti"].(string)
+	if st.UserID == "" {
+		return nil, errors.New("missing sub")
+	}
+	if _, ok := claims["purpose"]; ok {
+		return nil, errors.New("not a session token")
+	}
+	if st.SessionID == "" && kid != "" {
+		// Only cookies from before sessions, which also predate key ids,
+		// go without a jti.
+		return nil, errors.New("missing jti")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, errors.New("missing exp")
+	}
+	st.Expires = exp.Time
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		st.IssuedAt = iat.Time
+	}
+	st.Stale = kid != jwtKeyID(s.Cfg.JWTSecret) || st.SessionID == ""
+	return st, nil
+}
+
+// verifySession checks a session cookie's signature and that its session is
+// still active.
+func (s *Server) verifySession(ctx context.Context, tokenStr string) (*sessionToken, error) {
+	st, err := s.parseJWT(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if st.SessionID == "" {
+		// A cookie from before sessions: good until it expires or the user's
+		// sessions are revoked. The caller moves it onto a session; the
+		// copy left behind stays usable until then too.
+		revokedAt, err := s.Store.GetSessionsRevokedAt(ctx, st.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if revokedAt.Valid && st.IssuedAt.Before(revokedAt.Time) {
+			return nil, errors.New("session ended")
+		}
+		return st, nil
+	}
+	ss, err := s.Store.GetSession(ctx, st.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if ss == nil || ss.UserID != st.UserID || ss.RevokedAt.Valid || !time.Now().Before(ss.ExpiresAt) {
+		return nil, errors.New("session ended")
+	}
+	_ = s.Store.TouchSession(ctx, ss.ID)
+	return st, nil
+}
+
+// startSession records a new session for userID and sets its cookie.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, userID string) error {
+	expires := time.Now().Add(sessionTTL)
+	ss, err := s.Store.CreateSession(r.Context(), userID, r.UserAgent(), clientIP(r), expires)
+	if err != nil {
+		return err
+	}
+	return s.setSessionCookie(w, r, userID, ss.ID, expires)
+}
+
+func (s *Server) setSessionCookie(w http.ResponseWriter, r *http.Request, userID, sessionID string, expires time.Time) error {
+	tok, err := s.signJWT(userID, sessionID, expires)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    tok,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		// Secure should be true for HTTPS, including behind a reverse proxy.
+		Secure:  isHTTPS(r),
+		Expires: expires,
+	})
+	return nil
+}
+
+func clientIP(r *http.Request) string {
+	// realIP leaves a bare IP when a trusted proxy forwarded the request.
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+type sessionResp struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	ss, err := s.Store.ListActiveSessions(r.Context(), userIDFromCtx(r.Context()))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	cur := sessionIDFromCtx(r.Context())
+	out := make([]sessionResp, 0, len(ss))
+	for _, x := range ss {
+		out = append(out, sessionResp{
+			ID:         x.ID,
+			UserAgent:  x.UserAgent,
+			IP:         x.IP,
+			CreatedAt:  x.CreatedAt,
+			LastSeenAt: x.LastSeenAt,
+			ExpiresAt:  x.ExpiresAt,
+			Current:    x.ID == cur,
+		})
+	}
+	writeJSON(w, 200, out)
+}
+
+// handleRevokeSession signs one of the caller's sessions out.
+func (s *Server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	ss, err := s.Store.GetSession(r.Context(), chiURLParam(r, "sessionID"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if ss == nil || ss.UserID != userIDFromCtx(r.Context()) {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return
+	}
+	if err := s.Store.RevokeSession(r.Context(), ss.ID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// handleRevokeOtherSessions signs the caller out everywhere but here.
+func (s *Server) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	n, err := s.Store.RevokeUserSessions(r.Context(), userIDFromCtx(r.Context()), sessionIDFromCtx(r.Context()))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "revoked": n})
+}
+
+// handleAdminSignOutUser ends all of a user's sessions and revokes their API
+// tokens, e.g. after a suspected compromise.
+func (s *Server) handleAdminSignOutUser(w http.ResponseWriter, r *http.Request) {
+	u, err := s.Store.GetUserByID(r.Context(), chiURLParam(r, "userID"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if u == nil {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return
+	}
+	n, err := s.Store.RevokeUserSessions(r.Context(), u.ID, "")
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	nt, err := s.Store.RevokeUserAPITokens(r.Context(), u.ID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "revoked": n, "revoked_tokens": nt})
+}
+
+// revokeCookieSession ends the session of the request's cookie, if any.
+func (s *Server) revokeCookieSession(r *http.Request) {
+	c, err := r.Cookie(authCookieName)
+	if err != nil || c.Value == "" {
+		return
+	}
+	st, err := s.parseJWT(c.Value)
+	if err != nil {
+		return
+	}
+	if st.SessionID != "" {
+		_ = s.Store.RevokeSession(r.Context(), st.SessionID)
+	} else {
+		_ = s.Store.RevokeLegacySessions(r.Context(), st.UserID)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/opencel/opencel/internal/config"
+)
+
+func TestParseJWTKeyRotation(t *testing.T) {
+	old := &Server{Cfg: &config.Config{JWTSecret: "old-secret"}}
+	tok, err := old.signJWT("user-1", "session-1", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, err := old.parseJWT(tok); err != nil || st.Stale || st.UserID != "user-1" || st.SessionID != "session-1" {
+		t.Fatalf("before rotation: %+v %v", st, err)
+	}
+
+	rotated := &Server{Cfg: &config.Config{JWTSecret: "new-secret", JWTPreviousSecrets: []string{"old-secret"}}}
+	st, err := rotated.parseJWT(tok)
+	if err != nil || !st.Stale {
+		t.Fatalf("during rotation: %+v %v", st, err)
+	}
+
+	dropped := &Server{Cfg: &config.Config{JWTSecret: "new-secret"}}
+	if _, err := dropped.parseJWT(tok); err == nil {
+		t.Fatal("token of a dropped secret accepted")
+	}
+}
+
+func TestParseJWTAcceptsLegacyCookie(t *testing.T) {
+	s := &Server{Cfg: &config.Config{JWTSecret: "new-secret", JWTPreviousSecrets: []string{"secret"}}}
+	sign := func(claims jwt.MapClaims, secret string) string {
+		t.Helper()
+		// A cookie from before sessions: no jti, no kid.
+		tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	exp := time.Now().Add(time.Hour)
+	st, err := s.parseJWT(sign(jwt.MapClaims{"sub": "user-1", "exp": exp.Unix()}, "secret"))
+	if err != nil || st.UserID != "user-1" || st.SessionID != "" || !st.Stale || st.Expires.Unix() != exp.Unix() {
+		t.Fatalf("legacy cookie: %+v %v", st, err)
+	}
+	if _, err := s.parseJWT(sign(jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(-time.Minute).Unix()}, "secret")); err == nil {
+		t.Fatal("expired legacy cookie accepted")
+	}
+	if _, err := s.parseJWT(sign(jwt.MapClaims{"sub": "user-1", "exp": exp.Unix()}, "other")); err == nil {
+		t.Fatal("legacy cookie with an unknown secret accepted")
+	}
+	if _, err := s.parseJWT(sign(jwt.MapClaims{"exp": exp.Unix()}, "secret")); err == nil {
+		t.Fatal("cookie without sub accepted")
+	}
+	withKid := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1", "exp": exp.Unix()})
+	withKid.Header["kid"] = jwtKeyID("new-secret")
+	tok, err := withKid.SignedString([]byte("new-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.parseJWT(tok); err == nil {
+		t.Fatal("token with kid but without jti accepted")
+	}
+}
+
+// legacyCookie returns a cookie from before sessions for userID, issued a
+// minute ago.
+func legacyCookie(t *testing.T, s *Server, userID string) *http.Cookie {
+	t.Helper()
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": userID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Add(-time.Minute).Unix(),
+	}).SignedString([]byte(s.Cfg.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: authCookieName, Value: tok}
+}
+
+func TestAdminSignOutEndsLegacyCookie(t *testing.T) {
+	s := newTestServer(t)
+	admin, adminCookie := newTestUser(t, s, "")
+	if err := s.Store.SetInstanceAdmin(context.Background(), admin.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := newTestUser(t, s, "")
+	legacy := legacyCookie(t, s, u.ID)
+	if rec := serve(s, "GET", "/api/me", "", legacy); rec.Code != 200 {
+		t.Fatalf("legacy cookie before sign-out: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(s, "POST", "/api/admin/users/"+u.ID+"/sign-out", "", adminCookie); rec.Code != 200 {
+		t.Fatalf("sign-out: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(s, "GET", "/api/me", "", legacy); rec.Code != 401 {
+		t.Fatalf("legacy cookie after sign-out: %d, want 401", rec.Code)
+	}
+}
+
+func TestLogoutEndsLegacyCookieCopies(t *testing.T) {
+	s := newTestServer(t)
+	u, _ := newTestUser(t, s, "")
+	legacy := legacyCookie(t, s, u.ID)
+	// The first use moves the cookie onto a session; a stolen copy of the
+	// old one must not outlive signing out of it.
+	rec := serve(s, "GET", "/api/me", "", legacy)
+	migrated := responseCookie(rec, authCookieName)
+	if rec.Code != 200 || migrated == nil {
+		t.Fatalf("legacy cookie: %d, cookie %v", rec.Code, migrated)
+	}
+	if rec := serve(s, "POST", "/api/auth/logout", "", migrated); rec.Code != 200 {
+		t.Fatalf("logout: %d %s", rec.Code, rec.Body)
+	}
+	if rec := serve(s, "GET", "/api/me", "", legacy); rec.Code != 401 {
+		t.Fatalf("legacy cookie after logout: %d, want 401", rec.Code)
+	}
+}
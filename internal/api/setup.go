@@ -150,20 +150,10 @@ func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Log in immediately.
-	tok, err := s.signJWT(userID)
-	if err != nil {
+	if err := s.startSession(w, r, userID); err != nil {
 		writeJSON(w, 500, map[string]any{"error": "token error"})
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     authCookieName,
-		Value:    tok,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		Secure:   isHTTPS(r),
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-	})
 
 	writeJSON(w, 201, setupResp{
 		OK:    true,
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencel/opencel/internal/config"
+	"github.com/opencel/opencel/internal/crypto/envcrypt"
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/totp"
+)
+
+// newTestServer runs the migrations against OPENCEL_TEST_DSN and returns a
+// server on that database. Tests using it are skipped without a database.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	dsn := os.Getenv("OPENCEL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("OPENCEL_TEST_DSN not set")
+	}
+	t.Setenv("OPENCEL_MIGRATIONS_DIR", "../../migrations")
+	if err := RunMigrations(dsn); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.Open(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	redisAddr := os.Getenv("OPENCEL_TEST_REDIS_ADDR")
+	if redisAddr == "" {
+		// Nothing listens here; rate limits fail open.
+		redisAddr = "127.0.0.1:1"
+	}
+	cfg := &config.Config{
+		DSN:        dsn,
+		RedisAddr:  redisAddr,
+		BaseDomain: "opencel.test",
+		JWTSecret:  "test-secret",
+		EncryptKey: make([]byte, 32),
+	}
+	s, err := NewServer(cfg, db.NewStore(sqlDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = s.Queue.Close()
+		_ = s.Inspector.Close()
+	})
+	return s
+}
+
+// requireTestRedis skips tests that need working rate limits and lockouts.
+func requireTestRedis(t *testing.T) {
+	t.Helper()
+	if os.Getenv("OPENCEL_TEST_REDIS_ADDR") == "" {
+		t.Skip("OPENCEL_TEST_REDIS_ADDR not set")
+	}
+}
+
+var testSeq atomic.Int64
+
+// testName returns a name that is unique across test runs on one database.
+func testName(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), testSeq.Add(1))
+}
+
+// newTestUser creates a user and returns it with a signed-in session cookie.
+func newTestUser(t *testing.T, s *Server, passwordHash string) (*db.User, *http.Cookie) {
+	t.Helper()
+	ctx := context.Background()
+	u, err := s.Store.CreateUser(ctx, testName("user")+"@example.com", passwordHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour)
+	sess, err := s.Store.CreateSession(ctx, u.ID, "test", "127.0.0.1", expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := s.signJWT(u.ID, sess.ID, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, &http.Cookie{Name: authCookieName, Value: tok}
+}
+
+// testIP returns a client address of its own, so per-IP limits left over
+// from earlier runs do not interfere.
+func testIP() string {
+	return fmt.Sprintf("2001:db8::%x:%x", time.Now().UnixNano()&0xffff, testSeq.Add(1)&0xffff)
+}
+
+// serve runs a request through the server's router.
+func serve(s *Server, method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	return serveFrom(s, "", method, path, body, cookie)
+}
+
+// serveFrom is serve for a request from the client address ip.
+func serveFrom(s *Server, ip, method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if ip != "" {
+		req.RemoteAddr = net.JoinHostPort(ip, "1234")
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	s.Router.ServeHTTP(rec, req)
+	return rec
+}
+
+// enableTestTOTP turns on two-factor authentication for userID and returns
+// the secret, for totp.Code.
+func enableTestTOTP(t *testing.T, s *Server, userID string) string {
+	t.Helper()
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := envcrypt.Encrypt(s.Cfg.EncryptKey, []byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := s.Store.SetPendingUserTOTP(ctx, userID, enc); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.EnableUserTOTP(ctx, userID, 0); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// responseCookie returns the cookie name set by rec, or nil.
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opencel/opencel/internal/db"
+)
+
+// apiTokenPrefix marks OpenCel API tokens, so they are easy to recognize in
+// configs and for secret scanners.
+const apiTokenPrefix = "ocl_"
+
+// API token scopes. write implies read; admin opens the instance admin API
+// (for tokens of instance admins).
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+	scopeAdmin = "admin"
+)
+
+var tokenScopes = []string{scopeRead, scopeWrite, scopeAdmin}
+
+const ctxAPIToken ctxKey = "api_token"
+
+// apiTokenFromCtx returns the token the request authenticated with, or nil
+// for cookie sessions.
+func apiTokenFromCtx(ctx context.Context) *db.APIToken {
+	t, _ := ctx.Value(ctxAPIToken).(*db.APIToken)
+	return t
+}
+
+func hashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// bearerAPIToken returns the API token in the Authorization header, if any.
+func bearerAPIToken(r *http.Request) (string, bool) {
+	v := r.Header.Get("Authorization")
+	if len(v) < 7 || !strings.EqualFold(v[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(v[7:]), true
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope || (s == scopeWrite && scope == scopeRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeForMethod is the scope a token needs for a request method.
+func scopeForMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return scopeRead
+	}
+	return scopeWrite
+}
+
+// authenticateAPIToken checks token and returns it, with the error response to
+// send if it is not usable.
+func (s *Server) authenticateAPIToken(ctx context.Context, token string) (*db.APIToken, *httpErr) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, &httpErr{status: 401, msg: "unauthorized"}
+	}
+	t, err := s.Store.GetAPITokenByHash(ctx, hashAPIToken(token))
+	if err != nil {
+		return nil, &httpErr{status: 500, msg: err.Error()}
+	}
+	if t == nil || t.RevokedAt.Valid {
+		return nil, &httpErr{status: 401, msg: "unauthorized"}
+	}
+	if t.ExpiresAt.Valid && !time.Now().Before(t.ExpiresAt.Time) {
+		return nil, &httpErr{status: 401, msg: "token expired"}
+	}
+	_ = s.Store.TouchAPIToken(ctx, t.ID)
+	return t, nil
+}
+
+// orgAllowed reports whether the request's credentials may act in orgID:
+// org tokens are limited to their org, everything else to the user's roles.
+func orgAllowed(ctx context.Context, orgID string) bool {
+	t := apiTokenFromCtx(ctx)
+	return t == nil || !t.OrgID.Valid || t.OrgID.String == orgID
+}
+
+// requireSession rejects API tokens, for routes only a signed-in user should
+// reach, like minting more tokens.
+func requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiTokenFromCtx(r.Context()) != nil {
+			writeJSON(w, 403, map[string]any{"error": "not available to API tokens"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// denyOrgTokens rejects org tokens on routes that act on the user rather than
+// an org.
+func denyOrgTokens(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t := apiTokenFromCtx(r.Context()); t != nil && t.OrgID.Valid {
+			writeJSON(w, 403, map[string]any{"error": "not available to org tokens"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type apiTokenResp struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	OrgID      *string    `json:"org_id,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Token is only returned when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+func toAPITokenResp(t *db.APIToken) apiTokenResp {
+	out := apiTokenResp{
+		ID:        t.ID,
+		Name:      t.Name,
+		Prefix:    t.TokenPrefix,
+		Scopes:    t.Scopes,
+		CreatedAt: t.CreatedAt,
+	}
+	if out.Scopes == nil {
+		out.Scopes = []string{}
+	}
+	if t.OrgID.Valid {
+		v := t.OrgID.String
+		out.OrgID = &v
+	}
+	out.ExpiresAt = nullTimePtr(t.ExpiresAt)
+	out.LastUsedAt = nullTimePtr(t.LastUsedAt)
+	out.RevokedAt = nullTimePtr(t.RevokedAt)
+	return out
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
+
+func toAPITokenResps(ts []db.APIToken) []apiTokenResp {
+	out := make([]apiTokenResp, 0, len(ts))
+	for i := range ts {
+		out = append(out, toAPITokenResp(&ts[i]))
+	}
+	return out
+}
+
+type createAPITokenReq struct {
+	Name          string   `json:"name"`
+	OrgID         string   `json:"org_id,omitempty"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+// validate normalizes the request and returns a message for the first problem.
+func (req *createAPITokenReq) validate() string {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return "name must be 1 to 100 characters"
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{scopeRead}
+	}
+	seen := map[string]bool{}
+	var scopes []string
+	for _, sc := range req.Scopes {
+		sc = strings.ToLower(strings.TrimSpace(sc))
+		if sc != scopeRead && sc != scopeWrite && sc != scopeAdmin {
+			return "scopes must be among " + strings.Join(tokenScopes, ", ")
+		}
+		if !seen[sc] {
+			seen[sc] = true
+			scopes = append(scopes, sc)
+		}
+	}
+	req.Scopes = scopes
+	if req.OrgID != "" && seen[scopeAdmin] {
+		return "org tokens cannot have the admin scope"
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 3650 {
+		return "expires_in_days must be between 0 (never) and 3650"
+	}
+	return ""
+}
+
+func (s *Server) handleListAPITokens(w http.ResponseWriter, r *http.Request) {
+	ts, err := s.Store.ListAPITokensByUser(r.Context(), userIDFromCtx(r.Context()))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, toAPITokenResps(ts))
+}
+
+// handleCreateAPIToken creates a token and returns it once; only its hash is kept.
+func (s *Server) handleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	uid := userIDFromCtx(r.Context())
+	var req createAPITokenReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		writeJSON(w, 400, map[string]any{"error": msg})
+		return
+	}
+	if req.OrgID != "" {
+		if herr := s.requireOrgRole(r.Context(), uid, req.OrgID, "admin"); herr != nil {
+			writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+			return
+		}
+	}
+	if hasScope(req.Scopes, scopeAdmin) {
+		u, err := s.Store.GetUserByID(r.Context(), uid)
+		if err != nil || u == nil || !u.IsInstanceAdmin {
+			writeJSON(w, 403, map[string]any{"error": "only instance admins can create admin tokens"})
+			return
+		}
+	}
+
+	token := apiTokenPrefix + randB64URL(32)
+	t := db.APIToken{
+		UserID:      uid,
+		OrgID:       sql.NullString{String: req.OrgID, Valid: req.OrgID != ""},
+		Name:        req.Name,
+		TokenHash:   hashAPIToken(token),
+		TokenPrefix: token[:len(apiTokenPrefix)+6],
+		Scopes:      req.Scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		t.ExpiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+	created, err := s.Store.CreateAPIToken(r.Context(), t)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	resp := toAPITokenResp(created)
+	resp.Token = token
+	writeJSON(w, 201, resp)
+}
+
+// handleRevokeAPIToken revokes one of the caller's tokens, or an org token of
+// an org the caller administers.
+func (s *Server) handleRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	uid := userIDFromCtx(r.Context())
+	t, err := s.Store.GetAPIToken(r.Context(), chiURLParam(r, "tokenID"))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if t == nil {
+		writeJSON(w, 404, map[string]any{"error": "not found"})
+		return
+	}
+	if t.UserID != uid {
+		if !t.OrgID.Valid {
+			writeJSON(w, 404, map[string]any{"error": "not found"})
+			return
+		}
+		if herr := s.requireOrgRole(r.Context(), uid, t.OrgID.String, "admin"); herr != nil {
+			writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+			return
+		}
+	}
+	if err := s.Store.RevokeAPIToken(r.Context(), t.ID); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// handleListOrgAPITokens lists every token limited to the org, whoever made it.
+func (s *Server) handleListOrgAPITokens(w http.ResponseWriter, r *http.Request) {
+	orgID := chiURLParam(r, "orgID")
+	if herr := s.requireOrgRole(r.Context(), userIDFromCtx(r.Context()), orgID, "admin"); herr != nil {
+		writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+		return
+	}
+	ts, err := s.Store.ListAPITokensByOrg(r.Context(), orgID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, toAPITokenResps(ts))
+}
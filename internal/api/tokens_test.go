@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTokenScopes(t *testing.T) {
+	for _, tc := range []struct {
+		scopes []string
+		method string
+		want   bool
+	}{
+		{[]string{"read"}, "GET", true},
+		{[]string{"read"}, "POST", false},
+		{[]string{"write"}, "GET", true},
+		{[]string{"write"}, "DELETE", true},
+		{[]string{"admin"}, "GET", false},
+		{nil, "GET", false},
+	} {
+		if got := hasScope(tc.scopes, scopeForMethod(tc.method)); got != tc.want {
+			t.Errorf("%v %s: got %v, want %v", tc.scopes, tc.method, got, tc.want)
+		}
+	}
+}
+
+func TestCreateAPITokenReqValidate(t *testing.T) {
+	req := createAPITokenReq{Name: " ci ", Scopes: []string{"Write", "write", "read"}}
+	if msg := req.validate(); msg != "" {
+		t.Fatal(msg)
+	}
+	if req.Name != "ci" || !reflect.DeepEqual(req.Scopes, []string{"write", "read"}) {
+		t.Fatalf("not normalized: %+v", req)
+	}
+
+	req = createAPITokenReq{Name: "ci"}
+	if msg := req.validate(); msg != "" || !reflect.DeepEqual(req.Scopes, []string{"read"}) {
+		t.Fatalf("default scopes: %q %v", msg, req.Scopes)
+	}
+
+	for _, bad := range []createAPITokenReq{
+		{Name: ""},
+		{Name: "ci", Scopes: []string{"deploy"}},
+		{Name: "ci", OrgID: "org", Scopes: []string{"admin"}},
+		{Name: "ci", ExpiresInDays: -1},
+	} {
+		if msg := bad.validate(); msg == "" {
+			t.Errorf("%+v: accepted", bad)
+		}
+	}
+}
+
+func TestBearerAPIToken(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/me", nil)
+	if _, ok := bearerAPIToken(r); ok {
+		t.Fatal("token without header")
+	}
+	r.Header.Set("Authorization", "bearer ocl_abc")
+	if tok, ok := bearerAPIToken(r); !ok || tok != "ocl_abc" {
+		t.Fatalf("got %q %v", tok, ok)
+	}
+}
@@ -0,0 +1,474 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/opencel/opencel/internal/crypto/envcrypt"
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/totp"
+)
+
+const (
+	totpIssuer        = "OpenCel"
+	recoveryCodeCount = 10
+	// mfaTokenTTL bounds the time between the password and the second step.
+	mfaTokenTTL = 5 * time.Minute
+	// mfaCookie carries the MFA token of a GitHub or OIDC sign-in, which
+	// ends in a redirect rather than a JSON response.
+	mfaCookie = "opencel_mfa"
+)
+
+// signMFAToken issues the token that carries a password login over to the
+// second step. It has no jti, so it is never accepted as a session cookie.
+func (s *Server) signMFAToken(userID string) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":     userID,
+		"purpose": "mfa",
+		"exp":     time.Now().Add(mfaTokenTTL).Unix(),
+		"iat":     time.Now().Unix(),
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	t.Header["kid"] = jwtKeyID(s.Cfg.JWTSecret)
+	return t.SignedString([]byte(s.Cfg.JWTSecret))
+}
+
+func (s *Server) parseMFAToken(tokenStr string) (string, error) {
+	tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ := t.Header["kid"].(string)
+		secret, ok := s.jwtKey(kid)
+		if !ok {
+			return nil, errors.New("unknown key id")
+		}
+		return []byte(secret), nil
+	})
+	if err != nil || tok == nil || !tok.Valid {
+		return "", errors.New("invalid token")
+	}
+	claims, ok := tok.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "mfa" {
+		return "", errors.New("invalid token")
+	}
+	uid, _ := claims["sub"].(string)
+	if uid == "" {
+		return "", errors.New("invalid token")
+	}
+	return uid, nil
+}
+
+// newRecoveryCodes returns fresh codes like "k3j9d-x2mfq" and their hashes.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		c := strings.ToLower(enc.EncodeToString(b))[:10]
+		codes = append(codes, c[:5]+"-"+c[5:])
+		hashes = append(hashes, hashRecoveryCode(c))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a code as typed, ignoring case, dashes and spaces.
+func hashRecoveryCode(code string) string {
+	c := strings.ToLower(code)
+	c = strings.NewReplacer("-", "", " ", "").Replace(c)
+	h := sha256.Sum256([]byte(c))
+	return hex.EncodeToString(h[:])
+}
+
+// isTOTPCode tells authenticator codes from recovery codes.
+func isTOTPCode(code string) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSecondFactor accepts either a current authenticator code or an unused
+// recovery code for an enabled enrollment, and uses it up.
+func (s *Server) checkSecondFactor(ctx context.Context, t *db.UserTOTP, code string) (bool, error) {
+	if !isTOTPCode(code) {
+		return s.Store.UseRecoveryCode(ctx, t.UserID, hashRecoveryCode(code))
+	}
+	secret, err := envcrypt.Decrypt(s.Cfg.EncryptKey, t.SecretEnc)
+	if err != nil {
+		return false, err
+	}
+	counter, ok := totp.Validate(string(secret), code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.Store.UseTOTPCounter(ctx, t.UserID, int64(counter))
+}
+
+// enabledTOTP returns the user's enrollment if two-factor authentication is on.
+func (s *Server) enabledTOTP(ctx context.Context, userID string) (*db.UserTOTP, error) {
+	t, err := s.Store.GetUserTOTP(ctx, userID)
+	if err != nil || t == nil || !t.EnabledAt.Valid {
+		return nil, err
+	}
+	return t, nil
+}
+
+type login2FAReq struct {
+	MFAToken string `json:"mfa_token"`
+	// Code is an authenticator code or a recovery code.
+	Code string `json:"code"`
+}
+
+// handleLogin2FA completes a password login for a user with two-factor
+// authentication on.
+func (s *Server) handleLogin2FA(w http.ResponseWriter, r *http.Request) {
+	var req login2FAReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if req.MFAToken == "" {
+		if c, err := r.Cookie(mfaCookie); err == nil {
+			req.MFAToken = c.Value
+		}
+	}
+	uid, err := s.parseMFAToken(req.MFAToken)
+	if err != nil {
+		clearMFACookie(w, r)
+		writeJSON(w, 401, map[string]any{"error": "login expired, sign in again"})
+		return
+	}
+	t, err := s.enabledTOTP(r.Context(), uid)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if t == nil {
+		clearMFACookie(w, r)
+		writeJSON(w, 401, map[string]any{"error": "login expired, sign in again"})
+		return
+	}
+	key := twoFactorLockoutKey(uid)
+	if s.accountLocked(w, r, key) {
+		return
+	}
+	ok, err := s.checkSecondFactor(r.Context(), t, req.Code)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if !ok {
+		subject := uid
+		if u, err := s.Store.GetUserByID(r.Context(), uid); err == nil && u != nil {
+			subject = u.Email
+		}
+		if !s.authFailed(w, r, key, "2fa", subject) {
+			writeJSON(w, 401, map[string]any{"error": "invalid code"})
+		}
+		return
+	}
+	s.authSucceeded(r, key)
+	if err := s.startSession(w, r, uid); err != nil {
+		writeJSON(w, 500, map[string]any{"error": "token error"})
+		return
+	}
+	clearMFACookie(w, r)
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// startProviderSession signs userID in after a GitHub or OIDC sign-in and
+// returns where to send the browser. Users with two-factor authentication on
+// get an MFA token cookie instead of a session and go to the login page's
+// code step, which returns them to returnTo.
+func (s *Server) startProviderSession(w http.ResponseWriter, r *http.Request, userID, returnTo string) (string, error) {
+	t, err := s.enabledTOTP(r.Context(), userID)
+	if err != nil {
+		return "", err
+	}
+	if t == nil {
+		return returnTo, s.startSession(w, r, userID)
+	}
+	tok, err := s.signMFAToken(userID)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     mfaCookie,
+		Value:    tok,
+		Path:     "/api/auth/login/2fa",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   isHTTPS(r),
+		MaxAge:   int(mfaTokenTTL.Seconds()),
+	})
+	return "/login?mfa=1&return_to=" + url.QueryEscape(returnTo), nil
+}
+
+func clearMFACookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: mfaCookie, Value: "", Path: "/api/auth/login/2fa", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: isHTTPS(r)})
+}
+
+type twoFactorStatusResp struct {
+	Enabled bool `json:"enabled"`
+	// Pending is an enrollment waiting for its first code.
+	Pending                bool `json:"pending"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+	// Required is set when one of the user's orgs requires two-factor
+	// authentication.
+	Required bool `json:"required"`
+}
+
+func (s *Server) handleTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	uid := userIDFromCtx(r.Context())
+	t, err := s.Store.GetUserTOTP(r.Context(), uid)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	var out twoFactorStatusResp
+	if t != nil {
+		out.Enabled = t.EnabledAt.Valid
+		out.Pending = !t.EnabledAt.Valid
+	}
+	if out.RecoveryCodesRemaining, err = s.Store.CountUnusedRecoveryCodes(r.Context(), uid); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if out.Required, err = s.Store.UserOrgsRequire2FA(r.Context(), uid); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, out)
+}
+
+// handleTwoFactorEnroll starts an enrollment: the dashboard shows the URI as a
+// QR code, and the user confirms with a code via handleTwoFactorEnable.
+func (s *Server) handleTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	uid := userIDFromCtx(r.Context())
+	u, err := s.Store.GetUserByID(r.Context(), uid)
+	if err != nil || u == nil {
+		writeJSON(w, 401, map[string]any{"error": "unauthorized"})
+		return
+	}
+	if t, err := s.enabledTOTP(r.Context(), uid); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	} else if t != nil {
+		writeJSON(w, 409, map[string]any{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	enc, err := envcrypt.Encrypt(s.Cfg.EncryptKey, []byte(secret))
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := s.Store.SetPendingUserTOTP(r.Context(), uid, enc); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, map[string]any{
+		"secret":           secret,
+		"provisioning_uri": totp.URI(totpIssuer, u.Email, secret),
+	})
+}
+
+type twoFactorCodeReq struct {
+	Code string `json:"code"`
+}
+
+// handleTwoFactorEnable confirms a pending enrollment and returns the
+// recovery codes, which are not shown again.
+func (s *Server) handleTwoFactorEnable(w http.ResponseWriter, r *http.Request) {
+	uid := userIDFromCtx(r.Context())
+	var req twoFactorCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	t, err := s.Store.GetUserTOTP(r.Context(), uid)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if t == nil {
+		writeJSON(w, 400, map[string]any{"error": "no enrollment in progress"})
+		return
+	}
+	if t.EnabledAt.Valid {
+		writeJSON(w, 409, map[string]any{"error": "two-factor authentication is already enabled"})
+		return
+	}
+	secret, err := envcrypt.Decrypt(s.Cfg.EncryptKey, t.SecretEnc)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	counter, ok := totp.Validate(string(secret), req.Code, time.Now())
+	if !ok {
+		writeJSON(w, 400, map[string]any{"error": "invalid code"})
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := s.Store.ReplaceRecoveryCodes(r.Context(), uid, hashes); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := s.Store.EnableUserTOTP(r.Context(), uid, int64(counter)); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "recovery_codes": codes})
+}
+
+// handleTwoFactorDisable turns two-factor authentication off. It takes a code
+// rather than the password, which users signed up through GitHub never had.
+func (s *Server) handleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	uid := userIDFromCtx(r.Context())
+	var req twoFactorCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	t, err := s.Store.GetUserTOTP(r.Context(), uid)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if t == nil {
+		writeJSON(w, 200, map[string]any{"ok": true})
+		return
+	}
+	if t.EnabledAt.Valid {
+		required, err := s.Store.UserOrgsRequire2FA(r.Context(), uid)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		if required {
+			writeJSON(w, 409, map[string]any{"error": "an organization you belong to requires two-factor authentication"})
+			return
+		}
+		ok, err := s.checkSecondFactor(r.Context(), t, req.Code)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		if !ok {
+			writeJSON(w, 400, map[string]any{"error": "invalid code"})
+			return
+		}
+	}
+	if err := s.Store.DeleteUserTOTP(r.Context(), uid); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true})
+}
+
+// handleRegenerateRecoveryCodes replaces all recovery codes, e.g. after some
+// were used.
+func (s *Server) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	uid := userIDFromCtx(r.Context())
+	var req twoFactorCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	t, err := s.enabledTOTP(r.Context(), uid)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if t == nil {
+		writeJSON(w, 400, map[string]any{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if !isTOTPCode(req.Code) {
+		writeJSON(w, 400, map[string]any{"error": "enter a code from your authenticator app"})
+		return
+	}
+	ok, err := s.checkSecondFactor(r.Context(), t, req.Code)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if !ok {
+		writeJSON(w, 400, map[string]any{"error": "invalid code"})
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if err := s.Store.ReplaceRecoveryCodes(r.Context(), uid, hashes); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "recovery_codes": codes})
+}
+
+type orgSecurityReq struct {
+	Require2FA bool `json:"require_2fa"`
+}
+
+// handleUpdateOrgSecurity lets owners require two-factor authentication of all
+// members. Members without it lose access to the org until they enroll.
+func (s *Server) handleUpdateOrgSecurity(w http.ResponseWriter, r *http.Request) {
+	uid := userIDFromCtx(r.Context())
+	orgID := chiURLParam(r, "orgID")
+	var req orgSecurityReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid json"})
+		return
+	}
+	if herr := s.requireOrgRole(r.Context(), uid, orgID, "owner"); herr != nil {
+		writeJSON(w, herr.status, map[string]any{"error": herr.msg})
+		return
+	}
+	if req.Require2FA {
+		// Owners cannot lock themselves out.
+		t, err := s.enabledTOTP(r.Context(), uid)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		if t == nil {
+			writeJSON(w, 400, map[string]any{"error": "enable two-factor authentication for yourself first"})
+			return
+		}
+	}
+	if err := s.Store.SetOrgRequire2FA(r.Context(), orgID, req.Require2FA); err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	writeJSON(w, 200, map[string]any{"ok": true, "require_2fa": req.Require2FA})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencel/opencel/internal/config"
+)
+
+func TestMFATokenIsNotASession(t *testing.T) {
+	s := &Server{Cfg: &config.Config{JWTSecret: "secret"}}
+	tok, err := s.signMFAToken("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid, err := s.parseMFAToken(tok); err != nil || uid != "user-1" {
+		t.Fatalf("parseMFAToken = %q %v", uid, err)
+	}
+	if _, err := s.parseJWT(tok); err == nil {
+		t.Fatal("MFA token accepted as a session cookie")
+	}
+	session, err := s.signJWT("user-1", "session-1", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.parseMFAToken(session); err == nil {
+		t.Fatal("session cookie accepted as an MFA token")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes, %d hashes", len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, c := range codes {
+		if len(c) != 11 || c[5] != '-' || isTOTPCode(c) {
+			t.Errorf("malformed code %q", c)
+		}
+		// Typed back with other casing and without the dash.
+		if hashRecoveryCode(strings.ToUpper(strings.ReplaceAll(c, "-", ""))) != hashes[i] {
+			t.Errorf("hash of %q does not match", c)
+		}
+		if seen[c] {
+			t.Errorf("duplicate code %q", c)
+		}
+		seen[c] = true
+	}
+}
+
+func TestIsTOTPCode(t *testing.T) {
+	for code, want := range map[string]bool{
+		"123456":      true,
+		" 123 456 ":   true,
+		"12345":       false,
+		"12345a":      false,
+		"abcde-fghij": false,
+	} {
+		if got := isTOTPCode(code); got != want {
+			t.Errorf("isTOTPCode(%q) = %v", code, got)
+		}
+	}
+}
+
+func TestListProjectsEnforcesOrg2FA(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	u, cookie := newTestUser(t, s, "")
+	org, err := s.Store.CreateOrganization(ctx, testName("org"), "Strict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store.AddOrgMember(ctx, org.ID, u.ID, "member"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Store.CreateProject(ctx, org.ID, testName("proj"), testName("acme/repo"), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(s, "GET", "/api/projects", "", cookie); rec.Code != 200 {
+		t.Fatalf("without the requirement: got %d %s", rec.Code, rec.Body)
+	}
+	if err := s.Store.SetOrgRequire2FA(ctx, org.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(s, "GET", "/api/projects", "", cookie); rec.Code != 403 {
+		t.Fatalf("without a second factor: got %d %s", rec.Code, rec.Body)
+	}
+	enableTestTOTP(t, s, u.ID)
+	if rec := serve(s, "GET", "/api/projects", "", cookie); rec.Code != 200 {
+		t.Fatalf("with a second factor: got %d %s", rec.Code, rec.Body)
+	}
+}
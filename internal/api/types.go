@@ -46,19 +46,39 @@ func toProjectResp(p *db.Project) projectResp {
 }
 
 type deploymentResp struct {
-	ID            string     `json:"id"`
-	ProjectID     string     `json:"project_id"`
-	GitSHA        string     `json:"git_sha"`
-	GitRef        string     `json:"git_ref"`
-	Type          string     `json:"type"`
-	Status        string     `json:"status"`
-	ImageRef      *string    `json:"image_ref,omitempty"`
-	ContainerName *string    `json:"container_name,omitempty"`
-	ServicePort   int        `json:"service_port"`
-	PreviewURL    *string    `json:"preview_url,omitempty"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
-	PromotedAt    *time.Time `json:"promoted_at,omitempty"`
+	ID            string          `json:"id"`
+	ProjectID     string          `json:"project_id"`
+	GitSHA        string          `json:"git_sha"`
+	GitRef        string          `json:"git_ref"`
+	Type          string          `json:"type"`
+	Status        string          `json:"status"`
+	ImageRef      *string         `json:"image_ref,omitempty"`
+	ContainerName *string         `json:"container_name,omitempty"`
+	ServicePort   int             `json:"service_port"`
+	PreviewURL    *string         `json:"preview_url,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	PromotedAt    *time.Time      `json:"promoted_at,omitempty"`
+	PRNumber      *int            `json:"pr_number,omitempty"`
+	BuildCache    *buildCacheResp `json:"build_cache,omitempty"`
+	Commit        *commitResp     `json:"commit,omitempty"`
+}
+
+type buildCacheResp struct {
+	Steps       int `json:"steps"`
+	CachedSteps int `json:"cached_steps"`
+}
+
+type commitResp struct {
+	Message string `json:"message"`
+	Author  string `json:"author,omitempty"`
+}
+
+func toCommitResp(d *db.Deployment) *commitResp {
+	if !d.CommitMessage.Valid {
+		return nil
+	}
+	return &commitResp{Message: d.CommitMessage.String, Author: d.CommitAuthor.String}
 }
 
 func toDeploymentResp(d *db.Deployment) deploymentResp {
@@ -82,6 +102,15 @@ func toDeploymentResp(d *db.Deployment) deploymentResp {
 		v := d.PromotedAt.Time
 		pr = &v
 	}
+	var prn *int
+	if d.PRNumber.Valid {
+		v := int(d.PRNumber.Int64)
+		prn = &v
+	}
+	var bc *buildCacheResp
+	if d.BuildSteps.Valid {
+		bc = &buildCacheResp{Steps: int(d.BuildSteps.Int64), CachedSteps: int(d.BuildCachedSteps.Int64)}
+	}
 	return deploymentResp{
 		ID:            d.ID,
 		ProjectID:     d.ProjectID,
@@ -96,6 +125,85 @@ func toDeploymentResp(d *db.Deployment) deploymentResp {
 		CreatedAt:     d.CreatedAt,
 		UpdatedAt:     d.UpdatedAt,
 		PromotedAt:    pr,
+		PRNumber:      prn,
+		BuildCache:    bc,
+		Commit:        toCommitResp(d),
+	}
+}
+
+type actorResp struct {
+	ID    string `json:"id"`
+	Email string `json:"email,omitempty"`
+}
+
+// deploymentEventResp is a timeline entry. Metadata depends on the type:
+// status changes carry the phase they end and its duration_ms, FAILED events
+// a category, READY events the source_ms, build_ms and start_ms of a build.
+type deploymentEventResp struct {
+	ID           string         `json:"id"`
+	DeploymentID string         `json:"deployment_id"`
+	At           time.Time      `json:"at"`
+	Type         string         `json:"type"`
+	Message      string         `json:"message"`
+	Actor        *actorResp     `json:"actor,omitempty"`
+	Metadata     map[string]any `json:"metadata"`
+}
+
+func toDeploymentEventResp(e *db.DeploymentEvent) deploymentEventResp {
+	var actor *actorResp
+	if e.ActorUserID.Valid {
+		actor = &actorResp{ID: e.ActorUserID.String, Email: e.ActorEmail.String}
+	}
+	meta := e.Metadata
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	return deploymentEventResp{
+		ID:           e.ID,
+		DeploymentID: e.DeploymentID,
+		At:           e.At,
+		Type:         e.Type,
+		Message:      e.Message,
+		Actor:        actor,
+		Metadata:     meta,
+	}
+}
+
+// activityResp is an event in the project activity feed, with enough of its
+// deployment to render the entry.
+type activityResp struct {
+	deploymentEventResp
+	Deployment activityDeploymentResp `json:"deployment"`
+}
+
+type activityDeploymentResp struct {
+	ID       string      `json:"id"`
+	GitSHA   string      `json:"git_sha"`
+	GitRef   string      `json:"git_ref"`
+	Type     string      `json:"type"`
+	Status   string      `json:"status"`
+	PRNumber *int        `json:"pr_number,omitempty"`
+	Commit   *commitResp `json:"commit,omitempty"`
+}
+
+func toActivityResp(e *db.ProjectEvent) activityResp {
+	d := &e.Deployment
+	var prn *int
+	if d.PRNumber.Valid {
+		v := int(d.PRNumber.Int64)
+		prn = &v
+	}
+	return activityResp{
+		deploymentEventResp: toDeploymentEventResp(&e.DeploymentEvent),
+		Deployment: activityDeploymentResp{
+			ID:       d.ID,
+			GitSHA:   d.GitSHA,
+			GitRef:   d.GitRef,
+			Type:     d.Type,
+			Status:   d.Status,
+			PRNumber: prn,
+			Commit:   toCommitResp(d),
+		},
 	}
 }
 
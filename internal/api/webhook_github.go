@@ -2,17 +2,47 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/hibiken/asynq"
 	"github.com/opencel/opencel/internal/github"
 	"github.com/opencel/opencel/internal/queue"
+	"github.com/opencel/opencel/internal/settings"
 )
 
 type ghPushPayload struct {
 	Ref        string `json:"ref"`   // refs/heads/main
 	After      string `json:"after"` // sha
+	HeadCommit *struct {
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"head_commit"`
+	Repository struct {
+		FullName      string `json:"full_name"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+	Installation struct {
+		ID int64 `json:"id"`
+	} `json:"installation"`
+}
+
+type ghPullRequestPayload struct {
+	Action      string `json:"action"` // opened | synchronize | reopened | closed | ...
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			SHA string `json:"sha"`
+			Ref string `json:"ref"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
 	Repository struct {
 		FullName      string `json:"full_name"`
 		DefaultBranch string `json:"default_branch"`
@@ -45,6 +75,8 @@ func (s *Server) handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
 	switch ev {
 	case "push":
 		s.handleGitHubPush(w, r, body)
+	case "pull_request":
+		s.handleGitHubPullRequest(w, r, body)
 	default:
 		// ignore
 		writeJSON(w, 200, map[string]any{"ok": true})
@@ -77,22 +109,104 @@ func (s *Server) handleGitHubPush(w http.ResponseWriter, r *http.Request, body [
 	}
 
 	branch := strings.TrimPrefix(p.Ref, "refs/heads/")
+	ps, err := settings.LoadProject(r.Context(), s.Store, project.ID)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if !ps.BranchAllowed(branch) {
+		writeJSON(w, 200, map[string]any{"ok": true, "ignored": true, "reason": "branch not in project branch filter"})
+		return
+	}
+
 	typ := "preview"
 	if p.Repository.DefaultBranch != "" && branch == p.Repository.DefaultBranch {
 		typ = "production"
 	}
 
-	dep, err := s.Store.CreateDeployment(r.Context(), project.ID, p.After, p.Ref, typ)
+	dep, err := s.Store.CreateDeployment(r.Context(), project.ID, p.After, p.Ref, typ, nil)
 	if err != nil {
 		writeJSON(w, 500, map[string]any{"error": err.Error()})
 		return
 	}
+	if p.HeadCommit != nil {
+		_ = s.Store.SetDeploymentCommit(r.Context(), dep.ID, p.HeadCommit.Message, p.HeadCommit.Author.Name)
+	}
 	_ = s.Store.AddDeploymentEvent(r.Context(), dep.ID, "QUEUED", "Deployment queued from GitHub push")
 
-	task := asynq.NewTask(queue.TaskBuildDeploy, queue.MustJSON(queue.BuildDeployPayload{DeploymentID: dep.ID}))
-	if _, err := s.Queue.Enqueue(task); err != nil {
+	if err := s.enqueueBuild(dep.ID); err != nil {
 		writeJSON(w, 500, map[string]any{"error": err.Error()})
 		return
 	}
+	s.cancelSupersededBuilds(r.Context(), dep)
 	writeJSON(w, 200, map[string]any{"ok": true, "deployment_id": dep.ID})
 }
+
+func (s *Server) handleGitHubPullRequest(w http.ResponseWriter, r *http.Request, body []byte) {
+	var p ghPullRequestPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		writeJSON(w, 400, map[string]any{"error": "invalid payload"})
+		return
+	}
+	repoFull := p.Repository.FullName
+	if repoFull == "" || p.Number <= 0 {
+		writeJSON(w, 400, map[string]any{"error": "missing fields"})
+		return
+	}
+
+	project, err := s.Store.GetProjectByRepoFullName(r.Context(), repoFull)
+	if err != nil {
+		writeJSON(w, 500, map[string]any{"error": err.Error()})
+		return
+	}
+	if project == nil {
+		writeJSON(w, 200, map[string]any{"ok": true, "ignored": true, "reason": "no project mapped for repo"})
+		return
+	}
+
+	switch p.Action {
+	case "opened", "synchronize", "reopened":
+		if p.PullRequest.Head.SHA == "" {
+			writeJSON(w, 400, map[string]any{"error": "missing fields"})
+			return
+		}
+		_ = s.Store.UpdateProjectGitHubInfo(r.Context(), project.ID, p.Installation.ID, p.Repository.DefaultBranch)
+
+		// GitHub serves the PR head under refs/pull/<n>/head, which also covers PRs from forks.
+		ref := fmt.Sprintf("refs/pull/%d/head", p.Number)
+		prNumber := p.Number
+		dep, err := s.Store.CreateDeployment(r.Context(), project.ID, p.PullRequest.Head.SHA, ref, "preview", &prNumber)
+		if err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		_ = s.Store.AddDeploymentEvent(r.Context(), dep.ID, "QUEUED", fmt.Sprintf("Preview queued for pull request #%d (%s)", p.Number, p.Action))
+
+		if err := s.enqueueBuild(dep.ID); err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		s.cancelSupersededBuilds(r.Context(), dep)
+		writeJSON(w, 200, map[string]any{"ok": true, "deployment_id": dep.ID})
+	case "closed":
+		// Stop builds still in flight, or they would come up after the teardown.
+		if ds, err := s.Store.ListDeploymentsByPR(r.Context(), project.ID, p.Number); err == nil {
+			for i := range ds {
+				if ds[i].Status != "QUEUED" && ds[i].Status != "BUILDING" {
+					continue
+				}
+				if _, err := s.cancelDeployment(r.Context(), &ds[i], fmt.Sprintf("Pull request #%d was closed", p.Number)); err != nil {
+					log.Printf("cancel deployment %s: %v", ds[i].ID, err)
+				}
+			}
+		}
+		task := asynq.NewTask(queue.TaskTeardownPreview, queue.MustJSON(queue.TeardownPreviewPayload{ProjectID: project.ID, PRNumber: p.Number}))
+		if _, err := s.Queue.Enqueue(task); err != nil {
+			writeJSON(w, 500, map[string]any{"error": err.Error()})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"ok": true, "teardown": true})
+	default:
+		writeJSON(w, 200, map[string]any{"ok": true, "ignored": true, "reason": "unhandled pull_request action"})
+	}
+}
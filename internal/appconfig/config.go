@@ -0,0 +1,288 @@
+// Package appconfig reads opencel.json, the build and runtime config an app
+// commits next to its code.
+package appconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	// FileName is the config file looked up in the app directory.
+	FileName = "opencel.json"
+	// Version is the newest config version this build understands.
+	Version = 1
+)
+
+// Types are the build types opencel.json may force with "type".
+var Types = []string{"docker", "nextjs", "astro", "vite", "node", "go", "python", "static"}
+
+// Config is opencel.json. Every field is optional; unset fields fall back to
+// what detection picks for the app.
+type Config struct {
+	Schema  string `json:"$schema,omitempty" doc:"URL of this schema, for editors."`
+	Version int    `json:"version,omitempty" doc:"Config format version. Defaults to 1." enum:"1"`
+
+	Type           string `json:"type,omitempty" doc:"Build type to use instead of detecting one." enum:"docker,nextjs,astro,vite,node,go,python,static"`
+	InstallCommand string `json:"installCommand,omitempty" doc:"Command that installs dependencies (Node.js and Python apps)."`
+	BuildCommand   string `json:"buildCommand,omitempty" doc:"Command that builds the app (Node.js apps and static sites built with Node.js)."`
+	StartCommand   string `json:"startCommand,omitempty" doc:"Command that starts the server (Node.js, Go and Python apps)."`
+	OutputDir      string `json:"outputDir,omitempty" doc:"Directory served by static sites, relative to the app directory."`
+	Port           int    `json:"port,omitempty" doc:"Port the app listens on. PORT is set to it. Ignored for static sites, which nginx serves on 80." minimum:"1" maximum:"65535"`
+	NodeVersion    string `json:"nodeVersion,omitempty" doc:"Node.js version of the build and runtime images, e.g. \"20\" or \"20.11\"." pattern:"^[0-9]+(\\.[0-9]+){0,2}$"`
+
+	HealthCheckPath string            `json:"healthCheckPath,omitempty" doc:"Path probed before the deployment is promoted. The project setting takes precedence." pattern:"^/"`
+	Env             map[string]string `json:"env,omitempty" doc:"Default environment variables. Project env vars with the same key win." keyPattern:"^[A-Za-z_][A-Za-z0-9_]*$"`
+
+	Headers   []Header   `json:"headers,omitempty" doc:"Response headers added by static sites."`
+	Redirects []Redirect `json:"redirects,omitempty" doc:"Redirects served by static sites."`
+	Rewrites  []Rewrite  `json:"rewrites,omitempty" doc:"Internal rewrites served by static sites."`
+
+	Dockerfile string            `json:"dockerfile,omitempty" doc:"Dockerfile to build with, relative to the app directory."`
+	BuildArgs  map[string]string `json:"buildArgs,omitempty" doc:"Build arguments passed to docker build."`
+	Target     string            `json:"target,omitempty" doc:"Dockerfile stage to build."`
+}
+
+// Header adds response headers to requests matching Source.
+type Header struct {
+	Source  string            `json:"source" required:"true" doc:"Exact path, or a prefix ending in /*."`
+	Headers map[string]string `json:"headers" required:"true" doc:"Header names and values."`
+}
+
+// Redirect answers requests matching Source with a redirect to Destination.
+type Redirect struct {
+	Source      string `json:"source" required:"true" doc:"Exact path, or a prefix ending in /*."`
+	Destination string `json:"destination" required:"true" doc:"Path or absolute http(s) URL to redirect to."`
+	Permanent   bool   `json:"permanent,omitempty" doc:"Use 308 instead of 307."`
+}
+
+// Rewrite serves Destination for requests matching Source without redirecting.
+type Rewrite struct {
+	Source      string `json:"source" required:"true" doc:"Exact path, or a prefix ending in /*."`
+	Destination string `json:"destination" required:"true" doc:"Path to serve instead."`
+}
+
+// Error is a problem with opencel.json. Line and Column are 1-based and zero
+// when the problem is not tied to a position (e.g. a validation error).
+type Error struct {
+	Line   int
+	Column int
+	Field  string
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	sb.WriteString(FileName)
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, ":%d:%d", e.Line, e.Column)
+	}
+	sb.WriteString(": ")
+	if e.Field != "" {
+		sb.WriteString(e.Field + ": ")
+	}
+	sb.WriteString(e.Msg)
+	return sb.String()
+}
+
+// Load reads dir's opencel.json. A missing file is an empty config.
+func Load(dir string) (*Config, error) {
+	b, err := os.ReadFile(filepath.Join(dir, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse decodes and validates opencel.json. Unknown fields are errors, so
+// typos fail the build instead of being ignored.
+func Parse(b []byte) (*Config, error) {
+	var cfg Config
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, decodeError(b, err)
+	}
+	end := dec.InputOffset()
+	if _, err := dec.Token(); err != io.EOF {
+		rest := bytes.TrimLeft(b[end:], " \t\r\n")
+		line, col := position(b, int64(len(b)-len(rest))+1)
+		return nil, &Error{Line: line, Column: col, Msg: "unexpected data after the config object"}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+var unknownField = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+func decodeError(b []byte, err error) error {
+	var syn *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return &Error{Msg: "file is empty; expected a JSON object"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		line, col := position(b, int64(len(b))+1)
+		return &Error{Line: line, Column: col, Msg: "unexpected end of file"}
+	case errors.As(err, &syn):
+		line, col := position(b, syn.Offset)
+		return &Error{Line: line, Column: col, Msg: strings.TrimPrefix(syn.Error(), "json: ")}
+	case errors.As(err, &typ):
+		line, col := position(b, typ.Offset)
+		return &Error{Line: line, Column: col, Field: typ.Field, Msg: fmt.Sprintf("expected %s, got %s", jsonType(typ.Type), typ.Value)}
+	}
+	if m := unknownField.FindStringSubmatch(err.Error()); m != nil {
+		e := &Error{Field: m[1], Msg: "unknown field"}
+		// The decoder does not report where; the key's first occurrence is close enough.
+		if loc := regexp.MustCompile(`"` + regexp.QuoteMeta(m[1]) + `"\s*:`).FindIndex(b); loc != nil {
+			e.Line, e.Column = position(b, int64(loc[0])+1)
+		}
+		return e
+	}
+	return &Error{Msg: err.Error()}
+}
+
+// position converts the decoder's offset (bytes read, including the offending
+// byte) into a 1-based line and column.
+func position(b []byte, offset int64) (int, int) {
+	n := int(offset) - 1
+	if n < 0 {
+		n = 0
+	}
+	if n > len(b) {
+		n = len(b)
+	}
+	prefix := b[:n]
+	line := bytes.Count(prefix, []byte("\n")) + 1
+	col := len(prefix) - bytes.LastIndexByte(prefix, '\n')
+	return line, col
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+var (
+	envKey      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	headerName  = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+	nodeVersion = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,2}$`)
+)
+
+// Validate checks values the JSON types alone cannot. It reports every
+// problem, not just the first.
+func (c *Config) Validate() error {
+	var errs []error
+	bad := func(field, format string, args ...any) {
+		errs = append(errs, &Error{Field: field, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Version < 0 || c.Version > Version {
+		bad("version", "version %d is not supported (this server understands up to %d)", c.Version, Version)
+	}
+	if c.Type != "" && !contains(Types, c.Type) {
+		bad("type", "must be one of %s", strings.Join(Types, ", "))
+	}
+	if c.Port != 0 && (c.Port < 1 || c.Port > 65535) {
+		bad("port", "must be between 1 and 65535")
+	}
+	if c.NodeVersion != "" && !nodeVersion.MatchString(c.NodeVersion) {
+		bad("nodeVersion", "must be a version number like 20 or 20.11")
+	}
+	if c.HealthCheckPath != "" && (!strings.HasPrefix(c.HealthCheckPath, "/") || strings.ContainsAny(c.HealthCheckPath, " \t\r\n")) {
+		bad("healthCheckPath", "must be a path starting with /")
+	}
+	if c.OutputDir != "" {
+		if d := path.Clean(strings.TrimPrefix(c.OutputDir, "/")); d == ".." || strings.HasPrefix(d, "../") {
+			bad("outputDir", "must stay inside the app directory")
+		}
+	}
+	for k := range c.Env {
+		if !envKey.MatchString(k) {
+			bad("env."+k, "invalid variable name")
+		}
+	}
+	for i, h := range c.Headers {
+		f := fmt.Sprintf("headers[%d]", i)
+		checkSource(bad, f, h.Source)
+		if len(h.Headers) == 0 {
+			bad(f+".headers", "must not be empty")
+		}
+		for k, v := range h.Headers {
+			if !headerName.MatchString(k) {
+				bad(f+".headers."+k, "invalid header name")
+			}
+			if !servable(v, true) {
+				bad(f+".headers."+k, "value must not contain quotes, backslashes, $ or control characters")
+			}
+		}
+	}
+	for i, r := range c.Redirects {
+		f := fmt.Sprintf("redirects[%d]", i)
+		checkSource(bad, f, r.Source)
+		d := r.Destination
+		if !strings.HasPrefix(d, "/") && !strings.HasPrefix(d, "http://") && !strings.HasPrefix(d, "https://") || !servable(d, false) {
+			bad(f+".destination", "must be a path or an http(s) URL")
+		}
+	}
+	for i, r := range c.Rewrites {
+		f := fmt.Sprintf("rewrites[%d]", i)
+		checkSource(bad, f, r.Source)
+		if !strings.HasPrefix(r.Destination, "/") || !servable(r.Destination, false) {
+			bad(f+".destination", "must be a path starting with /")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkSource validates a headers/redirects/rewrites source: an exact path or
+// a prefix ending in /*.
+func checkSource(bad func(string, string, ...any), field, src string) {
+	p := strings.TrimSuffix(src, "*")
+	if !strings.HasPrefix(p, "/") || strings.Contains(p, "*") || (p != src && !strings.HasSuffix(p, "/")) || !servable(p, false) {
+		bad(field+".source", "must be a path like /about, or a prefix like /blog/*")
+	}
+}
+
+// servable reports whether s can be placed in generated server config as is.
+func servable(s string, spaces bool) bool {
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f || r == '"' || r == '\\' || r == '$' || (!spaces && (r == ' ' || r == ';' || r == '{' || r == '}')) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
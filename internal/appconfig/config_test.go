@@ -0,0 +1,112 @@
+package appconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`{
+  "$schema": "https://opencel.example.com/api/schema/opencel.json",
+  "version": 1,
+  "buildCommand": "npm run build:prod",
+  "port": 8080,
+  "nodeVersion": "20.11",
+  "env": {"NEXT_TELEMETRY_DISABLED": "1"},
+  "redirects": [{"source": "/old/*", "destination": "/new", "permanent": true}]
+}`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.BuildCommand != "npm run build:prod" || cfg.Port != 8080 || cfg.Env["NEXT_TELEMETRY_DISABLED"] != "1" || !cfg.Redirects[0].Permanent {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		name, in, want string
+	}{
+		{"syntax", "{\n  \"port\": 3000,\n}", "opencel.json:3:1: invalid character '}'"},
+		{"type", "{\n  \"port\": \"3000\"\n}", "opencel.json:2:16: port: expected an integer, got string"},
+		{"unknown field", "{\n  \"buildCmd\": \"make\"\n}", `opencel.json:2:3: buildCmd: unknown field`},
+		{"truncated", "{\n  \"port\": 3000", "opencel.json:2:15: unexpected end of file"},
+		{"trailing", "{}\n{}", "opencel.json:2:1: unexpected data after the config object"},
+		{"empty", "  ", "opencel.json: file is empty"},
+		{"version", `{"version": 2}`, "version: version 2 is not supported"},
+		{"port range", `{"port": 70000}`, "port: must be between 1 and 65535"},
+		{"source", `{"rewrites": [{"source": "blog", "destination": "/b"}]}`, "rewrites[0].source: must be a path"},
+		{"header value", `{"headers": [{"source": "/", "headers": {"X-A": "$x"}}]}`, "headers[0].headers.X-A: value must not contain"},
+		{"env key", `{"env": {"1BAD": "x"}}`, "env.1BAD: invalid variable name"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Parse([]byte(c.in))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("err = %v, want %q", err, c.want)
+			}
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("err is %T, want *Error", err)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	err := (&Config{Port: -1, Type: "rails"}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "port:") || !strings.Contains(err.Error(), "type:") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestSchemaMatchesConfig(t *testing.T) {
+	b, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		AdditionalProperties bool `json:"additionalProperties"`
+		Properties           map[string]struct {
+			Type  string `json:"type"`
+			Enum  []any  `json:"enum"`
+			Items *struct {
+				Required []string `json:"required"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	if s.AdditionalProperties {
+		t.Fatal("schema must reject unknown fields")
+	}
+
+	ct := reflect.TypeOf(Config{})
+	if len(s.Properties) != ct.NumField() {
+		t.Fatalf("schema has %d properties, Config has %d fields", len(s.Properties), ct.NumField())
+	}
+	for i := 0; i < ct.NumField(); i++ {
+		name, _, _ := strings.Cut(ct.Field(i).Tag.Get("json"), ",")
+		if _, ok := s.Properties[name]; !ok {
+			t.Errorf("schema is missing %q", name)
+		}
+	}
+	if got := s.Properties["port"].Type; got != "integer" {
+		t.Errorf("port type = %q", got)
+	}
+	if got := s.Properties["redirects"].Items.Required; !reflect.DeepEqual(got, []string{"source", "destination"}) {
+		t.Errorf("redirects required = %v", got)
+	}
+
+	var types []string
+	for _, v := range s.Properties["type"].Enum {
+		types = append(types, v.(string))
+	}
+	if !reflect.DeepEqual(types, Types) {
+		t.Errorf("type enum = %v, want %v", types, Types)
+	}
+}
@@ -0,0 +1,90 @@
+package appconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaPath is where the API serves Schema, for opencel.json's "$schema".
+const SchemaPath = "/api/schema/opencel.json"
+
+// Schema returns the JSON Schema of opencel.json. It is generated from Config,
+// so the file editors validate against is the one builds are checked with.
+func Schema() ([]byte, error) {
+	s := typeSchema(reflect.TypeOf(Config{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "opencel.json"
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// typeSchema describes t. Struct fields use their json names and these tags:
+// doc (description), enum (comma-separated), pattern, minimum, maximum,
+// keyPattern (for maps) and required.
+func typeSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		props := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			props[name] = fieldSchema(f)
+			if f.Tag.Get("required") == "true" {
+				required = append(required, name)
+			}
+		}
+		s := map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	panic("appconfig: no schema for " + t.String())
+}
+
+func fieldSchema(f reflect.StructField) map[string]any {
+	s := typeSchema(f.Type)
+	if v := f.Tag.Get("doc"); v != "" {
+		s["description"] = v
+	}
+	if v := f.Tag.Get("pattern"); v != "" {
+		s["pattern"] = v
+	}
+	if v := f.Tag.Get("keyPattern"); v != "" {
+		s["propertyNames"] = map[string]any{"pattern": v}
+	}
+	for _, k := range []string{"minimum", "maximum"} {
+		if v := f.Tag.Get(k); v != "" {
+			n, _ := strconv.Atoi(v)
+			s[k] = n
+		}
+	}
+	if v := f.Tag.Get("enum"); v != "" {
+		var enum []any
+		for _, e := range strings.Split(v, ",") {
+			if f.Type.Kind() == reflect.Int {
+				n, _ := strconv.Atoi(e)
+				enum = append(enum, n)
+			} else {
+				enum = append(enum, e)
+			}
+		}
+		s["enum"] = enum
+	}
+	return s
+}
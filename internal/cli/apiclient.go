@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// apiClient is a small JSON client for the OpenCel HTTP API. It sends an API
+// token, or signs in with email/password and keeps the session cookie for
+// subsequent calls.
+type apiClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+type apiFlags struct {
+	url      string
+	token    string
+	email    string
+	password string
+	code     string
+}
+
+func (f *apiFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.url, "api-url", os.Getenv("OPENCEL_API_URL"), "OpenCel URL, e.g. https://opencel.example.com (env OPENCEL_API_URL)")
+	cmd.Flags().StringVar(&f.token, "token", os.Getenv("OPENCEL_TOKEN"), "API token (env OPENCEL_TOKEN); replaces --email and --password")
+	cmd.Flags().StringVar(&f.email, "email", os.Getenv("OPENCEL_EMAIL"), "Account email (env OPENCEL_EMAIL)")
+	cmd.Flags().StringVar(&f.password, "password", os.Getenv("OPENCEL_PASSWORD"), "Account password (env OPENCEL_PASSWORD)")
+	cmd.Flags().StringVar(&f.code, "code", "", "Two-factor code or recovery code; prompted for when needed and not given")
+}
+
+func (f *apiFlags) client(cmd *cobra.Command) (*apiClient, error) {
+	ctx := cmd.Context()
+	base := strings.TrimRight(strings.TrimSpace(f.url), "/")
+	if base == "" {
+		return nil, fmt.Errorf("--api-url is required")
+	}
+	if f.token != "" {
+		return &apiClient{baseURL: base, token: f.token, http: &http.Client{Timeout: 60 * time.Second}}, nil
+	}
+	if f.email == "" || f.password == "" {
+		return nil, fmt.Errorf("--token, or --email and --password, are required")
+	}
+	jar, _ := cookiejar.New(nil)
+	c := &apiClient{baseURL: base, http: &http.Client{Timeout: 60 * time.Second, Jar: jar}}
+	var login struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/auth/login", map[string]string{"email": f.email, "password": f.password}, &login); err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	if login.MFARequired {
+		code := f.code
+		if code == "" {
+			fmt.Fprint(cmd.ErrOrStderr(), "Two-factor code: ")
+			line, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+			code = strings.TrimSpace(line)
+		}
+		if code == "" {
+			return nil, fmt.Errorf("login: a two-factor code is required (--code)")
+		}
+		if err := c.do(ctx, http.MethodPost, "/api/auth/login/2fa", map[string]string{"mfa_token": login.MFAToken, "code": code}, nil); err != nil {
+			return nil, fmt.Errorf("login: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (c *apiClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(b, &e) == nil && e.Error != "" {
+			return fmt.Errorf("%s %s: %s (%d)", method, path, e.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("%s %s: status %d", method, path, resp.StatusCode)
+	}
+	if out != nil {
+		return json.Unmarshal(b, out)
+	}
+	return nil
+}
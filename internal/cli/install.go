@@ -529,10 +529,13 @@ services:
     networks: [opencel]
 
   registry:
-    image: registry:2
+    image: registry:3
     restart: unless-stopped
     ports:
       - "127.0.0.1:5000:5000"
+    environment:
+      # Lets the worker delete expired deployment images.
+      REGISTRY_STORAGE_DELETE_ENABLED: "true"
     volumes:
       - ./.data/registry:/var/lib/registry
     networks: [opencel]
@@ -588,8 +591,11 @@ services:
       OPENCEL_GITHUB_PRIVATE_KEY_PATH: "/secrets/github_app_private_key.pem"
       OPENCEL_DOCKER_NETWORK: "opencel"
       OPENCEL_REGISTRY_ADDR: "localhost:5000"
+      OPENCEL_REGISTRY_API_URL: "http://registry:5000"
+      OPENCEL_TRAEFIK_DYNAMIC_PATH: "/traefik/dynamic/opencel.yml"
     volumes:
       - /var/run/docker.sock:/var/run/docker.sock
+      - ./traefik/dynamic:/traefik/dynamic
       - ./secrets:/secrets:ro
     depends_on:
       postgres:
@@ -696,9 +702,12 @@ services:
     networks: [opencel]
 
   registry:
-    image: registry:2
+    image: registry:3
     ports:
       - "127.0.0.1:5000:5000"
+    environment:
+      # Lets the worker delete expired deployment images.
+      REGISTRY_STORAGE_DELETE_ENABLED: "true"
     volumes:
       - ./.data/registry:/var/lib/registry
     networks: [opencel]
@@ -755,10 +764,13 @@ services:
       OPENCEL_GITHUB_PRIVATE_KEY_PATH: "/secrets/github_app_private_key.pem"
       OPENCEL_DOCKER_NETWORK: "opencel"
       OPENCEL_REGISTRY_ADDR: "localhost:5000"
+      OPENCEL_REGISTRY_API_URL: "http://registry:5000"
       OPENCEL_TRAEFIK_ENTRYPOINT: "web"
       OPENCEL_TRAEFIK_TLS: "false"
+      OPENCEL_TRAEFIK_DYNAMIC_PATH: "/traefik/dynamic/opencel.yml"
     volumes:
       - /var/run/docker.sock:/var/run/docker.sock
+      - ./traefik/dynamic:/traefik/dynamic
       - ./secrets:/secrets:ro
     depends_on:
       postgres:
@@ -875,10 +887,13 @@ services:
     networks: [opencel]
 
   registry:
-    image: registry:2
+    image: registry:3
     ports:
       - "127.0.0.1:5000:5000"
     restart: unless-stopped
+    environment:
+      # Lets the worker delete expired deployment images.
+      REGISTRY_STORAGE_DELETE_ENABLED: "true"
     volumes:
       - ./.data/registry:/var/lib/registry
     networks: [opencel]
@@ -940,10 +955,13 @@ services:
       OPENCEL_GITHUB_PRIVATE_KEY_PATH: "/secrets/github_app_private_key.pem"
       OPENCEL_DOCKER_NETWORK: "opencel"
       OPENCEL_REGISTRY_ADDR: "localhost:5000"
+      OPENCEL_REGISTRY_API_URL: "http://registry:5000"
       OPENCEL_TRAEFIK_ENTRYPOINT: "websecure"
       OPENCEL_TRAEFIK_TLS: "true"
+      OPENCEL_TRAEFIK_DYNAMIC_PATH: "/traefik/dynamic/opencel.yml"
     volumes:
       - /var/run/docker.sock:/var/run/docker.sock
+      - ./traefik/dynamic:/traefik/dynamic
       - ./secrets:/secrets:ro
     depends_on:
       postgres:
@@ -1059,10 +1077,13 @@ services:
     networks: [opencel]
 
   registry:
-    image: registry:2
+    image: registry:3
     restart: unless-stopped
     ports:
       - "127.0.0.1:5000:5000"
+    environment:
+      # Lets the worker delete expired deployment images.
+      REGISTRY_STORAGE_DELETE_ENABLED: "true"
     volumes:
       - ./.data/registry:/var/lib/registry
     networks: [opencel]
@@ -1123,10 +1144,13 @@ services:
       OPENCEL_GITHUB_PRIVATE_KEY_PATH: "/secrets/github_app_private_key.pem"
       OPENCEL_DOCKER_NETWORK: "opencel"
       OPENCEL_REGISTRY_ADDR: "localhost:5000"
+      OPENCEL_REGISTRY_API_URL: "http://registry:5000"
       OPENCEL_TRAEFIK_ENTRYPOINT: "web"
       OPENCEL_TRAEFIK_TLS: "false"
+      OPENCEL_TRAEFIK_DYNAMIC_PATH: "/traefik/dynamic/opencel.yml"
     volumes:
       - /var/run/docker.sock:/var/run/docker.sock
+      - ./traefik/dynamic:/traefik/dynamic
       - ./secrets:/secrets:ro
     depends_on:
       postgres:
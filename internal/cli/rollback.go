@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+func newRollbackCmd() *cobra.Command {
+	var api apiFlags
+	var to string
+	cmd := &cobra.Command{
+		Use:   "rollback <project-id>",
+		Short: "Roll a project's production back to an earlier deployment",
+		Long: "Rollback re-promotes the deployment that was production before the current one,\n" +
+			"or the deployment given with --to. If its container is gone it is recreated\n" +
+			"from the stored image before traffic is switched.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := api.client(cmd)
+			if err != nil {
+				return err
+			}
+			var resp struct {
+				DeploymentID string `json:"deployment_id"`
+			}
+			path := "/api/projects/" + url.PathEscape(args[0]) + "/rollback"
+			if err := c.do(cmd.Context(), http.MethodPost, path, map[string]string{"deployment_id": to}, &resp); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Rollback to deployment %s queued.\n", resp.DeploymentID)
+			return nil
+		},
+	}
+	api.register(cmd)
+	cmd.Flags().StringVar(&to, "to", "", "Deployment ID to roll back to (default: previous production deployment)")
+	return cmd
+}
@@ -5,10 +5,21 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// RestartPolicies are the docker restart policies deployment containers may use.
+var RestartPolicies = []string{"no", "on-failure", "unless-stopped", "always"}
+
+// DefaultTrustedProxies are the loopback and private networks, where the
+// bundled Traefik reaches the API from.
+var DefaultTrustedProxies = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
 type Config struct {
 	// Core
 	HTTPAddr     string
@@ -16,11 +27,18 @@ type Config struct {
 	RedisAddr    string
 	BaseDomain   string
 	PublicScheme string
+	// TrustedProxies are the peers whose X-Forwarded-For and X-Real-IP
+	// headers name the client. Requests from anywhere else are keyed on
+	// their TCP peer address.
+	TrustedProxies []netip.Prefix
 
 	// Secrets
 	JWTSecret  string
 	EnvKeyB64  string // 32 bytes base64
 	EncryptKey []byte
+	// JWTPreviousSecrets still verify sessions signed before a JWT secret
+	// rotation; they never sign new ones.
+	JWTPreviousSecrets []string
 
 	// GitHub App
 	GitHubAppID          string
@@ -41,6 +59,48 @@ type Config struct {
 	// Docker
 	DockerNetwork string
 	RegistryAddr  string // e.g. localhost:5000
+	// Registry HTTP API as reached from the worker container, e.g. http://registry:5000.
+	RegistryAPIURL string
+	// BuildCache builds with BuildKit through the named buildx builder and
+	// keeps layer cache in the registry, per project and branch.
+	BuildCache    bool
+	BuildxBuilder string
+	// SourceArchiveMaxBytes caps the size of a downloaded source archive.
+	SourceArchiveMaxBytes int64
+	// SourceExtractMaxBytes caps the total size of the files extracted from
+	// it, which compression can make far larger than the archive.
+	SourceExtractMaxBytes int64
+	// RuntimeLogs makes the worker follow deployment containers' output into
+	// their runtime log stream. Enable it on one worker per docker host.
+	RuntimeLogs bool
+	// RuntimeLogRetention is how long runtime log chunks are kept; garbage
+	// collection deletes older ones.
+	RuntimeLogRetention time.Duration
+
+	// Deployment container defaults, which are also ceilings: projects may
+	// lower them but not raise them. Zero limits mean unlimited.
+	ContainerMemoryMB  int
+	ContainerCPUs      float64
+	ContainerPidsLimit int
+	ContainerRestart   string
+	ContainerReadOnly  bool
+	// Build limits. They are enforced by the buildx builder's container; if
+	// the builder cannot be created, builds fall back to the legacy builder,
+	// which applies them but lacks BuildKit-only Dockerfile features.
+	BuildMemoryMB int
+	BuildCPUs     float64
+
+	// Promotion health check defaults; projects may override them in their
+	// settings. With no path configured anywhere "/" is probed and any
+	// response below 500 passes, since many apps answer 404 or 401 there.
+	HealthCheckPath    string
+	HealthCheckTimeout time.Duration
+
+	// Retention: how often old deployments are garbage collected (asynq cron
+	// spec, empty disables it) and how many deployments per git ref are kept
+	// unless a project overrides it.
+	GCSchedule       string
+	PreviewRetention int
 }
 
 func FromEnv() (*Config, error) {
@@ -64,6 +124,45 @@ func FromEnv() (*Config, error) {
 		TraefikCertResolver:  os.Getenv("OPENCEL_TRAEFIK_CERT_RESOLVER"),
 		DockerNetwork:        envOr("OPENCEL_DOCKER_NETWORK", "opencel"),
 		RegistryAddr:         envOr("OPENCEL_REGISTRY_ADDR", "localhost:5000"),
+		BuildCache:           envBool("OPENCEL_BUILD_CACHE", true),
+		BuildxBuilder:        envOr("OPENCEL_BUILDX_BUILDER", "opencel"),
+		RuntimeLogs:          envBool("OPENCEL_RUNTIME_LOGS", false),
+		RuntimeLogRetention:  envDuration("OPENCEL_RUNTIME_LOG_RETENTION", 7*24*time.Hour),
+		ContainerMemoryMB:    envLimit("OPENCEL_CONTAINER_MEMORY_MB", 1024),
+		ContainerCPUs:        envCPUs("OPENCEL_CONTAINER_CPUS", 1),
+		ContainerPidsLimit:   envLimit("OPENCEL_CONTAINER_PIDS_LIMIT", 512),
+		ContainerRestart:     envOr("OPENCEL_CONTAINER_RESTART", "unless-stopped"),
+		ContainerReadOnly:    envBool("OPENCEL_CONTAINER_READ_ONLY", false),
+		BuildMemoryMB:        envLimit("OPENCEL_BUILD_MEMORY_MB", 4096),
+		BuildCPUs:            envCPUs("OPENCEL_BUILD_CPUS", 2),
+		HealthCheckPath:      os.Getenv("OPENCEL_HEALTHCHECK_PATH"),
+		HealthCheckTimeout:   envDuration("OPENCEL_HEALTHCHECK_TIMEOUT", 30*time.Second),
+		GCSchedule:           envOr("OPENCEL_GC_SCHEDULE", "@every 1h"),
+		PreviewRetention:     envInt("OPENCEL_PREVIEW_RETENTION", 3),
+	}
+	c.JWTPreviousSecrets = envList("OPENCEL_JWT_PREVIOUS_SECRETS")
+	proxies := envList("OPENCEL_TRUSTED_PROXIES")
+	if proxies == nil {
+		proxies = DefaultTrustedProxies
+	} else if len(proxies) == 1 && strings.EqualFold(proxies[0], "none") {
+		proxies = nil
+	}
+	for _, p := range proxies {
+		pfx, err := parsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("OPENCEL_TRUSTED_PROXIES: %w", err)
+		}
+		c.TrustedProxies = append(c.TrustedProxies, pfx)
+	}
+	c.RegistryAPIURL = envOr("OPENCEL_REGISTRY_API_URL", "http://"+c.RegistryAddr)
+	c.SourceArchiveMaxBytes = int64(envInt("OPENCEL_SOURCE_ARCHIVE_MAX_MB", 1024)) << 20
+	c.SourceExtractMaxBytes = int64(envInt("OPENCEL_SOURCE_EXTRACT_MAX_MB", 4096)) << 20
+	if strings.EqualFold(c.GCSchedule, "off") {
+		c.GCSchedule = ""
+	}
+	c.ContainerRestart = strings.ToLower(strings.TrimSpace(c.ContainerRestart))
+	if !slices.Contains(RestartPolicies, c.ContainerRestart) {
+		return nil, fmt.Errorf("OPENCEL_CONTAINER_RESTART must be one of %s", strings.Join(RestartPolicies, ", "))
 	}
 
 	var missing []string
@@ -138,6 +237,70 @@ func envBool(k string, def bool) bool {
 	}
 }
 
+func envInt(k string, def int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(k)))
+	if err != nil || n < 1 {
+		return def
+	}
+	return n
+}
+
+// envLimit is envInt that also accepts 0, for "unlimited".
+func envLimit(k string, def int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(k)))
+	if err != nil || n < 0 {
+		return def
+	}
+	return n
+}
+
+// envCPUs parses a (fractional) CPU count; 0 means unlimited.
+func envCPUs(k string, def float64) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(os.Getenv(k)), 64)
+	if err != nil || f < 0 {
+		return def
+	}
+	return f
+}
+
+// envList splits a comma-separated variable, dropping empty items.
+func envList(k string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(k), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parsePrefix parses a CIDR, or a single address as a prefix of its own.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if a, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return p.Masked(), nil
+}
+
+// envDuration accepts Go durations ("45s") or a plain number of seconds.
+func envDuration(k string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(k))
+	if v == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d
+	}
+	if n, err := strconv.Atoi(v); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return def
+}
+
 func randomB64(n int) string {
 	b := make([]byte, n)
 	_, _ = rand.Read(b)
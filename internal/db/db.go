@@ -3,8 +3,10 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
@@ -24,3 +26,9 @@ func Ping(ctx context.Context, db *sql.DB) error {
 	defer cancel()
 	return db.PingContext(ctx)
 }
+
+// IsUniqueViolation reports whether err is a Postgres unique_violation (23505).
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -3,7 +3,9 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"strings"
 	"time"
 )
 
@@ -20,10 +22,12 @@ type User struct {
 }
 
 type Organization struct {
-	ID        string
-	Slug      string
-	Name      string
-	CreatedAt time.Time
+	ID   string
+	Slug string
+	Name string
+	// Require2FA keeps members without two-factor authentication out.
+	Require2FA bool
+	CreatedAt  time.Time
 }
 
 type OrgMembership struct {
@@ -64,6 +68,17 @@ type Deployment struct {
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	PromotedAt    sql.NullTime
+	PRNumber      sql.NullInt64
+	// From the opencel.json the deployment was built with.
+	HealthCheckPath sql.NullString
+	EnvDefaults     map[string]string
+	// BuildKit steps of the image build and how many were cached; NULL for
+	// uncached builds and redeploys.
+	BuildSteps       sql.NullInt64
+	BuildCachedSteps sql.NullInt64
+	// The commit's message and author, as GitHub reports them.
+	CommitMessage sql.NullString
+	CommitAuthor  sql.NullString
 }
 
 type DeploymentLogChunk struct {
@@ -154,8 +169,8 @@ func (s *Store) CreateOrganization(ctx context.Context, slug, name string) (*Org
 	err := s.DB.QueryRowContext(ctx, `
 		INSERT INTO organizations (slug, name)
 		VALUES ($1, $2)
-		RETURNING id, slug, name, created_at
-	`, slug, name).Scan(&o.ID, &o.Slug, &o.Name, &o.CreatedAt)
+		RETURNING id, slug, name, require_2fa, created_at
+	`, slug, name).Scan(&o.ID, &o.Slug, &o.Name, &o.Require2FA, &o.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -165,10 +180,10 @@ func (s *Store) CreateOrganization(ctx context.Context, slug, name string) (*Org
 func (s *Store) GetOrganization(ctx context.Context, id string) (*Organization, error) {
 	var o Organization
 	err := s.DB.QueryRowContext(ctx, `
-		SELECT id, slug, name, created_at
+		SELECT id, slug, name, require_2fa, created_at
 		FROM organizations
 		WHERE id = $1
-	`, id).Scan(&o.ID, &o.Slug, &o.Name, &o.CreatedAt)
+	`, id).Scan(&o.ID, &o.Slug, &o.Name, &o.Require2FA, &o.CreatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -180,7 +195,7 @@ func (s *Store) GetOrganization(ctx context.Context, id string) (*Organization,
 
 func (s *Store) ListOrganizationsByUser(ctx context.Context, userID string) ([]Organization, error) {
 	rows, err := s.DB.QueryContext(ctx, `
-		SELECT o.id, o.slug, o.name, o.created_at
+		SELECT o.id, o.slug, o.name, o.require_2fa, o.created_at
 		FROM organizations o
 		JOIN organization_memberships m ON m.org_id = o.id
 		WHERE m.user_id = $1
@@ -193,7 +208,7 @@ func (s *Store) ListOrganizationsByUser(ctx context.Context, userID string) ([]O
 	var out []Organization
 	for rows.Next() {
 		var o Organization
-		if err := rows.Scan(&o.ID, &o.Slug, &o.Name, &o.CreatedAt); err != nil {
+		if err := rows.Scan(&o.ID, &o.Slug, &o.Name, &o.Require2FA, &o.CreatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, o)
@@ -234,6 +249,15 @@ func (s *Store) GetOrgMembership(ctx context.Context, orgID, userID string) (*Or
 	return &m, nil
 }
 
+// CountOrgOwners returns how many owners an org has.
+func (s *Store) CountOrgOwners(ctx context.Context, orgID string) (int, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM organization_memberships WHERE org_id = $1 AND role = 'owner'
+	`, orgID).Scan(&n)
+	return n, err
+}
+
 type OrgMemberRow struct {
 	UserID    string
 	Email     string
@@ -267,11 +291,11 @@ func (s *Store) ListOrgMembers(ctx context.Context, orgID string) ([]OrgMemberRo
 func (s *Store) FirstOrganization(ctx context.Context) (*Organization, error) {
 	var o Organization
 	err := s.DB.QueryRowContext(ctx, `
-		SELECT id, slug, name, created_at
+		SELECT id, slug, name, require_2fa, created_at
 		FROM organizations
 		ORDER BY created_at ASC
 		LIMIT 1
-	`).Scan(&o.ID, &o.Slug, &o.Name, &o.CreatedAt)
+	`).Scan(&o.ID, &o.Slug, &o.Name, &o.Require2FA, &o.CreatedAt)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
@@ -406,20 +430,20 @@ func (s *Store) GetOrgRole(ctx context.Context, userID, orgID string) (string, e
 	return role, nil
 }
 
-func (s *Store) CreateDeployment(ctx context.Context, projectID, gitSHA, gitRef, typ string) (*Deployment, error) {
-	var d Deployment
-	err := s.DB.QueryRowContext(ctx, `
-		INSERT INTO deployments (project_id, git_sha, git_ref, type, status)
-		VALUES ($1, $2, $3, $4, 'QUEUED')
-		RETURNING id, project_id, git_sha, git_ref, type, status, image_ref, container_name, service_port, preview_url, created_at, updated_at, promoted_at
-	`, projectID, gitSHA, gitRef, typ).Scan(
-		&d.ID, &d.ProjectID, &d.GitSHA, &d.GitRef, &d.Type, &d.Status,
-		&d.ImageRef, &d.ContainerName, &d.ServicePort, &d.PreviewURL, &d.CreatedAt, &d.UpdatedAt, &d.PromotedAt,
-	)
+func (s *Store) CreateDeployment(ctx context.Context, projectID, gitSHA, gitRef, typ string, prNumber *int) (*Deployment, error) {
+	var pr sql.NullInt64
+	if prNumber != nil {
+		pr = sql.NullInt64{Int64: int64(*prNumber), Valid: true}
+	}
+	d, err := scanDeployment(s.DB.QueryRowContext(ctx, `
+		INSERT INTO deployments (project_id, git_sha, git_ref, type, status, pr_number)
+		VALUES ($1, $2, $3, $4, 'QUEUED', $5)
+		RETURNING `+deploymentColumns+`
+	`, projectID, gitSHA, gitRef, typ, pr))
 	if err != nil {
 		return nil, err
 	}
-	return &d, nil
+	return d, nil
 }
 
 func (s *Store) UpdateDeployment(ctx context.Context, deploymentID string, status string, imageRef *string, containerName *string, servicePort *int, previewURL *string) error {
@@ -436,14 +460,6 @@ func (s *Store) UpdateDeployment(ctx context.Context, deploymentID string, statu
 	return err
 }
 
-func (s *Store) AddDeploymentEvent(ctx context.Context, deploymentID, typ, msg string) error {
-	_, err := s.DB.ExecContext(ctx, `
-		INSERT INTO deployment_events (deployment_id, type, message)
-		VALUES ($1, $2, $3)
-	`, deploymentID, typ, msg)
-	return err
-}
-
 func (s *Store) AppendLogChunk(ctx context.Context, deploymentID, stream, chunk string) error {
 	_, err := s.DB.ExecContext(ctx, `
 		INSERT INTO deployment_log_chunks (deployment_id, stream, chunk)
@@ -479,22 +495,18 @@ func (s *Store) ListLogChunks(ctx context.Context, deploymentID string, afterID
 }
 
 func (s *Store) GetDeployment(ctx context.Context, id string) (*Deployment, error) {
-	var d Deployment
-	err := s.DB.QueryRowContext(ctx, `
-		SELECT id, project_id, git_sha, git_ref, type, status, image_ref, container_name, service_port, preview_url, created_at, updated_at, promoted_at
+	d, err := scanDeployment(s.DB.QueryRowContext(ctx, `
+		SELECT `+deploymentColumns+`
 		FROM deployments
 		WHERE id = $1
-	`, id).Scan(
-		&d.ID, &d.ProjectID, &d.GitSHA, &d.GitRef, &d.Type, &d.Status,
-		&d.ImageRef, &d.ContainerName, &d.ServicePort, &d.PreviewURL, &d.CreatedAt, &d.UpdatedAt, &d.PromotedAt,
-	)
+	`, id))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &d, nil
+	return d, nil
 }
 
 func (s *Store) ListDeploymentsByProject(ctx context.Context, projectID string, limit int) ([]Deployment, error) {
@@ -502,7 +514,7 @@ func (s *Store) ListDeploymentsByProject(ctx context.Context, projectID string,
 		limit = 50
 	}
 	rows, err := s.DB.QueryContext(ctx, `
-		SELECT id, project_id, git_sha, git_ref, type, status, image_ref, container_name, service_port, preview_url, created_at, updated_at, promoted_at
+		SELECT `+deploymentColumns+`
 		FROM deployments
 		WHERE project_id = $1
 		ORDER BY created_at DESC
@@ -511,27 +523,228 @@ func (s *Store) ListDeploymentsByProject(ctx context.Context, projectID string,
 	if err != nil {
 		return nil, err
 	}
+	return collectDeployments(rows)
+}
+
+// ListDeploymentsByPR returns every deployment built for a pull request, newest first.
+func (s *Store) ListDeploymentsByPR(ctx context.Context, projectID string, prNumber int) ([]Deployment, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+deploymentColumns+`
+		FROM deployments
+		WHERE project_id = $1 AND pr_number = $2
+		ORDER BY created_at DESC
+	`, projectID, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return collectDeployments(rows)
+}
+
+// ListLatestReadyBranchDeployments returns, for every project and branch ref
+// (refs/heads/*), the most recent deployment that is READY.
+func (s *Store) ListLatestReadyBranchDeployments(ctx context.Context) ([]Deployment, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT DISTINCT ON (project_id, git_ref) `+deploymentColumns+`
+		FROM deployments
+		WHERE status = 'READY' AND git_ref LIKE 'refs/heads/%'
+		ORDER BY project_id, git_ref, created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return collectDeployments(rows)
+}
+
+const deploymentColumns = `id, project_id, git_sha, git_ref, type, status, image_ref, container_name, service_port, preview_url, created_at, updated_at, promoted_at, pr_number, health_check_path, env_defaults, build_steps, build_cached_steps, commit_message, commit_author`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDeployment(row rowScanner) (*Deployment, error) {
+	var d Deployment
+	var envDefaults []byte
+	err := row.Scan(
+		&d.ID, &d.ProjectID, &d.GitSHA, &d.GitRef, &d.Type, &d.Status,
+		&d.ImageRef, &d.ContainerName, &d.ServicePort, &d.PreviewURL, &d.CreatedAt, &d.UpdatedAt, &d.PromotedAt,
+		&d.PRNumber, &d.HealthCheckPath, &envDefaults, &d.BuildSteps, &d.BuildCachedSteps,
+		&d.CommitMessage, &d.CommitAuthor,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(envDefaults) > 0 {
+		if err := json.Unmarshal(envDefaults, &d.EnvDefaults); err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
+}
+
+func collectDeployments(rows *sql.Rows) ([]Deployment, error) {
 	defer rows.Close()
 	var out []Deployment
 	for rows.Next() {
-		var d Deployment
-		if err := rows.Scan(&d.ID, &d.ProjectID, &d.GitSHA, &d.GitRef, &d.Type, &d.Status, &d.ImageRef, &d.ContainerName, &d.ServicePort, &d.PreviewURL, &d.CreatedAt, &d.UpdatedAt, &d.PromotedAt); err != nil {
+		d, err := scanDeployment(rows)
+		if err != nil {
 			return nil, err
 		}
-		out = append(out, d)
+		out = append(out, *d)
 	}
 	return out, rows.Err()
 }
 
+// SetProjectProductionDeployment points the project at deploymentID and stamps
+// the deployment's promoted_at.
 func (s *Store) SetProjectProductionDeployment(ctx context.Context, projectID, deploymentID string) error {
 	_, err := s.DB.ExecContext(ctx, `
-		UPDATE projects
-		SET production_deployment_id = $2
-		WHERE id = $1
+		WITH p AS (
+			UPDATE projects
+			SET production_deployment_id = $2
+			WHERE id = $1
+		)
+		UPDATE deployments
+		SET promoted_at = now()
+		WHERE id = $2
 	`, projectID, deploymentID)
 	return err
 }
 
+// SetDeploymentAppConfig records the runtime settings of the opencel.json a
+// deployment was built with. Empty values clear them.
+func (s *Store) SetDeploymentAppConfig(ctx context.Context, deploymentID, healthCheckPath string, envDefaults map[string]string) error {
+	var env any
+	if len(envDefaults) > 0 {
+		b, err := json.Marshal(envDefaults)
+		if err != nil {
+			return err
+		}
+		env = string(b)
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE deployments
+		SET health_check_path = $2, env_defaults = $3
+		WHERE id = $1
+	`, deploymentID, nullString(healthCheckPath), env)
+	return err
+}
+
+// SetDeploymentBuildStats records the build's step count and cache hits.
+func (s *Store) SetDeploymentBuildStats(ctx context.Context, deploymentID string, steps, cached int) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE deployments
+		SET build_steps = $2, build_cached_steps = $3
+		WHERE id = $1
+	`, deploymentID, steps, cached)
+	return err
+}
+
+// SetDeploymentCommit records the message and author of the deployment's commit.
+func (s *Store) SetDeploymentCommit(ctx context.Context, deploymentID, message, author string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE deployments
+		SET commit_message = $2, commit_author = $3
+		WHERE id = $1
+	`, deploymentID, nullString(message), nullString(author))
+	return err
+}
+
+// ImageInUse reports whether a deployment other than excludeID that has not
+// expired still references imageRef (redeploys share their source's image).
+func (s *Store) ImageInUse(ctx context.Context, imageRef, excludeID string) (bool, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT count(*)
+		FROM deployments
+		WHERE image_ref = $1 AND id <> $2 AND status <> 'EXPIRED'
+	`, imageRef, excludeID).Scan(&n)
+	return n > 0, err
+}
+
+// ListRunningDeployments returns the READY deployments of every project that
+// have a container.
+func (s *Store) ListRunningDeployments(ctx context.Context) ([]Deployment, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+deploymentColumns+`
+		FROM deployments
+		WHERE status = 'READY' AND container_name IS NOT NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return collectDeployments(rows)
+}
+
+// DeleteLogChunksBefore deletes the chunks on stream written before t and
+// returns how many it deleted.
+func (s *Store) DeleteLogChunksBefore(ctx context.Context, stream string, t time.Time) (int64, error) {
+	res, err := s.DB.ExecContext(ctx, `
+		DELETE FROM deployment_log_chunks
+		WHERE stream = $1 AND ts < $2
+	`, stream, t)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// LastLogChunkTime returns when the deployment's newest chunk on stream was written.
+func (s *Store) LastLogChunkTime(ctx context.Context, deploymentID, stream string) (sql.NullTime, error) {
+	var ts sql.NullTime
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT max(ts)
+		FROM deployment_log_chunks
+		WHERE deployment_id = $1 AND stream = $2
+	`, deploymentID, stream).Scan(&ts)
+	return ts, err
+}
+
+// ListInFlightDeployments returns the QUEUED or BUILDING deployments of a git ref.
+func (s *Store) ListInFlightDeployments(ctx context.Context, projectID, gitRef string) ([]Deployment, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+deploymentColumns+`
+		FROM deployments
+		WHERE project_id = $1 AND git_ref = $2 AND status IN ('QUEUED', 'BUILDING')
+		ORDER BY created_at DESC
+	`, projectID, gitRef)
+	if err != nil {
+		return nil, err
+	}
+	return collectDeployments(rows)
+}
+
+// ListExpirableDeployments returns the project's finished deployments that
+// still hold a container or image, newest first.
+func (s *Store) ListExpirableDeployments(ctx context.Context, projectID string) ([]Deployment, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+deploymentColumns+`
+		FROM deployments
+		WHERE project_id = $1 AND status IN ('READY', 'STOPPED', 'FAILED')
+		ORDER BY created_at DESC
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return collectDeployments(rows)
+}
+
+// GetPreviousProductionDeployment returns the most recently promoted deployment
+// of the project other than currentID, which may be empty.
+func (s *Store) GetPreviousProductionDeployment(ctx context.Context, projectID, currentID string) (*Deployment, error) {
+	row := s.DB.QueryRowContext(ctx, `
+		SELECT `+deploymentColumns+`
+		FROM deployments
+		WHERE project_id = $1 AND ($2::uuid IS NULL OR id <> $2) AND promoted_at IS NOT NULL
+		ORDER BY promoted_at DESC
+		LIMIT 1
+	`, projectID, nullString(currentID))
+	d, err := scanDeployment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return d, err
+}
+
 func (s *Store) UpdateProjectGitHubInfo(ctx context.Context, projectID string, installationID int64, defaultBranch string) error {
 	_, err := s.DB.ExecContext(ctx, `
 		UPDATE projects
@@ -633,6 +846,644 @@ func nullIntPtr(p *int) any {
 	return *p
 }
 
+// ---- Deployment events ----
+
+type DeploymentEvent struct {
+	ID           string
+	DeploymentID string
+	At           time.Time
+	Type         string
+	Message      string
+	ActorUserID  sql.NullString
+	ActorEmail   sql.NullString
+	Metadata     map[string]any
+}
+
+type actorKey struct{}
+
+// WithActor marks events recorded with ctx as caused by userID.
+func WithActor(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+// ActorFromContext returns the user set by WithActor, or "".
+func ActorFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(actorKey{}).(string)
+	return v
+}
+
+func (s *Store) AddDeploymentEvent(ctx context.Context, deploymentID, typ, msg string) error {
+	return s.AddDeploymentEventMeta(ctx, deploymentID, typ, msg, nil)
+}
+
+// AddDeploymentEventMeta records an event with structured metadata. The actor
+// is taken from ctx (see WithActor).
+func (s *Store) AddDeploymentEventMeta(ctx context.Context, deploymentID, typ, msg string, meta map[string]any) error {
+	b, err := marshalMeta(meta)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO deployment_events (deployment_id, type, message, actor_user_id, metadata)
+		VALUES ($1, $2, $3, $4, $5)
+	`, deploymentID, typ, msg, nullString(ActorFromContext(ctx)), b)
+	return err
+}
+
+// AddDeploymentStatusEvent is AddDeploymentEventMeta for a status change. It
+// adds the phase the change ends, i.e. the latest QUEUED or BUILDING event, to
+// the metadata as "phase" and "duration_ms".
+func (s *Store) AddDeploymentStatusEvent(ctx context.Context, deploymentID, typ, msg string, meta map[string]any) error {
+	b, err := marshalMeta(meta)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO deployment_events (deployment_id, type, message, actor_user_id, metadata)
+		SELECT $1, $2, $3, $4, COALESCE((
+			SELECT jsonb_build_object(
+				'phase', lower(type),
+				'duration_ms', floor(extract(epoch FROM now() - at) * 1000)::bigint)
+			FROM deployment_events
+			WHERE deployment_id = $1 AND type IN ('QUEUED', 'BUILDING')
+			ORDER BY at DESC
+			LIMIT 1
+		), '{}'::jsonb) || $5::jsonb
+	`, deploymentID, typ, msg, nullString(ActorFromContext(ctx)), b)
+	return err
+}
+
+// DeploymentCancelRequested reports whether someone asked to stop the
+// deployment: it is CANCELED or has a CANCEL_REQUESTED event.
+func (s *Store) DeploymentCancelRequested(ctx context.Context, deploymentID string) (bool, error) {
+	var ok bool
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM deployments WHERE id = $1 AND status = 'CANCELED')
+		    OR EXISTS (SELECT 1 FROM deployment_events WHERE deployment_id = $1 AND type = 'CANCEL_REQUESTED')
+	`, deploymentID).Scan(&ok)
+	return ok, err
+}
+
+func marshalMeta(meta map[string]any) (string, error) {
+	if len(meta) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(meta)
+	return string(b), err
+}
+
+const deploymentEventColumns = `e.id, e.deployment_id, e.at, e.type, e.message, e.actor_user_id, u.email, e.metadata`
+
+func scanDeploymentEvent(row rowScanner) (*DeploymentEvent, error) {
+	var e DeploymentEvent
+	var meta []byte
+	if err := row.Scan(&e.ID, &e.DeploymentID, &e.At, &e.Type, &e.Message, &e.ActorUserID, &e.ActorEmail, &meta); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(meta, &e.Metadata); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListDeploymentEvents returns a deployment's events, oldest first.
+func (s *Store) ListDeploymentEvents(ctx context.Context, deploymentID string) ([]DeploymentEvent, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+deploymentEventColumns+`
+		FROM deployment_events e
+		LEFT JOIN users u ON u.id = e.actor_user_id
+		WHERE e.deployment_id = $1
+		ORDER BY e.at, e.id
+	`, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DeploymentEvent
+	for rows.Next() {
+		e, err := scanDeploymentEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *e)
+	}
+	return out, rows.Err()
+}
+
+// ProjectEvent is a deployment event in a project's activity feed.
+type ProjectEvent struct {
+	DeploymentEvent
+	Deployment Deployment
+}
+
+// ListProjectEvents returns the events of all of a project's deployments,
+// newest first, starting after the event beforeID if it is set.
+func (s *Store) ListProjectEvents(ctx context.Context, projectID, beforeID string, limit int) ([]ProjectEvent, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+deploymentEventColumns+`, d.git_sha, d.git_ref, d.type, d.status, d.pr_number, d.commit_message, d.commit_author
+		FROM deployment_events e
+		JOIN deployments d ON d.id = e.deployment_id
+		LEFT JOIN users u ON u.id = e.actor_user_id
+		WHERE d.project_id = $1
+		  AND ($2::uuid IS NULL OR (e.at, e.id) < (SELECT at, id FROM deployment_events WHERE id = $2))
+		ORDER BY e.at DESC, e.id DESC
+		LIMIT $3
+	`, projectID, nullString(beforeID), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []ProjectEvent
+	for rows.Next() {
+		var pe ProjectEvent
+		var meta []byte
+		e, d := &pe.DeploymentEvent, &pe.Deployment
+		if err := rows.Scan(
+			&e.ID, &e.DeploymentID, &e.At, &e.Type, &e.Message, &e.ActorUserID, &e.ActorEmail, &meta,
+			&d.GitSHA, &d.GitRef, &d.Type, &d.Status, &d.PRNumber, &d.CommitMessage, &d.CommitAuthor,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(meta, &e.Metadata); err != nil {
+			return nil, err
+		}
+		d.ID, d.ProjectID = e.DeploymentID, projectID
+		out = append(out, pe)
+	}
+	return out, rows.Err()
+}
+
+// ---- API tokens ----
+
+type APIToken struct {
+	ID          string
+	UserID      string
+	OrgID       sql.NullString
+	Name        string
+	TokenHash   string
+	TokenPrefix string
+	Scopes      []string
+	ExpiresAt   sql.NullTime
+	LastUsedAt  sql.NullTime
+	RevokedAt   sql.NullTime
+	CreatedAt   time.Time
+}
+
+const apiTokenColumns = `id, user_id, org_id, name, token_hash, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	var t APIToken
+	var scopes string
+	if err := row.Scan(&t.ID, &t.UserID, &t.OrgID, &t.Name, &t.TokenHash, &t.TokenPrefix, &scopes, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	return &t, nil
+}
+
+func collectAPITokens(rows *sql.Rows) ([]APIToken, error) {
+	defer rows.Close()
+	var out []APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CreateAPIToken(ctx context.Context, t APIToken) (*APIToken, error) {
+	var expires any
+	if t.ExpiresAt.Valid {
+		expires = t.ExpiresAt.Time
+	}
+	return scanAPIToken(s.DB.QueryRowContext(ctx, `
+		INSERT INTO api_tokens (user_id, org_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+apiTokenColumns+`
+	`, t.UserID, nullString(t.OrgID.String), t.Name, t.TokenHash, t.TokenPrefix, strings.Join(t.Scopes, " "), expires))
+}
+
+func (s *Store) GetAPIToken(ctx context.Context, id string) (*APIToken, error) {
+	t, err := scanAPIToken(s.DB.QueryRowContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return t, err
+}
+
+// GetAPITokenByHash returns the token with the given hash, revoked and expired
+// ones included; callers check.
+func (s *Store) GetAPITokenByHash(ctx context.Context, hash string) (*APIToken, error) {
+	t, err := scanAPIToken(s.DB.QueryRowContext(ctx, `SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash = $1`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return t, err
+}
+
+// ListAPITokensByUser returns the tokens a user created, newest first.
+func (s *Store) ListAPITokensByUser(ctx context.Context, userID string) ([]APIToken, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return collectAPITokens(rows)
+}
+
+// ListAPITokensByOrg returns the tokens limited to an org, newest first.
+func (s *Store) ListAPITokensByOrg(ctx context.Context, orgID string) ([]APIToken, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE org_id = $1
+		ORDER BY created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return collectAPITokens(rows)
+}
+
+func (s *Store) RevokeAPIToken(ctx context.Context, id string) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE api_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	return err
+}
+
+// RevokeUserAPITokens revokes all of a user's live API tokens, org tokens
+// included, and returns how many it revoked.
+func (s *Store) RevokeUserAPITokens(ctx context.Context, userID string) (int64, error) {
+	res, err := s.DB.ExecContext(ctx, `UPDATE api_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// TouchAPIToken records a use of the token. It writes at most once a minute
+// per token, so busy scripts do not turn every request into an UPDATE.
+func (s *Store) TouchAPIToken(ctx context.Context, id string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE api_tokens
+		SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')
+	`, id)
+	return err
+}
+
+// ---- Sessions ----
+
+type Session struct {
+	ID         string
+	UserID     string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+}
+
+const sessionColumns = `id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at`
+
+func scanSession(row rowScanner) (*Session, error) {
+	var ss Session
+	if err := row.Scan(&ss.ID, &ss.UserID, &ss.UserAgent, &ss.IP, &ss.CreatedAt, &ss.LastSeenAt, &ss.ExpiresAt, &ss.RevokedAt); err != nil {
+		return nil, err
+	}
+	return &ss, nil
+}
+
+func (s *Store) CreateSession(ctx context.Context, userID, userAgent, ip string, expiresAt time.Time) (*Session, error) {
+	return scanSession(s.DB.QueryRowContext(ctx, `
+		INSERT INTO sessions (user_id, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+sessionColumns+`
+	`, userID, userAgent, ip, expiresAt))
+}
+
+func (s *Store) GetSession(ctx context.Context, id string) (*Session, error) {
+	ss, err := scanSession(s.DB.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return ss, err
+}
+
+// ListActiveSessions returns a user's sessions that are neither revoked nor
+// expired, most recently used first.
+func (s *Store) ListActiveSessions(ctx context.Context, userID string) ([]Session, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Session
+	for rows.Next() {
+		ss, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *ss)
+	}
+	return out, rows.Err()
+}
+
+// RevokeSession revokes a session and, with it, every cookie of its user that
+// predates sessions (see RevokeLegacySessions).
+func (s *Store) RevokeSession(ctx context.Context, id string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		WITH revoked AS (
+			UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL
+			RETURNING user_id
+		)
+		UPDATE users SET sessions_revoked_at = now()
+		WHERE id IN (SELECT user_id FROM revoked)
+	`, id)
+	return err
+}
+
+// RevokeLegacySessions refuses the user's cookies from before sessions from
+// now on. Those cookies name no session, so this is the only way to end them.
+func (s *Store) RevokeLegacySessions(ctx context.Context, userID string) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE users SET sessions_revoked_at = now() WHERE id = $1`, userID)
+	return err
+}
+
+// GetSessionsRevokedAt returns when the user's sessions were last revoked;
+// cookies from before sessions issued earlier are no longer valid.
+func (s *Store) GetSessionsRevokedAt(ctx context.Context, userID string) (sql.NullTime, error) {
+	var t sql.NullTime
+	err := s.DB.QueryRowContext(ctx, `SELECT sessions_revoked_at FROM users WHERE id = $1`, userID).Scan(&t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sql.NullTime{}, nil
+	}
+	return t, err
+}
+
+// RevokeUserSessions revokes all of a user's active sessions except exceptID
+// (if set), as well as their cookies from before sessions, and returns how
+// many sessions it revoked.
+func (s *Store) RevokeUserSessions(ctx context.Context, userID, exceptID string) (int64, error) {
+	if err := s.RevokeLegacySessions(ctx, userID); err != nil {
+		return 0, err
+	}
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE sessions
+		SET revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		  AND ($2::uuid IS NULL OR id <> $2)
+	`, userID, nullString(exceptID))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// TouchSession records activity on a session, at most once a minute.
+func (s *Store) TouchSession(ctx context.Context, id string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE sessions
+		SET last_seen_at = now()
+		WHERE id = $1 AND last_seen_at < now() - interval '1 minute'
+	`, id)
+	return err
+}
+
+// ---- Two-factor authentication ----
+
+type UserTOTP struct {
+	UserID      string
+	SecretEnc   []byte
+	EnabledAt   sql.NullTime
+	LastCounter int64
+	CreatedAt   time.Time
+}
+
+// GetUserTOTP returns the user's TOTP enrollment, pending or enabled.
+func (s *Store) GetUserTOTP(ctx context.Context, userID string) (*UserTOTP, error) {
+	var t UserTOTP
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT user_id, secret_enc, enabled_at, last_counter, created_at
+		FROM user_totp
+		WHERE user_id = $1
+	`, userID).Scan(&t.UserID, &t.SecretEnc, &t.EnabledAt, &t.LastCounter, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// SetPendingUserTOTP stores a new secret awaiting confirmation. It does not
+// replace an enabled secret.
+func (s *Store) SetPendingUserTOTP(ctx context.Context, userID string, secretEnc []byte) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO user_totp (user_id, secret_enc)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_enc = EXCLUDED.secret_enc, last_counter = 0, created_at = now()
+		WHERE user_totp.enabled_at IS NULL
+	`, userID, secretEnc)
+	return err
+}
+
+// EnableUserTOTP turns on a pending enrollment, recording counter as used.
+func (s *Store) EnableUserTOTP(ctx context.Context, userID string, counter int64) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE user_totp
+		SET enabled_at = now(), last_counter = $2
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`, userID, counter)
+	return err
+}
+
+// UseTOTPCounter records that the code for counter was used. It returns false
+// if that or a later code was already used, so each code works once.
+func (s *Store) UseTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE user_totp
+		SET last_counter = $2
+		WHERE user_id = $1 AND last_counter < $2
+	`, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DeleteUserTOTP turns two-factor authentication off, dropping recovery codes.
+func (s *Store) DeleteUserTOTP(ctx context.Context, userID string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes swaps the user's recovery codes for new ones.
+func (s *Store) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, h); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code as used and reports whether
+// there was one.
+func (s *Store) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE user_recovery_codes
+		SET used_at = now()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) CountUnusedRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL
+	`, userID).Scan(&n)
+	return n, err
+}
+
+func (s *Store) SetOrgRequire2FA(ctx context.Context, orgID string, require bool) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE organizations SET require_2fa = $2 WHERE id = $1`, orgID, require)
+	return err
+}
+
+// MissingRequired2FA reports whether orgID requires two-factor authentication
+// and userID has not enabled it.
+func (s *Store) MissingRequired2FA(ctx context.Context, userID, orgID string) (bool, error) {
+	var missing bool
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT o.require_2fa AND NOT EXISTS (
+			SELECT 1 FROM user_totp t WHERE t.user_id = $1 AND t.enabled_at IS NOT NULL
+		)
+		FROM organizations o
+		WHERE o.id = $2
+	`, userID, orgID).Scan(&missing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return missing, err
+}
+
+// UserOrgsRequire2FA reports whether any of the user's orgs requires
+// two-factor authentication.
+func (s *Store) UserOrgsRequire2FA(ctx context.Context, userID string) (bool, error) {
+	var ok bool
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM organization_memberships m
+			JOIN organizations o ON o.id = m.org_id
+			WHERE m.user_id = $1 AND o.require_2fa
+		)
+	`, userID).Scan(&ok)
+	return ok, err
+}
+
+// ---- Audit events ----
+
+type AuditEvent struct {
+	ID          string
+	At          time.Time
+	Type        string
+	ActorUserID sql.NullString
+	Subject     string
+	IP          string
+	Metadata    map[string]any
+}
+
+func (s *Store) AddAuditEvent(ctx context.Context, typ, actorUserID, subject, ip string, meta map[string]any) error {
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO audit_events (type, actor_user_id, subject, ip, metadata)
+		VALUES ($1, $2, $3, $4, $5)
+	`, typ, nullString(actorUserID), subject, ip, b)
+	return err
+}
+
+// ListAuditEvents returns events newest first, optionally of one type and
+// older than the event beforeID.
+func (s *Store) ListAuditEvents(ctx context.Context, typ, beforeID string, limit int) ([]AuditEvent, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, at, type, actor_user_id, subject, ip, metadata
+		FROM audit_events
+		WHERE ($1::text IS NULL OR type = $1)
+		  AND ($2::uuid IS NULL OR (at, id) < (SELECT at, id FROM audit_events WHERE id = $2))
+		ORDER BY at DESC, id DESC
+		LIMIT $3
+	`, nullString(typ), nullString(beforeID), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		var meta []byte
+		if err := rows.Scan(&e.ID, &e.At, &e.Type, &e.ActorUserID, &e.Subject, &e.IP, &meta); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(meta, &e.Metadata); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
 // ---- GitHub OAuth + identities ----
 
 type UserIdentity struct {
@@ -829,3 +1680,135 @@ func (s *Store) ListAdminJobLogs(ctx context.Context, jobID string, limit int) (
 	}
 	return out, rows.Err()
 }
+
+// ---- Custom domains ----
+
+type ProjectDomain struct {
+	ID                string
+	ProjectID         string
+	Domain            string
+	Target            string // production | branch
+	Branch            sql.NullString
+	VerificationToken string
+	VerifiedAt        sql.NullTime
+	LastCheckedAt     sql.NullTime
+	LastError         sql.NullString
+	CreatedAt         time.Time
+}
+
+const projectDomainColumns = `id, project_id, domain, target, branch, verification_token, verified_at, last_checked_at, last_error, created_at`
+
+func scanProjectDomain(row rowScanner) (*ProjectDomain, error) {
+	var d ProjectDomain
+	if err := row.Scan(&d.ID, &d.ProjectID, &d.Domain, &d.Target, &d.Branch, &d.VerificationToken, &d.VerifiedAt, &d.LastCheckedAt, &d.LastError, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func collectProjectDomains(rows *sql.Rows) ([]ProjectDomain, error) {
+	defer rows.Close()
+	var out []ProjectDomain
+	for rows.Next() {
+		d, err := scanProjectDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CreateProjectDomain(ctx context.Context, projectID, domain, target string, branch *string, verificationToken string) (*ProjectDomain, error) {
+	return scanProjectDomain(s.DB.QueryRowContext(ctx, `
+		INSERT INTO project_domains (project_id, domain, target, branch, verification_token)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+projectDomainColumns+`
+	`, projectID, domain, target, nullStringPtr(branch), verificationToken))
+}
+
+func (s *Store) GetProjectDomain(ctx context.Context, id string) (*ProjectDomain, error) {
+	d, err := scanProjectDomain(s.DB.QueryRowContext(ctx, `
+		SELECT `+projectDomainColumns+`
+		FROM project_domains
+		WHERE id = $1
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *Store) ListProjectDomains(ctx context.Context, projectID string) ([]ProjectDomain, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+projectDomainColumns+`
+		FROM project_domains
+		WHERE project_id = $1
+		ORDER BY created_at ASC
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return collectProjectDomains(rows)
+}
+
+// GetVerifiedDomain returns the project domain that has verified domain, if any.
+func (s *Store) GetVerifiedDomain(ctx context.Context, domain string) (*ProjectDomain, error) {
+	d, err := scanProjectDomain(s.DB.QueryRowContext(ctx, `
+		SELECT `+projectDomainColumns+`
+		FROM project_domains
+		WHERE domain = $1 AND verified_at IS NOT NULL
+	`, domain))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *Store) ListVerifiedDomains(ctx context.Context) ([]ProjectDomain, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+projectDomainColumns+`
+		FROM project_domains
+		WHERE verified_at IS NOT NULL
+		ORDER BY domain ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return collectProjectDomains(rows)
+}
+
+func (s *Store) UpdateProjectDomainTarget(ctx context.Context, id, target string, branch *string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE project_domains
+		SET target = $2, branch = $3
+		WHERE id = $1
+	`, id, target, nullStringPtr(branch))
+	return err
+}
+
+// RecordProjectDomainCheck stores the outcome of a DNS verification attempt.
+// A domain stays verified once it has passed, even if a later check fails.
+// Only one project can hold a domain verified; passing while another does
+// fails with a unique violation.
+func (s *Store) RecordProjectDomainCheck(ctx context.Context, id string, verified bool, errMsg *string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE project_domains
+		SET last_checked_at = now(),
+		    last_error = $3,
+		    verified_at = CASE WHEN $2 THEN COALESCE(verified_at, now()) ELSE verified_at END
+		WHERE id = $1
+	`, id, verified, nullStringPtr(errMsg))
+	return err
+}
+
+func (s *Store) DeleteProjectDomain(ctx context.Context, id string) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM project_domains WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,118 @@
+// Package deploy holds deployment lifecycle steps shared by the API and the worker.
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opencel/opencel/internal/config"
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/settings"
+	"github.com/opencel/opencel/internal/traefik"
+)
+
+var (
+	// ErrUnhealthy is returned (wrapped) by Promote when the health check fails.
+	ErrUnhealthy = errors.New("health check failed")
+	// ErrNotRunning means the deployment has no READY container to promote.
+	ErrNotRunning = errors.New("deployment is not running")
+)
+
+const probeInterval = 500 * time.Millisecond
+
+// Probe polls http://<host>:<port><path> until it answers 2xx/3xx (or, if
+// lenient, anything below 500) or the timeout expires. Connection errors are
+// retried, since a container that was just started may not be listening yet.
+func Probe(ctx context.Context, host string, port int, path string, timeout time.Duration, lenient bool) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s:%d%s", host, port, path)
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		// A redirect is already proof the app is serving; don't follow it off-host.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	var last error
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && (resp.StatusCode < 400 || lenient && resp.StatusCode < 500) {
+				return nil
+			}
+			last = fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+		} else {
+			last = err
+		}
+
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				last = ctx.Err()
+			}
+			return fmt.Errorf("no healthy response within %s: %w", timeout, last)
+		case <-time.After(probeInterval):
+		}
+	}
+}
+
+// HealthCheck returns the path and timeout to probe d with. The project's
+// health_check_path wins over d's opencel.json, which wins over the instance
+// default. If none of them sets a path, "/" is probed leniently: only proof
+// that the app serves, as "/" may well need a login or not exist.
+func HealthCheck(cfg *config.Config, ps *settings.Project, d *db.Deployment) (path string, timeout time.Duration, lenient bool) {
+	path, timeout = ps.HealthCheck(cfg)
+	if strings.TrimSpace(ps.HealthCheckPath) != "" {
+		return path, timeout, false
+	}
+	if d.HealthCheckPath.Valid && d.HealthCheckPath.String != "" {
+		return d.HealthCheckPath.String, timeout, false
+	}
+	return path, timeout, strings.TrimSpace(cfg.HealthCheckPath) == ""
+}
+
+// CheckRunning returns ErrNotRunning unless d has a READY container that
+// Promote could route to.
+func CheckRunning(d *db.Deployment) error {
+	if d.Status != "READY" || !d.ContainerName.Valid || d.ContainerName.String == "" || d.ServicePort <= 0 {
+		return ErrNotRunning
+	}
+	return nil
+}
+
+// Promote health-checks d's container and only then points the project's
+// production route at it. A failed probe leaves production untouched, records
+// a PROMOTION_REJECTED event and returns an error wrapping ErrUnhealthy.
+func Promote(ctx context.Context, cfg *config.Config, store *db.Store, d *db.Deployment) error {
+	if err := CheckRunning(d); err != nil {
+		return err
+	}
+	ps, err := settings.LoadProject(ctx, store, d.ProjectID)
+	if err != nil {
+		return err
+	}
+	path, timeout, lenient := HealthCheck(cfg, ps, d)
+	if err := Probe(ctx, d.ContainerName.String, d.ServicePort, path, timeout, lenient); err != nil {
+		msg := fmt.Sprintf("Promotion rejected: health check %s failed: %v", path, err)
+		_ = store.AddDeploymentEvent(ctx, d.ID, "PROMOTION_REJECTED", msg)
+		return fmt.Errorf("%w: %v", ErrUnhealthy, err)
+	}
+
+	if err := store.SetProjectProductionDeployment(ctx, d.ProjectID, d.ID); err != nil {
+		return err
+	}
+	if err := traefik.Write(ctx, cfg, store); err != nil {
+		return fmt.Errorf("traefik config update failed: %w", err)
+	}
+	_ = store.AddDeploymentEvent(ctx, d.ID, "PROMOTED", "Deployment promoted to production")
+	return nil
+}
@@ -0,0 +1,102 @@
+package deploy
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencel/opencel/internal/config"
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/settings"
+)
+
+func splitHostPort(t *testing.T, srv *httptest.Server) (string, int) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+func TestProbeWaitsForHealthy(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	host, port := splitHostPort(t, srv)
+	if err := Probe(context.Background(), host, port, "/healthz", 5*time.Second, false); err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("calls = %d, want 3", calls.Load())
+	}
+}
+
+func TestProbeTimesOut(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	host, port := splitHostPort(t, srv)
+	if err := Probe(context.Background(), host, port, "/", time.Second, true); err == nil {
+		t.Fatal("expected error for an unhealthy server")
+	}
+}
+
+func TestProbeLenientAcceptsClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	host, port := splitHostPort(t, srv)
+	if err := Probe(context.Background(), host, port, "/", time.Second, true); err != nil {
+		t.Fatalf("lenient Probe: %v", err)
+	}
+	if err := Probe(context.Background(), host, port, "/", time.Second, false); err == nil {
+		t.Fatal("strict Probe accepted a 404")
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	d := &db.Deployment{}
+	fromApp := &db.Deployment{HealthCheckPath: sql.NullString{String: "/app", Valid: true}}
+	for _, tc := range []struct {
+		name        string
+		cfgPath     string
+		projectPath string
+		d           *db.Deployment
+		path        string
+		lenient     bool
+	}{
+		{"nothing configured", "", "", d, "/", true},
+		{"instance", "/up", "", d, "/up", false},
+		{"instance root", "/", "", d, "/", false},
+		{"opencel.json", "", "", fromApp, "/app", false},
+		{"project", "/up", "/healthz", fromApp, "/healthz", false},
+	} {
+		cfg := &config.Config{HealthCheckPath: tc.cfgPath, HealthCheckTimeout: time.Second}
+		path, _, lenient := HealthCheck(cfg, &settings.Project{HealthCheckPath: tc.projectPath}, tc.d)
+		if path != tc.path || lenient != tc.lenient {
+			t.Errorf("%s: got %q, lenient %v; want %q, %v", tc.name, path, lenient, tc.path, tc.lenient)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,11 +18,16 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const defaultAPIBaseURL = "https://api.github.com"
+
 type App struct {
-	AppID          int64
-	PrivateKey     *rsa.PrivateKey
-	WebhookSecret  string
-	HTTP           *http.Client
+	AppID         int64
+	PrivateKey    *rsa.PrivateKey
+	WebhookSecret string
+	HTTP          *http.Client
+
+	// APIBaseURL overrides https://api.github.com (GitHub Enterprise, tests).
+	APIBaseURL string
 }
 
 func NewApp(appID string, privateKeyPEM string, webhookSecret string) (*App, error) {
@@ -38,9 +44,18 @@ func NewApp(appID string, privateKeyPEM string, webhookSecret string) (*App, err
 		PrivateKey:    key,
 		WebhookSecret: webhookSecret,
 		HTTP:          &http.Client{Timeout: 30 * time.Second},
+		APIBaseURL:    defaultAPIBaseURL,
 	}, nil
 }
 
+func (a *App) apiURL(format string, args ...any) string {
+	base := strings.TrimRight(a.APIBaseURL, "/")
+	if base == "" {
+		base = defaultAPIBaseURL
+	}
+	return base + fmt.Sprintf(format, args...)
+}
+
 func parseRSAPrivateKeyFromPEM(pemStr string) (*rsa.PrivateKey, error) {
 	block, _ := pem.Decode([]byte(pemStr))
 	if block == nil {
@@ -82,7 +97,7 @@ func (a *App) GetRepoInstallation(ctx context.Context, owner, repo string) (*Ins
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://api.github.com/repos/%s/%s/installation", owner, repo), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", a.apiURL("/repos/%s/%s/installation", owner, repo), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -111,7 +126,7 @@ type RepoResponse struct {
 }
 
 func (a *App) GetRepo(ctx context.Context, token, owner, repo string) (*RepoResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", a.apiURL("/repos/%s/%s", owner, repo), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +149,71 @@ func (a *App) GetRepo(ctx context.Context, token, owner, repo string) (*RepoResp
 	return &out, nil
 }
 
+// Commit is the part of GET /repos/{owner}/{repo}/commits/{ref} opencel uses.
+type Commit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"commit"`
+}
+
+func (a *App) GetCommit(ctx context.Context, token, owner, repo, ref string) (*Commit, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", a.apiURL("/repos/%s/%s/commits/%s", owner, repo, ref), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	res, err := a.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 8192))
+		return nil, fmt.Errorf("github get commit: %s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+	var out Commit
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PullRequest is the part of GET /repos/{owner}/{repo}/pulls/{number} opencel uses.
+type PullRequest struct {
+	Number int    `json:"number"`
+	State  string `json:"state"` // "open" or "closed"
+}
+
+func (a *App) GetPullRequest(ctx context.Context, token, owner, repo string, number int) (*PullRequest, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", a.apiURL("/repos/%s/%s/pulls/%d", owner, repo, number), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	res, err := a.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 8192))
+		return nil, fmt.Errorf("github get pull request: %s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+	var out PullRequest
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
 type tokenResp struct {
 	Token string `json:"token"`
 }
@@ -143,7 +223,7 @@ func (a *App) CreateInstallationToken(ctx context.Context, installationID int64)
 	if err != nil {
 		return "", err
 	}
-	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", installationID), bytes.NewReader([]byte("{}")))
+	req, err := http.NewRequestWithContext(ctx, "POST", a.apiURL("/app/installations/%d/access_tokens", installationID), bytes.NewReader([]byte("{}")))
 	if err != nil {
 		return "", err
 	}
@@ -167,23 +247,44 @@ func (a *App) CreateInstallationToken(ctx context.Context, installationID int64)
 	return out.Token, nil
 }
 
-func (a *App) DownloadZipball(ctx context.Context, token, owner, repo, ref string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://api.github.com/repos/%s/%s/zipball/%s", owner, repo, ref), nil)
+// ErrArchiveTooLarge is returned by DownloadZipball when the archive exceeds
+// the size limit.
+var ErrArchiveTooLarge = errors.New("source archive exceeds the size limit")
+
+// DownloadZipball streams the repository archive at ref into dst and returns
+// its size. Archives larger than maxBytes (when > 0) fail with
+// ErrArchiveTooLarge; dst then holds a truncated archive.
+func (a *App) DownloadZipball(ctx context.Context, token, owner, repo, ref string, dst io.Writer, maxBytes int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", a.apiURL("/repos/%s/%s/zipball/%s", owner, repo, ref), nil)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	req.Header.Set("Authorization", "token "+token)
 	req.Header.Set("Accept", "application/vnd.github+json")
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 	res, err := a.HTTP.Do(req)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer res.Body.Close()
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
 		b, _ := io.ReadAll(io.LimitReader(res.Body, 8192))
-		return nil, fmt.Errorf("github download zipball: %s: %s", res.Status, strings.TrimSpace(string(b)))
+		return 0, fmt.Errorf("github download zipball: %s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+	if maxBytes > 0 && res.ContentLength > maxBytes {
+		return 0, fmt.Errorf("%w (%d > %d bytes)", ErrArchiveTooLarge, res.ContentLength, maxBytes)
 	}
-	return io.ReadAll(res.Body)
+	body := io.Reader(res.Body)
+	if maxBytes > 0 {
+		// One byte over the limit is enough to tell.
+		body = io.LimitReader(res.Body, maxBytes+1)
+	}
+	n, err := io.Copy(dst, body)
+	if err != nil {
+		return n, fmt.Errorf("github download zipball: %w", err)
+	}
+	if maxBytes > 0 && n > maxBytes {
+		return n, fmt.Errorf("%w (%d bytes)", ErrArchiveTooLarge, maxBytes)
+	}
+	return n, nil
 }
-
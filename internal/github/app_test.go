@@ -0,0 +1,37 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDownloadZipballLimit(t *testing.T) {
+	body := strings.Repeat("z", 1000)
+	app := newTestApp(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/web/zipball/abc123" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		// No Content-Length, so the limit must hold while streaming.
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(body))
+	})
+
+	var buf bytes.Buffer
+	n, err := app.DownloadZipball(context.Background(), "tok", "acme", "web", "abc123", &buf, 1000)
+	if err != nil || n != 1000 || buf.String() != body {
+		t.Fatalf("within limit: n=%d err=%v", n, err)
+	}
+
+	buf.Reset()
+	_, err = app.DownloadZipball(context.Background(), "tok", "acme", "web", "abc123", &buf, 999)
+	if !errors.Is(err, ErrArchiveTooLarge) {
+		t.Fatalf("over limit: err = %v, want ErrArchiveTooLarge", err)
+	}
+	if buf.Len() > 1000 {
+		t.Fatalf("read %d bytes past the limit", buf.Len())
+	}
+}
@@ -0,0 +1,88 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// CommitStatus is the body of POST /repos/{owner}/{repo}/statuses/{sha}.
+type CommitStatus struct {
+	State       string `json:"state"` // pending | success | failure | error
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Context     string `json:"context,omitempty"`
+}
+
+func (a *App) CreateCommitStatus(ctx context.Context, token, owner, repo, sha string, st CommitStatus) error {
+	// GitHub rejects descriptions longer than 140 characters.
+	if r := []rune(st.Description); len(r) > 140 {
+		st.Description = string(r[:137]) + "..."
+	}
+	return a.doJSON(ctx, "POST", a.apiURL("/repos/%s/%s/statuses/%s", owner, repo, sha), token, st, nil, "github create commit status")
+}
+
+type CheckRunOutput struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+// CheckRun is the body of the check run create/update endpoints.
+type CheckRun struct {
+	Name       string          `json:"name,omitempty"`
+	HeadSHA    string          `json:"head_sha,omitempty"`
+	Status     string          `json:"status,omitempty"`     // queued | in_progress | completed
+	Conclusion string          `json:"conclusion,omitempty"` // success | failure | cancelled | ...
+	DetailsURL string          `json:"details_url,omitempty"`
+	ExternalID string          `json:"external_id,omitempty"`
+	Output     *CheckRunOutput `json:"output,omitempty"`
+}
+
+type checkRunResp struct {
+	ID int64 `json:"id"`
+}
+
+// CreateCheckRun requires the app to have the checks:write permission.
+func (a *App) CreateCheckRun(ctx context.Context, token, owner, repo string, cr CheckRun) (int64, error) {
+	var out checkRunResp
+	if err := a.doJSON(ctx, "POST", a.apiURL("/repos/%s/%s/check-runs", owner, repo), token, cr, &out, "github create check run"); err != nil {
+		return 0, err
+	}
+	return out.ID, nil
+}
+
+func (a *App) UpdateCheckRun(ctx context.Context, token, owner, repo string, id int64, cr CheckRun) error {
+	return a.doJSON(ctx, "PATCH", a.apiURL("/repos/%s/%s/check-runs/%d", owner, repo, id), token, cr, nil, "github update check run")
+}
+
+func (a *App) doJSON(ctx context.Context, method, url, token string, in, out any, what string) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := a.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 8192))
+		return fmt.Errorf("%s: %s: %s", what, res.Status, strings.TrimSpace(string(b)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
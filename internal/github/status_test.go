@@ -0,0 +1,114 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func newTestApp(t *testing.T, h http.HandlerFunc) *App {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return &App{HTTP: srv.Client(), APIBaseURL: srv.URL}
+}
+
+func TestCreateCommitStatus(t *testing.T) {
+	var got CommitStatus
+	app := newTestApp(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/repos/acme/web/statuses/abc123" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "token inst-token" {
+			t.Errorf("unexpected auth header %q", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.WriteHeader(201)
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	err := app.CreateCommitStatus(context.Background(), "inst-token", "acme", "web", "abc123", CommitStatus{
+		State:       "success",
+		TargetURL:   "https://abc.preview.example.com",
+		Description: strings.Repeat("x", 200),
+		Context:     "opencel",
+	})
+	if err != nil {
+		t.Fatalf("CreateCommitStatus: %v", err)
+	}
+	if got.State != "success" || got.TargetURL != "https://abc.preview.example.com" || got.Context != "opencel" {
+		t.Fatalf("unexpected body: %+v", got)
+	}
+	if len(got.Description) != 140 {
+		t.Fatalf("description not truncated: %d chars", len(got.Description))
+	}
+}
+
+func TestCreateCommitStatusTruncatesRunes(t *testing.T) {
+	var got CommitStatus
+	app := newTestApp(t, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(201)
+	})
+	err := app.CreateCommitStatus(context.Background(), "tok", "acme", "web", "abc", CommitStatus{State: "failure", Description: strings.Repeat("ü", 200)})
+	if err != nil {
+		t.Fatalf("CreateCommitStatus: %v", err)
+	}
+	if !utf8.ValidString(got.Description) || utf8.RuneCountInString(got.Description) != 140 {
+		t.Fatalf("bad truncation: %q", got.Description)
+	}
+}
+
+func TestCheckRunLifecycle(t *testing.T) {
+	var created, updated CheckRun
+	app := newTestApp(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/repos/acme/web/check-runs":
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(201)
+			_, _ = w.Write([]byte(`{"id":42}`))
+		case r.Method == "PATCH" && r.URL.Path == "/repos/acme/web/check-runs/42":
+			_ = json.NewDecoder(r.Body).Decode(&updated)
+			_, _ = w.Write([]byte(`{"id":42}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(404)
+		}
+	})
+
+	ctx := context.Background()
+	id, err := app.CreateCheckRun(ctx, "tok", "acme", "web", CheckRun{Name: "OpenCel", HeadSHA: "abc123", Status: "in_progress"})
+	if err != nil {
+		t.Fatalf("CreateCheckRun: %v", err)
+	}
+	if id != 42 {
+		t.Fatalf("got id %d want 42", id)
+	}
+	if created.HeadSHA != "abc123" || created.Status != "in_progress" {
+		t.Fatalf("unexpected create body: %+v", created)
+	}
+	err = app.UpdateCheckRun(ctx, "tok", "acme", "web", id, CheckRun{Status: "completed", Conclusion: "failure", Output: &CheckRunOutput{Title: "Build failed", Summary: "docker build: exit 1"}})
+	if err != nil {
+		t.Fatalf("UpdateCheckRun: %v", err)
+	}
+	if updated.Conclusion != "failure" || updated.Output == nil || updated.Output.Title != "Build failed" {
+		t.Fatalf("unexpected update body: %+v", updated)
+	}
+}
+
+func TestCreateCommitStatusError(t *testing.T) {
+	app := newTestApp(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(403)
+		_, _ = w.Write([]byte(`{"message":"Resource not accessible by integration"}`))
+	})
+	err := app.CreateCommitStatus(context.Background(), "tok", "acme", "web", "abc", CommitStatus{State: "pending"})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("expected 403 error, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package integrations
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencel/opencel/internal/oidc"
+	"github.com/opencel/opencel/internal/settings"
+)
+
+const (
+	KeyOIDC             = "oidc"
+	KeyOIDCClientSecret = "oidc_client_secret"
+)
+
+// OIDCRoleMapping grants members of an identity provider group a role in an org.
+type OIDCRoleMapping struct {
+	Group string `json:"group"`
+	OrgID string `json:"org_id"`
+	Role  string `json:"role"`
+}
+
+// OIDCSettings configure single sign-on with an OpenID Connect provider such
+// as Keycloak. The client secret is stored separately, encrypted.
+type OIDCSettings struct {
+	Enabled     bool   `json:"enabled"`
+	DisplayName string `json:"display_name"` // on the login button, e.g. "Keycloak"
+	Issuer      string `json:"issuer"`
+	ClientID    string `json:"client_id"`
+	// Scopes besides openid; "email profile" if empty.
+	Scopes      []string `json:"scopes,omitempty"`
+	GroupsClaim string   `json:"groups_claim,omitempty"`
+	// AllowSignup creates accounts for new users. Without it only users who
+	// already exist (matched by verified email) can sign in.
+	AllowSignup bool `json:"allow_signup"`
+	// RoleMappings make the provider's groups authoritative for the orgs they
+	// name: each sign-in sets the user's role there, or removes them.
+	RoleMappings []OIDCRoleMapping `json:"role_mappings,omitempty"`
+}
+
+// oidcCacheTTL bounds how long a discovered provider is reused; Invalidate
+// drops it when settings change.
+const oidcCacheTTL = 10 * time.Minute
+
+type OIDCProvider struct {
+	Settings *settings.Store
+
+	mu       sync.Mutex
+	lastLoad time.Time
+	lastCfg  OIDCSettings
+	lastCli  *oidc.Client
+	lastErr  error
+}
+
+func NewOIDCProvider(st *settings.Store) *OIDCProvider {
+	return &OIDCProvider{Settings: st}
+}
+
+// LoadOIDCSettings reads the OIDC settings without contacting the provider.
+func LoadOIDCSettings(ctx context.Context, st *settings.Store) (OIDCSettings, bool, error) {
+	var v OIDCSettings
+	ok, err := st.GetJSON(ctx, KeyOIDC, &v)
+	if err != nil || !ok {
+		return OIDCSettings{}, false, err
+	}
+	v.Issuer = strings.TrimSpace(v.Issuer)
+	v.ClientID = strings.TrimSpace(v.ClientID)
+	return v, v.Enabled && v.Issuer != "" && v.ClientID != "", nil
+}
+
+// Get returns a client for the configured provider, running discovery when
+// needed. ok is false when single sign-on is not enabled.
+func (p *OIDCProvider) Get(ctx context.Context) (*oidc.Client, *OIDCSettings, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.lastLoad.IsZero() && time.Since(p.lastLoad) < oidcCacheTTL && p.lastErr == nil {
+		cfg := p.lastCfg
+		return p.lastCli, &cfg, p.lastCli != nil, nil
+	}
+	p.lastLoad = time.Now()
+	p.lastCli, p.lastErr = nil, nil
+
+	cfg, ok, err := LoadOIDCSettings(ctx, p.Settings)
+	if err != nil || !ok {
+		p.lastErr = err
+		return nil, nil, false, err
+	}
+	secret := ""
+	if sec, ok, err := p.Settings.GetSecret(ctx, KeyOIDCClientSecret); err != nil {
+		p.lastErr = err
+		return nil, nil, false, err
+	} else if ok {
+		secret = strings.TrimSpace(string(sec))
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	cli, err := oidc.Discover(ctx, nil, oidc.Config{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: secret,
+		Scopes:       scopes,
+		GroupsClaim:  cfg.GroupsClaim,
+	})
+	if err != nil {
+		// Not cached, so a provider that was down is retried on the next login.
+		p.lastErr = err
+		return nil, nil, false, err
+	}
+	p.lastCfg, p.lastCli = cfg, cli
+	return cli, &cfg, true, nil
+}
+
+func (p *OIDCProvider) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastLoad = time.Time{}
+	p.lastCli = nil
+	p.lastErr = nil
+}
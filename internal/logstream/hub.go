@@ -0,0 +1,131 @@
+// Package logstream wakes deployment log streams when Postgres reports new
+// log chunks or a status change (see the deployment_logs NOTIFY triggers).
+package logstream
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Channel is the Postgres notification channel; payloads are deployment ids.
+const Channel = "deployment_logs"
+
+const maxBackoff = 30 * time.Second
+
+// Hub holds one LISTEN connection and fans notifications out to subscribers
+// by deployment id.
+type Hub struct {
+	dsn       string
+	connected atomic.Bool
+
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+}
+
+func NewHub(dsn string) *Hub {
+	return &Hub{dsn: dsn, subs: map[string]map[chan struct{}]struct{}{}}
+}
+
+// Subscribe returns a channel that receives a value whenever deploymentID has
+// new logs or a new status. Notifications coalesce: a slow reader sees one
+// pending wake-up, not one per chunk. Call cancel when done.
+func (h *Hub) Subscribe(deploymentID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	if h.subs[deploymentID] == nil {
+		h.subs[deploymentID] = map[chan struct{}]struct{}{}
+	}
+	h.subs[deploymentID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[deploymentID], ch)
+		if len(h.subs[deploymentID]) == 0 {
+			delete(h.subs, deploymentID)
+		}
+	}
+}
+
+// Connected reports whether the hub is currently listening. While it is not,
+// subscribers only wake on reconnect and should poll.
+func (h *Hub) Connected() bool {
+	return h.connected.Load()
+}
+
+// Notify wakes deploymentID's subscribers.
+func (h *Hub) Notify(deploymentID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[deploymentID] {
+		wake(ch)
+	}
+}
+
+// wakeAll wakes every subscriber, e.g. after a reconnect, when notifications
+// may have been missed.
+func (h *Hub) wakeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, chans := range h.subs {
+		for ch := range chans {
+			wake(ch)
+		}
+	}
+}
+
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Run listens until ctx is done, reconnecting with backoff.
+func (h *Hub) Run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := h.listen(ctx)
+		h.connected.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("logstream: %v", err)
+		if time.Since(start) > maxBackoff {
+			backoff = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (h *Hub) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, h.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+	h.connected.Store(true)
+	h.wakeAll()
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		h.Notify(n.Payload)
+	}
+}
@@ -0,0 +1,41 @@
+package logstream
+
+import "testing"
+
+func TestHubNotify(t *testing.T) {
+	h := NewHub("")
+	a, cancelA := h.Subscribe("d1")
+	b, cancelB := h.Subscribe("d2")
+	defer cancelB()
+
+	// Several notifications coalesce into one pending wake-up.
+	h.Notify("d1")
+	h.Notify("d1")
+	select {
+	case <-a:
+	default:
+		t.Fatal("d1 subscriber not woken")
+	}
+	select {
+	case <-a:
+		t.Fatal("notifications did not coalesce")
+	case <-b:
+		t.Fatal("d2 subscriber woken by d1 notification")
+	default:
+	}
+
+	h.wakeAll()
+	<-a
+	<-b
+
+	cancelA()
+	h.Notify("d1")
+	select {
+	case <-a:
+		t.Fatal("woken after cancel")
+	default:
+	}
+	if _, ok := h.subs["d1"]; ok {
+		t.Fatal("empty subscriber set not removed")
+	}
+}
@@ -0,0 +1,288 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeProvider is a stand-in OpenID provider: it "signs the user in" for any
+// authorization request and issues ID tokens with the claims set on it.
+type fakeProvider struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	kid     string
+	key     any // *rsa.PrivateKey or *ecdsa.PrivateKey
+	method  jwt.SigningMethod
+	claims  jwt.MapClaims
+	codes   map[string]authRequest
+	jwksHit int
+}
+
+type authRequest struct {
+	challenge, nonce, redirectURI string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	p := &fakeProvider{t: t, codes: map[string]authRequest{}}
+	p.rotateRSA("key-1")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 p.srv.URL,
+			"authorization_endpoint": p.srv.URL + "/authorize",
+			"token_endpoint":         p.srv.URL + "/token",
+			"jwks_uri":               p.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.jwksHit++
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []any{p.publicJWK()}})
+	})
+	mux.HandleFunc("/token", p.handleToken)
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+func (p *fakeProvider) rotateRSA(kid string) {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.kid, p.key, p.method = kid, k, jwt.SigningMethodRS256
+	p.mu.Unlock()
+}
+
+func (p *fakeProvider) useEC(kid string) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.kid, p.key, p.method = kid, k, jwt.SigningMethodES256
+	p.mu.Unlock()
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func (p *fakeProvider) publicJWK() map[string]any {
+	switch k := p.key.(type) {
+	case *rsa.PrivateKey:
+		return map[string]any{"kty": "RSA", "kid": p.kid, "use": "sig", "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PrivateKey:
+		return map[string]any{"kty": "EC", "kid": p.kid, "crv": "P-256", "x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))}
+	}
+	return nil
+}
+
+// authorize plays the browser: it follows the authorization URL and returns
+// the code the provider would redirect back with.
+func (p *fakeProvider) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || !strings.Contains(q.Get("scope"), "openid") {
+		p.t.Fatalf("bad authorization request %s", authURL)
+	}
+	code := "code-" + q.Get("state")
+	p.mu.Lock()
+	p.codes[code] = authRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri")}
+	p.mu.Unlock()
+	return code
+}
+
+func (p *fakeProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+	if id, secret, ok := r.BasicAuth(); !ok || id != "opencel" || secret != "s3cret" {
+		w.WriteHeader(401)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "invalid_client"})
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ar, ok := p.codes[r.Form.Get("code")]
+	delete(p.codes, r.Form.Get("code"))
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || b64(sum[:]) != ar.challenge || r.Form.Get("redirect_uri") != ar.redirectURI {
+		w.WriteHeader(400)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "invalid_grant"})
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss":   p.srv.URL,
+		"aud":   "opencel",
+		"sub":   "user-123",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": ar.nonce,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"id_token": p.sign(claims), "access_token": "at"})
+}
+
+func (p *fakeProvider) sign(claims jwt.MapClaims) string {
+	tok := jwt.NewWithClaims(p.method, claims)
+	tok.Header["kid"] = p.kid
+	s, err := tok.SignedString(p.key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return s
+}
+
+func (p *fakeProvider) client(t *testing.T) *Client {
+	t.Helper()
+	c, err := Discover(context.Background(), p.srv.Client(), Config{
+		Issuer:       p.srv.URL,
+		ClientID:     "opencel",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"email", "profile"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// login runs the code flow and returns the verified claims.
+func (p *fakeProvider) login(c *Client) (*Claims, error) {
+	const redirect = "https://opencel.example/api/auth/oidc/callback"
+	verifier := "verifier-" + strings.Repeat("x", 40)
+	sum := sha256.Sum256([]byte(verifier))
+	code := p.authorize(c.AuthCodeURL(redirect, "state1", "nonce1", b64(sum[:])))
+	raw, err := c.Exchange(context.Background(), redirect, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	return c.VerifyIDToken(context.Background(), raw, "nonce1")
+}
+
+func TestCodeFlow(t *testing.T) {
+	p := newFakeProvider(t)
+	p.claims = jwt.MapClaims{
+		"email":              "ada@example.com",
+		"email_verified":     true,
+		"preferred_username": "ada",
+		"groups":             []string{"/engineering", "admins"},
+	}
+	c := p.client(t)
+	cl, err := p.login(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.Subject != "user-123" || cl.Email != "ada@example.com" || !cl.EmailVerified || cl.PreferredUsername != "ada" {
+		t.Fatalf("claims = %+v", cl)
+	}
+	if len(cl.Groups) != 2 || cl.Groups[0] != "/engineering" {
+		t.Fatalf("groups = %v", cl.Groups)
+	}
+}
+
+func TestPKCEVerifierMustMatch(t *testing.T) {
+	p := newFakeProvider(t)
+	c := p.client(t)
+	const redirect = "https://opencel.example/cb"
+	code := p.authorize(c.AuthCodeURL(redirect, "s", "n", "not-the-challenge"))
+	if _, err := c.Exchange(context.Background(), redirect, code, "verifier"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	p := newFakeProvider(t)
+	c := p.client(t)
+	base := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": p.srv.URL, "aud": "opencel", "sub": "u", "nonce": "n",
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+		}
+	}
+	if _, err := c.VerifyIDToken(context.Background(), p.sign(base()), "n"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	for name, mutate := range map[string]func(jwt.MapClaims){
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"wrong nonce":    func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+		"foreign azp":    func(c jwt.MapClaims) { c["aud"] = []string{"opencel", "other"}; c["azp"] = "other" },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+	} {
+		cl := base()
+		mutate(cl)
+		if _, err := c.VerifyIDToken(context.Background(), p.sign(cl), "n"); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	// Signed by a key the provider never published.
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, base())
+	tok.Header["kid"] = p.kid
+	forged, _ := tok.SignedString(other)
+	if _, err := c.VerifyIDToken(context.Background(), forged, "n"); err == nil {
+		t.Error("forged signature accepted")
+	}
+	// alg none / HMAC must never be accepted.
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, base())
+	hsTok, _ := hs.SignedString([]byte("opencel"))
+	if _, err := c.VerifyIDToken(context.Background(), hsTok, "n"); err == nil {
+		t.Error("HS256 token accepted")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	p := newFakeProvider(t)
+	c := p.client(t)
+	if _, err := p.login(c); err != nil {
+		t.Fatal(err)
+	}
+	// The provider rotates to an EC key; the unknown kid triggers a refetch,
+	// once the refresh interval allows it.
+	p.useEC("key-2")
+	c.mu.Lock()
+	c.keysLoaded = time.Now().Add(-2 * jwksRefreshInterval)
+	c.mu.Unlock()
+	if _, err := p.login(c); err != nil {
+		t.Fatalf("after rotation: %v", err)
+	}
+	if p.jwksHit != 2 {
+		t.Fatalf("jwks fetched %d times, want 2", p.jwksHit)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	p := newFakeProvider(t)
+	// Same server under another name: the document names a different issuer.
+	alias := strings.Replace(p.srv.URL, "127.0.0.1", "localhost", 1)
+	_, err := Discover(context.Background(), p.srv.Client(), Config{Issuer: alias, ClientID: "opencel"})
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -5,15 +5,42 @@ import (
 )
 
 const (
-	TaskBuildDeploy   = "build_deploy"
-	TaskApplySettings = "apply_settings"
-	TaskSelfUpdate    = "self_update"
+	TaskBuildDeploy     = "build_deploy"
+	TaskTeardownPreview = "teardown_preview"
+	TaskRollback        = "rollback"
+	TaskPromote         = "promote"
+	TaskRedeploy        = "redeploy"
+	TaskCollectGarbage  = "collect_garbage"
+	TaskApplySettings   = "apply_settings"
+	TaskSelfUpdate      = "self_update"
 )
 
 type BuildDeployPayload struct {
 	DeploymentID string `json:"deployment_id"`
 }
 
+type TeardownPreviewPayload struct {
+	ProjectID string `json:"project_id"`
+	PRNumber  int    `json:"pr_number"`
+}
+
+type RollbackPayload struct {
+	DeploymentID string `json:"deployment_id"`
+	// ActorUserID is the user who asked for it, recorded on its events.
+	ActorUserID string `json:"actor_user_id,omitempty"`
+}
+
+type PromotePayload struct {
+	DeploymentID string `json:"deployment_id"`
+	ActorUserID  string `json:"actor_user_id,omitempty"`
+}
+
+type RedeployPayload struct {
+	DeploymentID       string `json:"deployment_id"`
+	SourceDeploymentID string `json:"source_deployment_id"`
+	ActorUserID        string `json:"actor_user_id,omitempty"`
+}
+
 type AdminJobPayload struct {
 	JobID string `json:"job_id"`
 }
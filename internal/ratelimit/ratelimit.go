@@ -0,0 +1,129 @@
+// Package ratelimit keeps request counters and login lockouts in Redis, so
+// every API replica sees the same limits.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "opencel:ratelimit:"
+
+type Limiter struct {
+	rdb redis.UniversalClient
+}
+
+func New(rdb redis.UniversalClient) *Limiter {
+	return &Limiter{rdb: rdb}
+}
+
+// Result is the outcome of a counted hit.
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the window resets, when not allowed.
+	RetryAfter time.Duration
+}
+
+// allowScript counts a hit in a fixed window and returns the count and the
+// window's remaining time.
+var allowScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[1])
+  ttl = tonumber(ARGV[1])
+end
+return {n, ttl}
+`)
+
+// Allow counts a hit against key and reports whether it is within limit hits
+// per window.
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	v, err := allowScript.Run(ctx, l.rdb, []string{keyPrefix + "hits:" + key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(v) != 2 {
+		return Result{}, errors.New("ratelimit: unexpected script reply")
+	}
+	n, ttl := int(v[0]), time.Duration(v[1])*time.Millisecond
+	if n > limit {
+		return Result{RetryAfter: ttl}, nil
+	}
+	return Result{Allowed: true, Remaining: limit - n}, nil
+}
+
+// Lockout locks a key (an account) out after repeated failures. Each lockout
+// within Decay of the last one lasts twice as long, up to Max.
+type Lockout struct {
+	Threshold int           // failures within Window that lock
+	Window    time.Duration // how long failures are counted
+	Base      time.Duration // first lockout
+	Max       time.Duration
+	Decay     time.Duration // how long the escalation level is remembered
+}
+
+// Duration is the length of the level-th consecutive lockout (from 1).
+func (p Lockout) Duration(level int) time.Duration {
+	d := p.Base
+	for i := 1; i < level && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+// failScript counts a failure; when the count reaches the threshold it resets
+// it and returns the new escalation level, else 0.
+var failScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[2]) end
+if n < tonumber(ARGV[1]) then return 0 end
+redis.call('DEL', KEYS[1])
+local lvl = redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return lvl
+`)
+
+func failsKey(key string) string { return keyPrefix + "fails:" + key }
+func levelKey(key string) string { return keyPrefix + "level:" + key }
+func lockKey(key string) string  { return keyPrefix + "lock:" + key }
+
+// Locked returns how much longer key is locked out, or 0.
+func (l *Limiter) Locked(ctx context.Context, key string) (time.Duration, error) {
+	d, err := l.rdb.PTTL(ctx, lockKey(key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	// Negative values mean no key or no expiry.
+	return max(d, 0), nil
+}
+
+// Fail records a failure for key. If it locks key out, it returns the
+// lockout's length and escalation level.
+func (l *Limiter) Fail(ctx context.Context, p Lockout, key string) (lockedFor time.Duration, level int, err error) {
+	lvl, err := failScript.Run(ctx, l.rdb, []string{failsKey(key), levelKey(key)},
+		p.Threshold, p.Window.Milliseconds(), p.Decay.Milliseconds()).Int()
+	if err != nil || lvl == 0 {
+		return 0, 0, err
+	}
+	d := p.Duration(lvl)
+	if err := l.rdb.Set(ctx, lockKey(key), lvl, d).Err(); err != nil {
+		return 0, 0, err
+	}
+	return d, lvl, nil
+}
+
+// Reset clears key's failure count after a success. The escalation level is
+// kept until it decays, so a lockout right after is still longer.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.rdb.Del(ctx, failsKey(key)).Err()
+}
+
+// Unlock lifts a lockout and forgets its history.
+func (l *Limiter) Unlock(ctx context.Context, key string) error {
+	return l.rdb.Del(ctx, failsKey(key), levelKey(key), lockKey(key)).Err()
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	p := Lockout{Base: time.Minute, Max: time.Hour}
+	for level, want := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		3:  4 * time.Minute,
+		6:  32 * time.Minute,
+		7:  time.Hour,
+		50: time.Hour,
+	} {
+		if got := p.Duration(level); got != want {
+			t.Errorf("level %d: got %s, want %s", level, got, want)
+		}
+	}
+}
+
+// testLimiter connects to OPENCEL_TEST_REDIS_ADDR, skipping without it.
+func testLimiter(t *testing.T) *Limiter {
+	t.Helper()
+	addr := os.Getenv("OPENCEL_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("OPENCEL_TEST_REDIS_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { _ = rdb.Close() })
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("redis: %v", err)
+	}
+	return New(rdb)
+}
+
+func TestAllow(t *testing.T) {
+	l := testLimiter(t)
+	ctx := context.Background()
+	key := "test:allow:" + time.Now().Format(time.RFC3339Nano)
+	for i := 0; i < 3; i++ {
+		res, err := l.Allow(ctx, key, 3, time.Minute)
+		if err != nil || !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("hit %d: %+v %v", i+1, res, err)
+		}
+	}
+	res, err := l.Allow(ctx, key, 3, time.Minute)
+	if err != nil || res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > time.Minute {
+		t.Fatalf("over limit: %+v %v", res, err)
+	}
+}
+
+func TestFailEscalates(t *testing.T) {
+	l := testLimiter(t)
+	ctx := context.Background()
+	key := "test:fail:" + time.Now().Format(time.RFC3339Nano)
+	t.Cleanup(func() { _ = l.Unlock(ctx, key) })
+	p := Lockout{Threshold: 2, Window: time.Minute, Base: time.Second, Max: time.Minute, Decay: time.Hour}
+
+	if d, _, err := l.Fail(ctx, p, key); err != nil || d != 0 {
+		t.Fatalf("first failure locked: %s %v", d, err)
+	}
+	d, lvl, err := l.Fail(ctx, p, key)
+	if err != nil || d != time.Second || lvl != 1 {
+		t.Fatalf("second failure: %s %d %v", d, lvl, err)
+	}
+	if left, err := l.Locked(ctx, key); err != nil || left <= 0 {
+		t.Fatalf("not locked: %s %v", left, err)
+	}
+	_, _, _ = l.Fail(ctx, p, key)
+	if d, lvl, _ := l.Fail(ctx, p, key); d != 2*time.Second || lvl != 2 {
+		t.Fatalf("second lockout: %s %d", d, lvl)
+	}
+	if err := l.Unlock(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := l.Locked(ctx, key); left != 0 {
+		t.Fatalf("still locked after Unlock: %s", left)
+	}
+}
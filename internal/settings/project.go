@@ -0,0 +1,148 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/opencel/opencel/internal/config"
+	"github.com/opencel/opencel/internal/db"
+)
+
+// Project is the typed view of project_settings.settings_json. Zero values mean
+// "use the instance default".
+type Project struct {
+	// RootDir is the app's directory inside the repository (monorepos).
+	RootDir string `json:"root_dir,omitempty"`
+	// BuildPreset forces a build type instead of detecting it; see BuildPresets.
+	BuildPreset string `json:"build_preset,omitempty"`
+	// Branch is a comma-separated list of glob patterns; pushes to other
+	// branches are not deployed. Empty means every branch.
+	Branch string `json:"branch,omitempty"`
+
+	HealthCheckPath           string `json:"health_check_path,omitempty"`
+	HealthCheckTimeoutSeconds int    `json:"health_check_timeout_seconds,omitempty"`
+
+	// AutoPromote moves production to each production deployment once it is READY.
+	AutoPromote bool `json:"auto_promote"`
+	// CancelSupersededBuilds cancels a ref's in-flight builds when a newer commit is pushed to it.
+	CancelSupersededBuilds bool `json:"cancel_superseded_builds"`
+
+	// PreviewRetention is how many deployments per git ref survive garbage collection.
+	PreviewRetention int `json:"preview_retention,omitempty"`
+
+	// Resources overrides the instance's container and build limits.
+	Resources Resources `json:"resources,omitzero"`
+}
+
+// LoadProject returns the project's settings, or an empty Project if none are stored.
+func LoadProject(ctx context.Context, store *db.Store, projectID string) (*Project, error) {
+	b, err := store.GetProjectSettingsJSON(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	var p Project
+	if len(b) == 0 {
+		return &p, nil
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func SaveProject(ctx context.Context, store *db.Store, projectID string, p *Project) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return store.UpsertProjectSettingsJSON(ctx, projectID, b)
+}
+
+// HealthCheck returns the effective promotion health check path and timeout.
+func (p *Project) HealthCheck(cfg *config.Config) (string, time.Duration) {
+	path := strings.TrimSpace(p.HealthCheckPath)
+	if path == "" {
+		path = cfg.HealthCheckPath
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	timeout := cfg.HealthCheckTimeout
+	if p.HealthCheckTimeoutSeconds > 0 {
+		timeout = time.Duration(p.HealthCheckTimeoutSeconds) * time.Second
+	}
+	return path, timeout
+}
+
+// Retention returns the effective number of deployments kept per git ref.
+func (p *Project) Retention(cfg *config.Config) int {
+	if p.PreviewRetention > 0 {
+		return p.PreviewRetention
+	}
+	return cfg.PreviewRetention
+}
+
+// BuildPresets are the build_preset values the worker understands. "auto" (or
+// empty) detects the build type from the repository.
+var BuildPresets = []string{"auto", "docker", "nextjs", "astro", "vite", "node", "go", "python", "static"}
+
+func ValidBuildPreset(v string) bool {
+	return v == "" || contains(BuildPresets, v)
+}
+
+// CleanRootDir normalizes a repository-relative root_dir. "", "." and "./" all
+// mean the repository root and come back as "". Absolute paths and paths that
+// climb out of the repository are rejected.
+func CleanRootDir(v string) (string, error) {
+	v = strings.TrimSpace(strings.ReplaceAll(v, "\\", "/"))
+	if v == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(v, "/") {
+		return "", fmt.Errorf("root_dir must be relative to the repository root")
+	}
+	c := path.Clean(v)
+	if c == ".." || strings.HasPrefix(c, "../") {
+		return "", fmt.Errorf("root_dir must stay inside the repository")
+	}
+	if c == "." {
+		return "", nil
+	}
+	return c, nil
+}
+
+// BranchPatterns splits a branch filter into its glob patterns and checks them.
+func BranchPatterns(filter string) ([]string, error) {
+	var out []string
+	for _, p := range strings.Split(filter, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid branch pattern %q", p)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// BranchAllowed reports whether pushes to branch should be deployed. Patterns
+// use path.Match syntax, so "*" does not cross "/": use "feature/*" for
+// feature/x. An empty filter allows every branch.
+func (p *Project) BranchAllowed(branch string) bool {
+	pats, err := BranchPatterns(p.Branch)
+	if err != nil || len(pats) == 0 {
+		return true
+	}
+	for _, pat := range pats {
+		if ok, _ := path.Match(pat, branch); ok {
+			return true
+		}
+	}
+	return false
+}
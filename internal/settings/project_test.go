@@ -0,0 +1,113 @@
+package settings
+
+import (
+	"testing"
+
+	"github.com/opencel/opencel/internal/config"
+)
+
+func TestCleanRootDir(t *testing.T) {
+	cases := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"", "", true},
+		{".", "", true},
+		{"./", "", true},
+		{"apps/web/", "apps/web", true},
+		{"./apps//web", "apps/web", true},
+		{"apps/../web", "web", true},
+		{"/etc", "", false},
+		{"..", "", false},
+		{"apps/../../x", "", false},
+	}
+	for _, c := range cases {
+		got, err := CleanRootDir(c.in)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("CleanRootDir(%q) = %q, %v; want %q, ok=%v", c.in, got, err, c.want, c.ok)
+		}
+	}
+}
+
+func TestBranchAllowed(t *testing.T) {
+	p := &Project{Branch: "main, release/*"}
+	for branch, want := range map[string]bool{
+		"main":          true,
+		"release/1.2":   true,
+		"release/1/fix": false,
+		"feature/x":     false,
+	} {
+		if got := p.BranchAllowed(branch); got != want {
+			t.Errorf("BranchAllowed(%q) = %v, want %v", branch, got, want)
+		}
+	}
+	if !(&Project{}).BranchAllowed("anything") {
+		t.Error("empty filter should allow every branch")
+	}
+}
+
+func TestResourcesEffective(t *testing.T) {
+	cfg := &config.Config{
+		ContainerMemoryMB: 1024, ContainerCPUs: 1, ContainerPidsLimit: 512,
+		ContainerRestart: "unless-stopped", ContainerReadOnly: true,
+		BuildMemoryMB: 4096, BuildCPUs: 2,
+	}
+	on := true
+	got := Resources{MemoryMB: 256, ReadOnlyRootFS: &on}.Effective(cfg)
+	if got.MemoryMB != 256 || got.CPUs != 1 || got.PidsLimit != 512 || got.RestartPolicy != "unless-stopped" ||
+		!*got.ReadOnlyRootFS || got.BuildMemoryMB != 4096 || got.BuildCPUs != 2 {
+		t.Fatalf("unexpected effective resources: %+v", got)
+	}
+	if !*(Resources{}).Effective(cfg).ReadOnlyRootFS {
+		t.Fatal("read_only_root_fs should default to the instance setting")
+	}
+	// Overrides saved before the instance limits were lowered are capped.
+	off := false
+	got = Resources{MemoryMB: 8192, CPUs: 64, PidsLimit: 100000, ReadOnlyRootFS: &off, BuildMemoryMB: 65536, BuildCPUs: 32}.Effective(cfg)
+	if got.MemoryMB != 1024 || got.CPUs != 1 || got.PidsLimit != 512 || !*got.ReadOnlyRootFS || got.BuildMemoryMB != 4096 || got.BuildCPUs != 2 {
+		t.Fatalf("overrides above the instance limits: %+v", got)
+	}
+	// Zero instance limits are unlimited.
+	got = Resources{MemoryMB: 8192, ReadOnlyRootFS: &on}.Effective(&config.Config{})
+	if got.MemoryMB != 8192 || got.CPUs != 0 || !*got.ReadOnlyRootFS {
+		t.Fatalf("unlimited instance: %+v", got)
+	}
+}
+
+func TestResourcesValidate(t *testing.T) {
+	cfg := &config.Config{
+		ContainerMemoryMB: 1024, ContainerCPUs: 1, ContainerPidsLimit: 512,
+		ContainerReadOnly: true, BuildMemoryMB: 4096, BuildCPUs: 2,
+	}
+	off := false
+	for _, r := range []Resources{
+		{MemoryMB: 8},
+		{CPUs: -1},
+		{PidsLimit: -5},
+		{RestartPolicy: "sometimes"},
+		// Above the instance limits.
+		{MemoryMB: 2048},
+		{CPUs: 256},
+		{PidsLimit: 513},
+		{BuildMemoryMB: 8192},
+		{BuildCPUs: 2.5},
+		{ReadOnlyRootFS: &off},
+	} {
+		if err := r.Validate(cfg); err == nil {
+			t.Errorf("Validate(%+v) accepted invalid resources", r)
+		}
+	}
+	r := Resources{RestartPolicy: " Always ", MemoryMB: 512}
+	if err := r.Validate(cfg); err != nil || r.RestartPolicy != "always" {
+		t.Fatalf("Validate = %v, restart_policy %q", err, r.RestartPolicy)
+	}
+	r = Resources{MemoryMB: 1024, CPUs: 1, PidsLimit: 512, BuildMemoryMB: 4096, BuildCPUs: 2}
+	if err := r.Validate(cfg); err != nil {
+		t.Fatalf("Validate at the instance limits = %v", err)
+	}
+	// Without instance limits only the sanity bounds apply.
+	r = Resources{MemoryMB: 65536, CPUs: 64, ReadOnlyRootFS: &off}
+	if err := r.Validate(&config.Config{}); err != nil {
+		t.Fatalf("Validate without instance limits = %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package settings
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opencel/opencel/internal/config"
+)
+
+// RestartPolicies are the docker restart policies a project may pick.
+var RestartPolicies = config.RestartPolicies
+
+// Resources limits a project's containers and builds. In project settings,
+// zero values (and a nil ReadOnlyRootFS) mean "use the instance default";
+// in Effective results a zero limit means unlimited. The instance limits are
+// also ceilings: projects may lower them but not raise them, and may not turn
+// off a read-only root filesystem the instance enforces.
+type Resources struct {
+	MemoryMB       int     `json:"memory_mb,omitempty"`
+	CPUs           float64 `json:"cpus,omitempty"`
+	PidsLimit      int     `json:"pids_limit,omitempty"`
+	RestartPolicy  string  `json:"restart_policy,omitempty"`
+	ReadOnlyRootFS *bool   `json:"read_only_root_fs,omitempty"`
+
+	BuildMemoryMB int     `json:"build_memory_mb,omitempty"`
+	BuildCPUs     float64 `json:"build_cpus,omitempty"`
+}
+
+// Effective fills unset fields from the instance defaults. Overrides saved
+// above the instance limits, e.g. before those were lowered, are capped.
+func (r Resources) Effective(cfg *config.Config) Resources {
+	out := r
+	out.MemoryMB = capLimit(out.MemoryMB, cfg.ContainerMemoryMB)
+	out.CPUs = capLimit(out.CPUs, cfg.ContainerCPUs)
+	out.PidsLimit = capLimit(out.PidsLimit, cfg.ContainerPidsLimit)
+	if out.RestartPolicy == "" {
+		out.RestartPolicy = cfg.ContainerRestart
+	}
+	if out.ReadOnlyRootFS == nil || cfg.ContainerReadOnly {
+		ro := cfg.ContainerReadOnly
+		out.ReadOnlyRootFS = &ro
+	}
+	out.BuildMemoryMB = capLimit(out.BuildMemoryMB, cfg.BuildMemoryMB)
+	out.BuildCPUs = capLimit(out.BuildCPUs, cfg.BuildCPUs)
+	return out
+}
+
+// capLimit returns the project's limit v, or the instance's limit max if v is
+// unset or above it. A zero max is unlimited.
+func capLimit[T int | float64](v, max T) T {
+	if v == 0 || (max != 0 && v > max) {
+		return max
+	}
+	return v
+}
+
+// Validate checks a project's resource overrides against the instance limits
+// in cfg.
+func (r *Resources) Validate(cfg *config.Config) error {
+	r.RestartPolicy = strings.ToLower(strings.TrimSpace(r.RestartPolicy))
+	switch {
+	case r.MemoryMB != 0 && r.MemoryMB < 16:
+		return fmt.Errorf("resources.memory_mb must be at least 16")
+	case r.BuildMemoryMB != 0 && r.BuildMemoryMB < 64:
+		return fmt.Errorf("resources.build_memory_mb must be at least 64")
+	case r.CPUs < 0 || r.CPUs > 256 || r.BuildCPUs < 0 || r.BuildCPUs > 256:
+		return fmt.Errorf("resources.cpus and resources.build_cpus must be between 0 and 256")
+	case r.PidsLimit < 0:
+		return fmt.Errorf("resources.pids_limit must not be negative")
+	case r.RestartPolicy != "" && !contains(RestartPolicies, r.RestartPolicy):
+		return fmt.Errorf("resources.restart_policy must be one of %s", strings.Join(RestartPolicies, ", "))
+	}
+	for _, l := range []struct {
+		name   string
+		v, max float64
+	}{
+		{"memory_mb", float64(r.MemoryMB), float64(cfg.ContainerMemoryMB)},
+		{"cpus", r.CPUs, cfg.ContainerCPUs},
+		{"pids_limit", float64(r.PidsLimit), float64(cfg.ContainerPidsLimit)},
+		{"build_memory_mb", float64(r.BuildMemoryMB), float64(cfg.BuildMemoryMB)},
+		{"build_cpus", r.BuildCPUs, cfg.BuildCPUs},
+	} {
+		if l.max != 0 && l.v > l.max {
+			return fmt.Errorf("resources.%s must not exceed the instance limit of %g", l.name, l.max)
+		}
+	}
+	if cfg.ContainerReadOnly && r.ReadOnlyRootFS != nil && !*r.ReadOnlyRootFS {
+		return fmt.Errorf("resources.read_only_root_fs cannot be turned off: the instance requires it")
+	}
+	return nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 key.
+func TestRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, tc := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	} {
+		if got := hotp(key, Counter(time.Unix(tc.unix, 0)), 8); got != tc.want {
+			t.Errorf("T=%d: got %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "050471" {
+		t.Fatalf("Code = %s, want the last 6 digits of the RFC vector", code)
+	}
+
+	c, ok := Validate(secret, code, now)
+	if !ok || c != Counter(now) {
+		t.Fatalf("Validate = %d %v", c, ok)
+	}
+	// One step of drift either way is fine, two is not.
+	if _, ok := Validate(secret, code, now.Add(Period*time.Second)); !ok {
+		t.Error("code rejected one step later")
+	}
+	if _, ok := Validate(secret, code, now.Add(2*Period*time.Second)); ok {
+		t.Error("code accepted two steps later")
+	}
+	for _, bad := range []string{"", "12345", "1234567", "000000"} {
+		if _, ok := Validate(secret, bad, now); ok {
+			t.Errorf("accepted %q", bad)
+		}
+	}
+	// Lower case and spaces, as users paste them.
+	if _, ok := Validate(strings.ToLower(secret), "050 471", now); !ok {
+		t.Error("formatting not tolerated")
+	}
+}
+
+func TestNewSecretAndURI(t *testing.T) {
+	s, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 32 {
+		t.Fatalf("secret %q is not 160 bits", s)
+	}
+	uri := URI("OpenCel", "ada@example.com", s)
+	if !strings.HasPrefix(uri, "otpauth://totp/OpenCel:ada@example.com?") || !strings.Contains(uri, "secret="+s) {
+		t.Fatalf("unexpected URI %s", uri)
+	}
+}
@@ -0,0 +1,225 @@
+package traefik
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/opencel/opencel/internal/config"
+	"github.com/opencel/opencel/internal/db"
+	"gopkg.in/yaml.v3"
+)
+
+type traefikDynamic struct {
+	// Traefik v3.6+ file provider can load HTTP config directly from a file when using providers.file.filename.
+	// In that mode, the file should contain `routers:` and `services:` at the root (no `http:` wrapper).
+	// This struct matches dynamic.HTTPConfiguration.
+	Routers  map[string]traefikRouter  `yaml:"routers"`
+	Services map[string]traefikService `yaml:"services"`
+}
+
+type traefikRouter struct {
+	Rule        string   `yaml:"rule"`
+	EntryPoints []string `yaml:"entryPoints"`
+	TLS         any      `yaml:"tls"`
+	Service     string   `yaml:"service"`
+}
+
+type traefikService struct {
+	LoadBalancer traefikLB `yaml:"loadBalancer"`
+}
+
+type traefikLB struct {
+	Servers []traefikServer `yaml:"servers"`
+}
+
+type traefikServer struct {
+	URL string `yaml:"url"`
+}
+
+// Write regenerates the Traefik dynamic config from the database: one
+// production router per project, one stable alias per branch that points at
+// the branch's latest READY deployment, and one router per verified custom
+// domain. The API and the worker both call it; every write reflects the full
+// current state, so the last writer wins.
+func Write(ctx context.Context, cfg *config.Config, store *db.Store) error {
+	projects, err := store.ListProjects(ctx)
+	if err != nil {
+		return err
+	}
+	branchDeps, err := store.ListLatestReadyBranchDeployments(ctx)
+	if err != nil {
+		return err
+	}
+	byProject := map[string][]db.Deployment{}
+	for _, d := range branchDeps {
+		byProject[d.ProjectID] = append(byProject[d.ProjectID], d)
+	}
+
+	dyn := traefikDynamic{
+		Routers:  map[string]traefikRouter{},
+		Services: map[string]traefikService{},
+	}
+	add := func(name, host string, d *db.Deployment) {
+		rt := traefikRouter{
+			Rule:        fmt.Sprintf("Host(\"%s\")", host),
+			EntryPoints: []string{cfg.TraefikEntrypoint},
+			Service:     name,
+		}
+		if cfg.TraefikTLS {
+			if cfg.TraefikCertResolver != "" {
+				rt.TLS = map[string]any{"certResolver": cfg.TraefikCertResolver}
+			} else {
+				rt.TLS = map[string]any{}
+			}
+		}
+		dyn.Routers[name] = rt
+		dyn.Services[name] = traefikService{
+			LoadBalancer: traefikLB{
+				Servers: []traefikServer{
+					{URL: fmt.Sprintf("http://%s:%d", d.ContainerName.String, d.ServicePort)},
+				},
+			},
+		}
+	}
+
+	prodByProject := map[string]*db.Deployment{}
+	branchByProject := map[string]map[string]*db.Deployment{}
+	for _, p := range projects {
+		org, err := store.GetOrganization(ctx, p.OrgID)
+		if err != nil || org == nil {
+			continue
+		}
+
+		branchByProject[p.ID] = map[string]*db.Deployment{}
+		for i := range byProject[p.ID] {
+			d := &byProject[p.ID][i]
+			branch, ok := BranchFromRef(d.GitRef)
+			if !ok || !d.ContainerName.Valid || d.ContainerName.String == "" {
+				continue
+			}
+			branchByProject[p.ID][branch] = d
+			add(aliasRouterName(p.ID, branch), BranchAliasHost(cfg, branch, p.Slug, org.Slug), d)
+		}
+
+		if !p.ProductionDeploymentID.Valid || p.ProductionDeploymentID.String == "" {
+			continue
+		}
+		d, err := store.GetDeployment(ctx, p.ProductionDeploymentID.String)
+		if err != nil || d == nil {
+			continue
+		}
+		if !d.ContainerName.Valid || d.ContainerName.String == "" {
+			continue
+		}
+		prodByProject[p.ID] = d
+		add("prod-"+org.Slug+"-"+p.Slug, ProductionHost(cfg, p.Slug, org.Slug), d)
+	}
+
+	// Verified custom domains follow either production or a branch's latest READY deployment.
+	domains, err := store.ListVerifiedDomains(ctx)
+	if err != nil {
+		return err
+	}
+	for _, dom := range domains {
+		var d *db.Deployment
+		switch dom.Target {
+		case "branch":
+			d = branchByProject[dom.ProjectID][dom.Branch.String]
+		default:
+			d = prodByProject[dom.ProjectID]
+		}
+		if d == nil {
+			continue
+		}
+		// Keyed by ID: "a-b.com" and "a.b.com" reduce to the same DNS-safe string.
+		add("domain-"+dom.ID, dom.Domain, d)
+	}
+
+	b, err := yaml.Marshal(dyn)
+	if err != nil {
+		return err
+	}
+
+	// Atomic write
+	path := cfg.TraefikDynamicPath
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.tmp.%d", path, time.Now().UnixNano())
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// BranchFromRef returns the branch name for refs/heads/* refs.
+func BranchFromRef(ref string) (string, bool) {
+	b, ok := strings.CutPrefix(ref, "refs/heads/")
+	return b, ok && b != ""
+}
+
+// ProductionHost is the built-in production host: <org>-<project>.prod.<base>.
+func ProductionHost(cfg *config.Config, projectSlug, orgSlug string) string {
+	return fmt.Sprintf("%s-%s.prod.%s", orgSlug, projectSlug, cfg.BaseDomain)
+}
+
+// BranchAliasHost is the stable preview host for a branch:
+// <branch>-<project>-<org>.preview.<base>.
+func BranchAliasHost(cfg *config.Config, branch, projectSlug, orgSlug string) string {
+	return fmt.Sprintf("%s.preview.%s", BranchAliasLabel(branch, projectSlug, orgSlug), cfg.BaseDomain)
+}
+
+// aliasRouterName names a branch alias's router and service. Hosts are built
+// from slugs, and different (branch, project, org) tuples can reduce to the
+// same label, so the name comes from the project ID and the raw branch
+// instead; otherwise one alias would silently replace the other.
+func aliasRouterName(projectID, branch string) string {
+	sum := sha256.Sum256([]byte(branch))
+	return "alias-" + projectID + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+var dnsUnsafe = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// maxDNSLabel is the RFC 1035 limit for a single host label.
+const maxDNSLabel = 63
+
+// BranchAliasLabel builds the single DNS label used for a branch alias. Branch
+// names are lowercased and reduced to [a-z0-9-]; when the result would not fit
+// in one label the branch part is shortened and suffixed with a short hash of
+// the original name so distinct branches keep distinct hosts.
+func BranchAliasLabel(branch, projectSlug, orgSlug string) string {
+	b := dnsUnsafe.ReplaceAllString(strings.ToLower(branch), "-")
+	b = strings.Trim(b, "-")
+	if b == "" {
+		b = "branch"
+	}
+	suffix := "-" + projectSlug + "-" + orgSlug
+	if len(b)+len(suffix) <= maxDNSLabel {
+		return b + suffix
+	}
+	sum := sha256.Sum256([]byte(branch))
+	h := hex.EncodeToString(sum[:])[:6]
+	room := maxDNSLabel - len(suffix) - len(h) - 1
+	if room < 1 {
+		// Project and org slugs alone are too long; keep the label unique and valid.
+		return strings.Trim(truncate(h+suffix, maxDNSLabel), "-")
+	}
+	if len(b) > room {
+		b = strings.TrimRight(b[:room], "-")
+	}
+	return b + "-" + h + suffix
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package traefik
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBranchAliasLabel(t *testing.T) {
+	if got := BranchAliasLabel("feature/Login_Page", "web", "acme"); got != "feature-login-page-web-acme" {
+		t.Fatalf("got %q", got)
+	}
+
+	long := "feature/" + strings.Repeat("a", 80)
+	a := BranchAliasLabel(long, "web", "acme")
+	b := BranchAliasLabel(long+"b", "web", "acme")
+	if len(a) > maxDNSLabel || len(b) > maxDNSLabel {
+		t.Fatalf("label exceeds %d chars: %d, %d", maxDNSLabel, len(a), len(b))
+	}
+	if a == b {
+		t.Fatalf("distinct long branches collided: %q", a)
+	}
+	if !strings.HasSuffix(a, "-web-acme") {
+		t.Fatalf("project/org suffix lost: %q", a)
+	}
+}
+
+func TestBranchAliasLabelLongSlugs(t *testing.T) {
+	// A 56-byte suffix leaves no room for the branch; the hash must still fit.
+	for _, n := range []int{27, 30, 60} {
+		proj, org := strings.Repeat("p", n), strings.Repeat("o", n)
+		l := BranchAliasLabel("feature/x", proj, org)
+		if len(l) == 0 || len(l) > maxDNSLabel {
+			t.Fatalf("slugs %d: bad label %q", n, l)
+		}
+	}
+}
+
+func TestAliasRouterNameDistinct(t *testing.T) {
+	// Both reduce to the host label "a-b-c-acme".
+	if BranchAliasLabel("a-b", "c", "acme") != BranchAliasLabel("a", "b-c", "acme") {
+		t.Fatal("expected the labels to collide")
+	}
+	if aliasRouterName("p1", "a-b") == aliasRouterName("p2", "a") {
+		t.Fatal("router names collided")
+	}
+	if aliasRouterName("p1", "feature/x") == aliasRouterName("p1", "feature-x") {
+		t.Fatal("branches reducing to the same label share a router")
+	}
+}
@@ -0,0 +1,273 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/settings"
+	"github.com/opencel/opencel/internal/traefik"
+)
+
+var (
+	builderMu sync.Mutex
+	// buildersInUse counts this process's running builds per builder, so
+	// pruneBuilders leaves them alone.
+	buildersInUse = map[string]int{}
+)
+
+// useBuilder marks name in use until the returned func is called.
+func useBuilder(name string) func() {
+	builderMu.Lock()
+	buildersInUse[name]++
+	builderMu.Unlock()
+	return func() {
+		builderMu.Lock()
+		buildersInUse[name]--
+		builderMu.Unlock()
+	}
+}
+
+// ensureBuilder returns the buildx builder for cached builds under r's build
+// limits, creating it if needed. It runs BuildKit in a container on the host
+// network, so the registry is reachable at RegistryAddr just as it is for the
+// docker daemon.
+func (w *Worker) ensureBuilder(ctx context.Context, r settings.Resources) (string, error) {
+	builderMu.Lock()
+	defer builderMu.Unlock()
+	name := builderName(w.Cfg.BuildxBuilder, r)
+	if exec.CommandContext(ctx, "docker", "buildx", "inspect", name).Run() == nil {
+		return name, nil
+	}
+	args := []string{"buildx", "create", "--name", name, "--driver", "docker-container", "--driver-opt", "network=host"}
+	for _, o := range builderDriverOpts(r) {
+		args = append(args, "--driver-opt", o)
+	}
+	out, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput()
+	if err != nil {
+		// Another worker process may have created it in the meantime.
+		if exec.CommandContext(ctx, "docker", "buildx", "inspect", name).Run() == nil {
+			return name, nil
+		}
+		return "", fmt.Errorf("create buildx builder %s: %v: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return name, nil
+}
+
+// buildCache is where a build imports layer cache from and exports it to.
+type buildCache struct {
+	From     []string
+	To       string
+	Insecure bool // plain-HTTP registry
+}
+
+// buildCacheFor keys the cache by project and branch. A branch's first build
+// falls back to the default branch's cache.
+func (w *Worker) buildCacheFor(p *db.Project, d *db.Deployment) *buildCache {
+	ref := cacheBranch(d.GitRef)
+	c := &buildCache{
+		To:       w.cacheImage(p, d.GitRef),
+		Insecure: strings.HasPrefix(w.Cfg.RegistryAPIURL, "http://"),
+	}
+	c.From = []string{c.To}
+	if p.GitHubDefaultBranch.Valid && p.GitHubDefaultBranch.String != "" && p.GitHubDefaultBranch.String != ref {
+		c.From = append(c.From, w.cacheImage(p, "refs/heads/"+p.GitHubDefaultBranch.String))
+	}
+	return c
+}
+
+// cacheImage is the registry image holding the build cache of p's gitRef.
+func (w *Worker) cacheImage(p *db.Project, gitRef string) string {
+	return fmt.Sprintf("%s/opencel-cache/%s:%s", w.Cfg.RegistryAddr, p.Slug, cacheTag(cacheBranch(gitRef)))
+}
+
+// cacheBranch is the branch name of gitRef, or gitRef without "refs/" for
+// other refs such as pull request heads.
+func cacheBranch(gitRef string) string {
+	if b, ok := traefik.BranchFromRef(gitRef); ok {
+		return b
+	}
+	return strings.TrimPrefix(gitRef, "refs/")
+}
+
+var tagUnsafe = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// maxTag is the length limit of an image tag.
+const maxTag = 128
+
+// cacheTag turns a branch name into an image tag. Long names are shortened
+// and suffixed with a hash so distinct branches keep distinct caches.
+func cacheTag(branch string) string {
+	t := strings.TrimLeft(tagUnsafe.ReplaceAllString(strings.ToLower(branch), "-"), ".-")
+	if t == "" {
+		t = "branch"
+	}
+	if len(t) <= maxTag {
+		return t
+	}
+	sum := sha256.Sum256([]byte(branch))
+	return t[:maxTag-7] + "-" + hex.EncodeToString(sum[:])[:6]
+}
+
+// buildxArgs is dockerBuildArgs run through BuildKit with registry cache. The
+// image is loaded into the local daemon so pushing and running stay the same.
+func buildxArgs(sp *spec, dockerfilePath, imageRef, contextDir, builder string, c *buildCache) []string {
+	args := []string{"buildx", "build", "--builder", builder, "--progress=plain", "--load"}
+	if c != nil {
+		opt := ""
+		if c.Insecure {
+			opt = ",registry.insecure=true"
+		}
+		for _, ref := range c.From {
+			args = append(args, "--cache-from", "type=registry,ref="+ref+opt)
+		}
+		args = append(args, "--cache-to", "type=registry,ref="+c.To+",mode=max"+opt)
+	}
+	return append(args, dockerBuildArgs(sp, dockerfilePath, imageRef, contextDir)[1:]...)
+}
+
+var (
+	// "#7 [build 3/6] RUN npm ci": a Dockerfile step, as opposed to internal
+	// vertices like "#1 [internal] load build definition".
+	stepLine   = regexp.MustCompile(`^#(\d+) \[(?:[^\]\s]+ )?\d+/\d+\]`)
+	cachedLine = regexp.MustCompile(`^#(\d+) CACHED\s*$`)
+)
+
+// cacheStats counts the Dockerfile steps in BuildKit's plain progress output
+// and how many of them were served from cache.
+type cacheStats struct {
+	partial []byte
+	steps   map[string]bool
+	cached  map[string]bool
+}
+
+func newCacheStats() *cacheStats {
+	return &cacheStats{steps: map[string]bool{}, cached: map[string]bool{}}
+}
+
+func (s *cacheStats) Write(p []byte) (int, error) {
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		s.line(string(s.partial[:i]))
+		s.partial = s.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (s *cacheStats) line(l string) {
+	l = strings.TrimRight(l, "\r")
+	if m := stepLine.FindStringSubmatch(l); m != nil {
+		s.steps[m[1]] = true
+	} else if m := cachedLine.FindStringSubmatch(l); m != nil {
+		s.cached[m[1]] = true
+	}
+}
+
+// Result returns the number of steps and of cached steps.
+func (s *cacheStats) Result() (steps, cached int) {
+	if len(s.partial) > 0 {
+		s.line(string(s.partial))
+		s.partial = nil
+	}
+	for id := range s.steps {
+		if s.cached[id] {
+			cached++
+		}
+	}
+	return len(s.steps), cached
+}
+
+// build builds imageRef from sp under r's build limits. With BuildCache on, or
+// with build limits, it goes through a BuildKit builder: `docker build` on the
+// default builder ignores --memory and --cpu-quota once buildx is installed,
+// so only the builder's container can enforce them. With BuildCache on it also
+// uses registry cache and records how many steps were cached. If the builder
+// cannot be set up the build runs uncached on the legacy builder instead of
+// failing.
+func (w *Worker) build(ctx context.Context, d *db.Deployment, p *db.Project, sp *spec, r settings.Resources, dockerfilePath, imageRef, contextDir string) error {
+	limited := r.BuildMemoryMB > 0 || r.BuildCPUs > 0
+	classic := func() error {
+		args := append([]string{"build"}, buildLimitArgs(r)...)
+		args = append(args, dockerBuildArgs(sp, dockerfilePath, imageRef, contextDir)[1:]...)
+		var env []string
+		if limited {
+			// Only the legacy builder applies the limit flags.
+			_ = w.Store.AppendLogChunk(ctx, d.ID, "system", "building with the legacy builder to apply build limits\n")
+			env = []string{"DOCKER_BUILDKIT=0"}
+		}
+		return w.runDockerEnv(ctx, d.ID, "build", nil, env, args...)
+	}
+	if !w.Cfg.BuildCache && !limited {
+		return classic()
+	}
+	builder, err := w.ensureBuilder(ctx, r)
+	if err != nil {
+		_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("buildx builder unavailable, building without it: %v\n", err))
+		return classic()
+	}
+	defer useBuilder(builder)()
+	if !w.Cfg.BuildCache {
+		return w.runDocker(ctx, d.ID, "build", buildxArgs(sp, dockerfilePath, imageRef, contextDir, builder, nil)...)
+	}
+
+	stats := newCacheStats()
+	args := buildxArgs(sp, dockerfilePath, imageRef, contextDir, builder, w.buildCacheFor(p, d))
+	if err := w.runDockerTee(ctx, d.ID, "build", stats, args...); err != nil {
+		return err
+	}
+	steps, cached := stats.Result()
+	_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("build cache: %d of %d steps cached\n", cached, steps))
+	_ = w.Store.SetDeploymentBuildStats(ctx, d.ID, steps, cached)
+	return nil
+}
+
+// pruneBuilders removes the limit-specific buildx builders (see builderName)
+// that no project's current limits use any more, e.g. after a project's build
+// limits changed. The instance default builder is always kept.
+func (w *Worker) pruneBuilders(ctx context.Context, projects []db.Project) error {
+	wanted := map[string]bool{}
+	for i := range projects {
+		ps, err := settings.LoadProject(ctx, w.Store, projects[i].ID)
+		if err != nil {
+			return err
+		}
+		wanted[builderName(w.Cfg.BuildxBuilder, ps.Resources.Effective(w.Cfg))] = true
+	}
+	out, err := exec.CommandContext(ctx, "docker", "buildx", "ls", "--format", "{{.Name}}").Output()
+	if err != nil {
+		return fmt.Errorf("list buildx builders: %v", err)
+	}
+	builderMu.Lock()
+	defer builderMu.Unlock()
+	for _, name := range staleBuilders(strings.Split(string(out), "\n"), w.Cfg.BuildxBuilder, wanted) {
+		if out, err := exec.CommandContext(ctx, "docker", "buildx", "rm", name).CombinedOutput(); err != nil {
+			log.Printf("gc: remove buildx builder %s: %v: %s", name, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// staleBuilders picks the builders named by builderName for base that are
+// neither wanted nor in use. The caller holds builderMu.
+func staleBuilders(names []string, base string, wanted map[string]bool) []string {
+	var out []string
+	for _, n := range names {
+		n = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(n), "*"))
+		if strings.HasPrefix(n, base+"-m") && !wanted[n] && buildersInUse[n] == 0 {
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencel/opencel/internal/config"
+	"github.com/opencel/opencel/internal/db"
+)
+
+const plainProgress = `#0 building with "opencel" instance using docker-container driver
+
+#1 [internal] load build definition from .opencel.Dockerfile
+#1 transferring dockerfile: 412B done
+#1 DONE 0.0s
+
+#2 [internal] load metadata for docker.io/library/node:22-alpine
+#2 DONE 0.8s
+
+#3 importing cache manifest from localhost:5000/opencel-cache/web:main
+#3 DONE 0.1s
+
+#4 [build 1/5] FROM docker.io/library/node:22-alpine@sha256:abc
+#4 CACHED
+
+#5 [build 2/5] WORKDIR /app
+#5 CACHED
+
+#6 [build 3/5] COPY package.json package-lock.json ./
+#6 CACHED
+
+#7 [build 4/5] RUN npm ci
+#7 CACHED
+
+#8 [build 5/5] COPY . .
+#8 DONE 0.3s
+
+#9 [stage-1 2/3] COPY --from=build /app /app
+#9 DONE 1.2s
+`
+
+func TestCacheStats(t *testing.T) {
+	s := newCacheStats()
+	// Split writes mid-line, as pipes do.
+	for _, chunk := range []string{plainProgress[:200], plainProgress[200:]} {
+		if _, err := s.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	steps, cached := s.Result()
+	if steps != 6 || cached != 4 {
+		t.Fatalf("got %d of %d cached, want 4 of 6", cached, steps)
+	}
+}
+
+func TestCacheTag(t *testing.T) {
+	for in, want := range map[string]string{
+		"main":               "main",
+		"feature/Login_Form": "feature-login_form",
+		".hidden":            "hidden",
+		"---":                "branch",
+	} {
+		if got := cacheTag(in); got != want {
+			t.Errorf("cacheTag(%q) = %q, want %q", in, got, want)
+		}
+	}
+	long := strings.Repeat("a", 200)
+	if got := cacheTag(long); len(got) != maxTag || cacheTag(long+"b") == got {
+		t.Errorf("long branch tag %q is not unique or not %d long", got, maxTag)
+	}
+}
+
+func TestBuildxArgs(t *testing.T) {
+	w := &Worker{Cfg: &config.Config{RegistryAddr: "localhost:5000", RegistryAPIURL: "http://registry:5000"}}
+	p := &db.Project{Slug: "web", GitHubDefaultBranch: sql.NullString{String: "main", Valid: true}}
+	d := &db.Deployment{GitRef: "refs/heads/feat/x"}
+
+	got := buildxArgs(&spec{Target: "runtime"}, "/app/Dockerfile", "localhost:5000/opencel/web:1", "/app", "opencel", w.buildCacheFor(p, d))
+	want := []string{
+		"buildx", "build", "--builder", "opencel", "--progress=plain", "--load",
+		"--cache-from", "type=registry,ref=localhost:5000/opencel-cache/web:feat-x,registry.insecure=true",
+		"--cache-from", "type=registry,ref=localhost:5000/opencel-cache/web:main,registry.insecure=true",
+		"--cache-to", "type=registry,ref=localhost:5000/opencel-cache/web:feat-x,mode=max,registry.insecure=true",
+		"-f", "/app/Dockerfile", "-t", "localhost:5000/opencel/web:1", "--target", "runtime", "/app",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("buildxArgs:\n got %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/opencel/opencel/internal/appconfig"
+)
+
+type spec struct {
+	Type        string
+	ServicePort int
+	// Dockerfile is a generated Dockerfile. DockerfilePath is set instead when
+	// the repository brings its own.
+	Dockerfile     string
+	DockerfilePath string
+	BuildArgs      map[string]string
+	Target         string
+	// Files are extra generated files (e.g. nginx config) written into the
+	// build context, keyed by name relative to the app dir.
+	Files map[string]string
+	// Static is set when nginx serves the build, so opencel.json's headers,
+	// redirects and rewrites apply.
+	Static bool
+}
+
+// A detector recognizes one kind of app and knows how to build it. Detectors
+// are tried in registry order, so more specific frameworks come before the
+// generic runtime they are built on.
+type detector struct {
+	name  string
+	match func(a *app) bool
+	spec  func(a *app) (*spec, error)
+}
+
+// detectors is the registry. "static" matches anything and must stay last.
+var detectors = []detector{
+	{name: "nextjs", match: isNextJS, spec: nextJSSpec},
+	{name: "astro", match: isAstro, spec: astroSpec},
+	{name: "vite", match: isVite, spec: viteSpec},
+	{name: "node", match: isNode, spec: nodeSpec},
+	{name: "go", match: isGo, spec: goSpec},
+	{name: "python", match: isPython, spec: pythonSpec},
+	{name: "static", match: func(*app) bool { return true }, spec: staticSpec},
+}
+
+func detectorByName(name string) *detector {
+	for i := range detectors {
+		if detectors[i].name == name {
+			return &detectors[i]
+		}
+	}
+	return nil
+}
+
+// app is what detectors look at: the app directory, its opencel.json and, for
+// JavaScript apps, package.json and the package manager.
+type app struct {
+	dir string
+	cfg *appconfig.Config
+	pkg *packageJSON
+	pm  packageManager
+}
+
+func newApp(dir string, cfg *appconfig.Config) *app {
+	if cfg == nil {
+		cfg = &appconfig.Config{}
+	}
+	a := &app{dir: dir, cfg: cfg}
+	a.pkg = readPackageJSON(dir)
+	a.pm = detectPackageManager(dir)
+	return a
+}
+
+// has reports whether any of the given files exists in the app dir.
+func (a *app) has(names ...string) bool {
+	for _, n := range names {
+		if _, err := os.Stat(filepath.Join(a.dir, n)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// present returns the subset of names that exist, in order.
+func (a *app) present(names ...string) []string {
+	var out []string
+	for _, n := range names {
+		if a.has(n) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// port is opencel.json's port, else def.
+func (a *app) port(def int) int {
+	if a.cfg.Port > 0 {
+		return a.cfg.Port
+	}
+	return def
+}
+
+// specForPreset builds the spec a build_preset forces, or detects it for
+// "auto"/empty. cfg is the app's opencel.json and may be nil.
+func specForPreset(appDir, preset string, cfg *appconfig.Config) (*spec, error) {
+	a := newApp(appDir, cfg)
+	switch preset {
+	case "", "auto":
+		return detectSpec(appDir, a.cfg)
+	case "docker":
+		return dockerfileSpec(appDir, a.cfg)
+	}
+	d := detectorByName(preset)
+	if d == nil {
+		return nil, fmt.Errorf("unknown build preset %q", preset)
+	}
+	return d.spec(a)
+}
+
+func detectSpec(appDir string, cfg *appconfig.Config) (*spec, error) {
+	// Optional explicit config.
+	a := newApp(appDir, cfg)
+	if a.cfg.Dockerfile != "" || a.cfg.Type == "docker" {
+		return dockerfileSpec(appDir, a.cfg)
+	}
+	if a.cfg.Type != "" {
+		if d := detectorByName(a.cfg.Type); d != nil {
+			return d.spec(a)
+		}
+	}
+
+	// A Dockerfile shipped with the app wins over generated ones.
+	if st, err := os.Stat(filepath.Join(appDir, "Dockerfile")); err == nil && st.Mode().IsRegular() {
+		return dockerfileSpec(appDir, a.cfg)
+	}
+
+	for _, d := range detectors {
+		if d.match(a) {
+			return d.spec(a)
+		}
+	}
+	return nil, fmt.Errorf("no detector matched")
+}
+
+// writeSpecFiles writes a spec's generated files into the build context.
+func writeSpecFiles(appDir string, sp *spec) error {
+	names := make([]string, 0, len(sp.Files))
+	for n := range sp.Files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := os.WriteFile(filepath.Join(appDir, n), []byte(sp.Files[n]), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
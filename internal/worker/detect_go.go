@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const defaultGoVersion = "1.24"
+
+func isGo(a *app) bool {
+	return a.has("go.mod")
+}
+
+var goDirective = regexp.MustCompile(`^go\s+(\d+\.\d+)`)
+
+// goVersion returns the major.minor Go version from go.mod's go directive.
+func (a *app) goVersion() string {
+	f, err := os.Open(filepath.Join(a.dir, "go.mod"))
+	if err != nil {
+		return defaultGoVersion
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if m := goDirective.FindStringSubmatch(strings.TrimSpace(sc.Text())); m != nil {
+			return m[1]
+		}
+	}
+	return defaultGoVersion
+}
+
+// goMainPackage finds the package to build: the module root if it has a
+// main.go, else the only directory under cmd/.
+func (a *app) goMainPackage() (string, error) {
+	if a.has("main.go") {
+		return ".", nil
+	}
+	ents, err := os.ReadDir(filepath.Join(a.dir, "cmd"))
+	if err != nil {
+		return "", fmt.Errorf("go: no main.go at the app root and no cmd/ directory")
+	}
+	var cmds []string
+	for _, e := range ents {
+		if e.IsDir() {
+			cmds = append(cmds, e.Name())
+		}
+	}
+	sort.Strings(cmds)
+	switch len(cmds) {
+	case 0:
+		return "", fmt.Errorf("go: cmd/ has no commands")
+	case 1:
+		return "./cmd/" + cmds[0], nil
+	default:
+		return "", fmt.Errorf("go: several commands under cmd/ (%s); add a Dockerfile to pick one", strings.Join(cmds, ", "))
+	}
+}
+
+// goSpec builds a static binary and runs it on alpine; the app should listen on
+// $PORT. opencel.json's startCommand runs instead of the binary, which is on PATH as "app".
+func goSpec(a *app) (*spec, error) {
+	pkg, err := a.goMainPackage()
+	if err != nil {
+		return nil, err
+	}
+	port := a.port(8080)
+	cmd := `["app"]`
+	if a.cfg.StartCommand != "" {
+		cmd = fmt.Sprintf(`["sh", "-c", %q]`, a.cfg.StartCommand)
+	}
+	copyMod := "COPY " + strings.Join(a.present("go.mod", "go.sum"), " ") + " ./"
+	df := fmt.Sprintf(`FROM golang:%s-alpine AS build
+WORKDIR /src
+%s
+RUN go mod download
+COPY . .
+RUN CGO_ENABLED=0 go build -trimpath -o /out/app %s
+
+FROM alpine:3
+RUN apk add --no-cache ca-certificates tzdata
+COPY --from=build /out/app /usr/local/bin/app
+EXPOSE %d
+CMD %s
+`, a.goVersion(), copyMod, pkg, port, cmd)
+	return &spec{Type: "go", ServicePort: port, Dockerfile: df}, nil
+}
@@ -0,0 +1,255 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultNodeVersion = "22"
+
+type packageJSON struct {
+	Main            string            `json:"main"`
+	Scripts         map[string]string `json:"scripts"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+}
+
+func readPackageJSON(dir string) *packageJSON {
+	b, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil
+	}
+	var p packageJSON
+	if err := json.Unmarshal(b, &p); err != nil {
+		// Still a JS app; it just declares nothing we can use.
+		return &packageJSON{}
+	}
+	return &p
+}
+
+func (a *app) hasDep(name string) bool {
+	if a.pkg == nil {
+		return false
+	}
+	_, ok := a.pkg.Dependencies[name]
+	if !ok {
+		_, ok = a.pkg.DevDependencies[name]
+	}
+	return ok
+}
+
+func (a *app) hasScript(name string) bool {
+	return a.pkg != nil && a.pkg.Scripts[name] != ""
+}
+
+// packageManager describes how to install and run scripts with one JS package manager.
+type packageManager struct {
+	Name      string
+	Lockfiles []string
+	Setup     string // Dockerfile lines run before installing, may be empty
+	Install   string
+	Run       string // prefix for running a package.json script
+}
+
+var (
+	pmNPM = packageManager{
+		Name:      "npm",
+		Lockfiles: []string{"package-lock.json", "npm-shrinkwrap.json"},
+		Install:   "npm ci",
+		Run:       "npm run",
+	}
+	pmPNPM = packageManager{
+		Name:      "pnpm",
+		Lockfiles: []string{"pnpm-lock.yaml", "pnpm-workspace.yaml", ".npmrc"},
+		Setup:     "RUN corepack enable",
+		Install:   "pnpm install --frozen-lockfile",
+		Run:       "pnpm run",
+	}
+	pmYarn = packageManager{
+		Name:      "yarn",
+		Lockfiles: []string{"yarn.lock", ".yarnrc.yml", ".yarnrc"},
+		Setup:     "RUN corepack enable",
+		Install:   "yarn install --frozen-lockfile",
+		Run:       "yarn run",
+	}
+	pmBun = packageManager{
+		Name:      "bun",
+		Lockfiles: []string{"bun.lockb", "bun.lock"},
+		Setup:     "RUN npm install -g bun",
+		Install:   "bun install --frozen-lockfile",
+		Run:       "bun run",
+	}
+)
+
+// detectPackageManager picks the package manager from the lockfile present,
+// defaulting to npm.
+func detectPackageManager(dir string) packageManager {
+	a := &app{dir: dir}
+	switch {
+	case a.has("pnpm-lock.yaml"):
+		return pmPNPM
+	case a.has("yarn.lock"):
+		return pmYarn
+	case a.has("bun.lockb", "bun.lock"):
+		return pmBun
+	case a.has("package-lock.json", "npm-shrinkwrap.json"):
+		return pmNPM
+	default:
+		// No lockfile: npm ci would refuse to run.
+		pm := pmNPM
+		pm.Install = "npm install"
+		return pm
+	}
+}
+
+// nodeBuild describes a Node.js image: how to install, build and start the app.
+type nodeBuild struct {
+	PM          packageManager
+	NodeVersion string
+	Install     string
+	Build       string // empty: no build step
+	Start       string
+	Port        int
+	Env         []string // extra ENV lines for the runtime stage, KEY=value
+}
+
+func (a *app) nodeBuild(port int) nodeBuild {
+	b := nodeBuild{
+		PM:          a.pm,
+		NodeVersion: defaultNodeVersion,
+		Install:     a.pm.Install,
+		Port:        a.port(port),
+	}
+	if a.hasScript("build") {
+		b.Build = a.pm.Run + " build"
+	}
+	switch {
+	case a.hasScript("start"):
+		b.Start = a.pm.Run + " start"
+	case a.pkg != nil && a.pkg.Main != "":
+		b.Start = "node " + a.pkg.Main
+	default:
+		b.Start = "node index.js"
+	}
+	return b
+}
+
+// copyManifests is the COPY line that brings in package.json and whichever
+// lockfiles exist, so the install layer is cached across source changes.
+func (a *app) copyManifests() string {
+	files := append([]string{"package.json"}, a.present(a.pm.Lockfiles...)...)
+	return "COPY " + strings.Join(files, " ") + " ./"
+}
+
+// withOverrides applies opencel.json's commands and Node.js version, which
+// win over whatever the spec picked.
+func (a *app) withOverrides(b nodeBuild) nodeBuild {
+	if a.cfg.NodeVersion != "" {
+		b.NodeVersion = a.cfg.NodeVersion
+	}
+	if a.cfg.InstallCommand != "" {
+		b.Install = a.cfg.InstallCommand
+	}
+	if a.cfg.BuildCommand != "" {
+		b.Build = a.cfg.BuildCommand
+	}
+	if a.cfg.StartCommand != "" {
+		b.Start = a.cfg.StartCommand
+	}
+	return b
+}
+
+func (a *app) nodeBuildStage(b nodeBuild) string {
+	b = a.withOverrides(b)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "FROM node:%s-alpine AS build\nWORKDIR /app\n", b.NodeVersion)
+	if b.PM.Setup != "" {
+		sb.WriteString(b.PM.Setup + "\n")
+	}
+	if a.pkg != nil {
+		sb.WriteString(a.copyManifests() + "\n")
+		fmt.Fprintf(&sb, "RUN %s\n", b.Install)
+	}
+	sb.WriteString("COPY . .\n")
+	if b.Build != "" {
+		fmt.Fprintf(&sb, "RUN %s\n", b.Build)
+	}
+	return sb.String()
+}
+
+func (a *app) nodeDockerfile(b nodeBuild) string {
+	b = a.withOverrides(b)
+	var sb strings.Builder
+	sb.WriteString(a.nodeBuildStage(b))
+	fmt.Fprintf(&sb, "\nFROM node:%s-alpine\nWORKDIR /app\nENV NODE_ENV=production\n", b.NodeVersion)
+	for _, e := range b.Env {
+		fmt.Fprintf(&sb, "ENV %s\n", e)
+	}
+	if b.PM.Setup != "" {
+		sb.WriteString(b.PM.Setup + "\n")
+	}
+	sb.WriteString("COPY --from=build /app /app\n")
+	fmt.Fprintf(&sb, "EXPOSE %d\n", b.Port)
+	fmt.Fprintf(&sb, "CMD [\"sh\", \"-c\", %q]\n", b.Start)
+	return sb.String()
+}
+
+func isNextJS(a *app) bool {
+	return a.hasDep("next") || a.has("next.config.js", "next.config.mjs", "next.config.ts")
+}
+
+// nextJSSpec runs `next start`, which listens on $PORT.
+func nextJSSpec(a *app) (*spec, error) {
+	b := a.nodeBuild(3000)
+	if b.Build == "" {
+		b.Build = "npx next build"
+	}
+	if !a.hasScript("start") {
+		b.Start = "npx next start"
+	}
+	return &spec{Type: "nextjs", ServicePort: b.Port, Dockerfile: a.nodeDockerfile(b)}, nil
+}
+
+func isAstro(a *app) bool {
+	return a.hasDep("astro") || a.has("astro.config.mjs", "astro.config.js", "astro.config.ts")
+}
+
+// astroSpec serves the static build with nginx unless the app uses the Node
+// adapter, in which case the standalone server runs on 4321.
+func astroSpec(a *app) (*spec, error) {
+	if a.hasDep("@astrojs/node") {
+		b := a.nodeBuild(4321)
+		if b.Build == "" {
+			b.Build = "npx astro build"
+		}
+		b.Start = "node ./dist/server/entry.mjs"
+		b.Env = []string{"HOST=0.0.0.0"}
+		return &spec{Type: "astro", ServicePort: b.Port, Dockerfile: a.nodeDockerfile(b)}, nil
+	}
+	sp := a.staticBuildSpec("dist", false)
+	sp.Type = "astro"
+	return sp, nil
+}
+
+func isVite(a *app) bool {
+	return a.hasDep("vite") || a.has("vite.config.js", "vite.config.mjs", "vite.config.ts")
+}
+
+// viteSpec serves the built SPA with a fallback to index.html for client routing.
+func viteSpec(a *app) (*spec, error) {
+	sp := a.staticBuildSpec("dist", true)
+	sp.Type = "vite"
+	return sp, nil
+}
+
+func isNode(a *app) bool {
+	return a.pkg != nil
+}
+
+func nodeSpec(a *app) (*spec, error) {
+	b := a.nodeBuild(3000)
+	return &spec{Type: "node", ServicePort: b.Port, Dockerfile: a.nodeDockerfile(b)}, nil
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultPythonVersion = "3.12"
+
+func isPython(a *app) bool {
+	return a.has("requirements.txt", "pyproject.toml", "Pipfile")
+}
+
+// pythonDeps returns the lowercased dependency manifests, for framework sniffing.
+func (a *app) pythonDeps() string {
+	var sb strings.Builder
+	for _, n := range []string{"requirements.txt", "pyproject.toml", "Pipfile"} {
+		if b, err := os.ReadFile(filepath.Join(a.dir, n)); err == nil {
+			sb.WriteString(strings.ToLower(string(b)))
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// pythonEntryModule returns the first of main.py/app.py (as a module name).
+func (a *app) pythonEntryModule() string {
+	for _, m := range []string{"main", "app"} {
+		if a.has(m + ".py") {
+			return m
+		}
+	}
+	return ""
+}
+
+// djangoWSGIModule finds <project>/wsgi.py next to manage.py.
+func (a *app) djangoWSGIModule() string {
+	matches, _ := filepath.Glob(filepath.Join(a.dir, "*", "wsgi.py"))
+	if len(matches) == 0 {
+		return ""
+	}
+	return filepath.Base(filepath.Dir(matches[0])) + ".wsgi"
+}
+
+// pythonSpec installs dependencies with pip and starts the app with the server
+// its framework expects (gunicorn for Django/Flask, uvicorn for FastAPI), bound
+// to $PORT. opencel.json's installCommand and startCommand replace either step.
+func pythonSpec(a *app) (*spec, error) {
+	port := a.port(8000)
+	deps := a.pythonDeps()
+	entry := a.pythonEntryModule()
+
+	var start, extra string
+	switch {
+	case a.cfg.StartCommand != "":
+		start = a.cfg.StartCommand
+	case strings.Contains(deps, "django") && a.has("manage.py"):
+		mod := a.djangoWSGIModule()
+		if mod == "" {
+			return nil, fmt.Errorf("python: Django project without a <project>/wsgi.py")
+		}
+		extra, start = "gunicorn", "gunicorn --bind 0.0.0.0:$PORT "+mod
+	case strings.Contains(deps, "fastapi") && entry != "":
+		extra, start = "uvicorn", "uvicorn "+entry+":app --host 0.0.0.0 --port $PORT"
+	case strings.Contains(deps, "flask") && entry != "":
+		extra, start = "gunicorn", "gunicorn --bind 0.0.0.0:$PORT "+entry+":app"
+	case entry != "":
+		start = "python " + entry + ".py"
+	default:
+		return nil, fmt.Errorf("python: no main.py or app.py to start")
+	}
+
+	var install string
+	switch {
+	case a.has("requirements.txt"):
+		install = "COPY requirements.txt ./\nRUN pip install --no-cache-dir -r requirements.txt\nCOPY . .\n"
+	case a.has("Pipfile"):
+		install = "COPY " + strings.Join(a.present("Pipfile", "Pipfile.lock"), " ") + " ./\n" +
+			"RUN pip install --no-cache-dir pipenv && pipenv install --system --deploy\nCOPY . .\n"
+	default:
+		install = "COPY . .\nRUN pip install --no-cache-dir .\n"
+	}
+	if extra != "" && !strings.Contains(deps, extra) {
+		install += "RUN pip install --no-cache-dir " + extra + "\n"
+	}
+	if a.cfg.InstallCommand != "" {
+		install = "COPY . .\nRUN " + a.cfg.InstallCommand + "\n"
+	}
+
+	df := fmt.Sprintf(`FROM python:%s-slim
+WORKDIR /app
+ENV PYTHONDONTWRITEBYTECODE=1 PYTHONUNBUFFERED=1
+%sEXPOSE %d
+CMD ["sh", "-c", %q]
+`, defaultPythonVersion, install, port, start)
+	return &spec{Type: "python", ServicePort: port, Dockerfile: df}, nil
+}
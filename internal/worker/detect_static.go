@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/opencel/opencel/internal/appconfig"
+)
+
+const nginxConfFile = ".opencel.nginx.conf"
+
+// staticSpec serves files with nginx: the build output when the app has a
+// build script, else the app directory itself.
+func staticSpec(a *app) (*spec, error) {
+	out := "."
+	if a.hasScript("build") {
+		out = "dist"
+	}
+	return a.staticBuildSpec(out, false), nil
+}
+
+// staticBuildSpec builds the app with its package manager (when it has a
+// package.json) and serves outDir with nginx. opencel.json's outputDir wins
+// over defaultOut. spa makes unknown paths fall back to /index.html.
+func (a *app) staticBuildSpec(defaultOut string, spa bool) *spec {
+	out := defaultOut
+	if a.cfg.OutputDir != "" {
+		out = a.cfg.OutputDir
+	}
+	out = path.Clean(strings.TrimPrefix(out, "/"))
+
+	var sb strings.Builder
+	src := out
+	if a.pkg != nil {
+		b := a.nodeBuild(80)
+		sb.WriteString(a.nodeBuildStage(b))
+		sb.WriteString("\n")
+		src = "--from=build /app/" + out
+	}
+	sb.WriteString("FROM nginx:alpine\n")
+	fmt.Fprintf(&sb, "COPY %s /etc/nginx/conf.d/default.conf\n", nginxConfFile)
+	fmt.Fprintf(&sb, "COPY %s /usr/share/nginx/html\n", src)
+	sb.WriteString("EXPOSE 80\n")
+
+	return &spec{
+		Type:        "static",
+		ServicePort: 80,
+		Dockerfile:  sb.String(),
+		Files:       map[string]string{nginxConfFile: nginxConf(spa, a.cfg)},
+		Static:      true,
+	}
+}
+
+// nginxRoute is one nginx location: an exact path, or a prefix from a source
+// ending in /*.
+type nginxRoute struct {
+	path     string
+	prefix   bool
+	headers  map[string]string
+	redirect *appconfig.Redirect
+	rewrite  string
+}
+
+func (r *nginxRoute) location() string {
+	switch {
+	case r.path == "/" && r.prefix:
+		return "location /"
+	case r.prefix:
+		return "location ^~ " + r.path
+	default:
+		return "location = " + r.path
+	}
+}
+
+// nginxConf serves the site, applying opencel.json's headers, redirects and
+// rewrites per source. A redirect wins over a rewrite for the same source.
+// spa makes unknown paths fall back to /index.html.
+func nginxConf(spa bool, cfg *appconfig.Config) string {
+	fallback := "try_files $uri $uri/ $uri.html =404;"
+	if spa {
+		fallback = "try_files $uri $uri/ /index.html;"
+	}
+
+	var routes []*nginxRoute
+	route := func(src string) *nginxRoute {
+		p, prefix := strings.CutSuffix(src, "*")
+		for _, r := range routes {
+			if r.path == p && r.prefix == prefix {
+				return r
+			}
+		}
+		r := &nginxRoute{path: p, prefix: prefix, headers: map[string]string{}}
+		routes = append(routes, r)
+		return r
+	}
+	for _, h := range cfg.Headers {
+		r := route(h.Source)
+		for k, v := range h.Headers {
+			r.headers[k] = v
+		}
+	}
+	for i := range cfg.Redirects {
+		if r := route(cfg.Redirects[i].Source); r.redirect == nil {
+			r.redirect = &cfg.Redirects[i]
+		}
+	}
+	for _, rw := range cfg.Rewrites {
+		if r := route(rw.Source); r.rewrite == "" {
+			r.rewrite = rw.Destination
+		}
+	}
+	// The catch-all location is always there, last. Its headers apply to every
+	// path, but nginx does not inherit add_header across locations: copy them.
+	root := route("/*")
+	for i, r := range routes {
+		if r == root {
+			routes = append(append(routes[:i:i], routes[i+1:]...), root)
+			break
+		}
+	}
+	for _, r := range routes {
+		for k, v := range root.headers {
+			if _, ok := r.headers[k]; !ok {
+				r.headers[k] = v
+			}
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("server {\n    listen 80;\n    server_name _;\n    root /usr/share/nginx/html;\n    index index.html;\n")
+	for _, r := range routes {
+		fmt.Fprintf(&sb, "\n    %s {\n", r.location())
+		names := make([]string, 0, len(r.headers))
+		for k := range r.headers {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			fmt.Fprintf(&sb, "        add_header %s \"%s\" always;\n", k, r.headers[k])
+		}
+		switch {
+		case r.redirect != nil:
+			code := 307
+			if r.redirect.Permanent {
+				code = 308
+			}
+			fmt.Fprintf(&sb, "        return %d %s;\n", code, r.redirect.Destination)
+		case r.rewrite != "":
+			fmt.Fprintf(&sb, "        rewrite ^ %s break;\n", r.rewrite)
+		default:
+			fmt.Fprintf(&sb, "        %s\n", fallback)
+		}
+		sb.WriteString("    }\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencel/opencel/internal/appconfig"
+	"github.com/opencel/opencel/internal/settings"
+)
+
+func TestDetectSpecFixtures(t *testing.T) {
+	cases := []struct {
+		fixture  string
+		typ      string
+		port     int
+		contains []string
+	}{
+		{"nextjs-pnpm", "nextjs", 3000, []string{"corepack enable", "COPY package.json pnpm-lock.yaml ./", "pnpm install --frozen-lockfile", "pnpm run build", `"pnpm run start"`}},
+		{"vite-yarn", "vite", 80, []string{"COPY package.json yarn.lock ./", "yarn run build", "COPY --from=build /app/dist /usr/share/nginx/html"}},
+		{"astro-static", "astro", 80, []string{"npm ci", "COPY --from=build /app/dist /usr/share/nginx/html"}},
+		{"astro-node", "astro", 4321, []string{"npm install", "ENV HOST=0.0.0.0", "dist/server/entry.mjs"}},
+		{"node-bun", "node", 3000, []string{"npm install -g bun", "COPY package.json bun.lockb ./", "bun install", `"bun run start"`}},
+		{"go-cmd", "go", 8080, []string{"FROM golang:1.23-alpine", "COPY go.mod go.sum ./", "go build -trimpath -o /out/app ./cmd/server"}},
+		{"python-fastapi", "python", 8000, []string{"pip install --no-cache-dir -r requirements.txt", "uvicorn main:app --host 0.0.0.0 --port $PORT"}},
+		{"python-django", "python", 8000, []string{"RUN pip install --no-cache-dir gunicorn", "gunicorn --bind 0.0.0.0:$PORT mysite.wsgi"}},
+		{"static-html", "static", 80, []string{"COPY . /usr/share/nginx/html"}},
+	}
+	for _, c := range cases {
+		t.Run(c.fixture, func(t *testing.T) {
+			sp, err := detectSpec(filepath.Join("testdata", "detect", c.fixture), nil)
+			if err != nil {
+				t.Fatalf("detectSpec: %v", err)
+			}
+			if sp.Type != c.typ || sp.ServicePort != c.port {
+				t.Fatalf("got %s:%d, want %s:%d", sp.Type, sp.ServicePort, c.typ, c.port)
+			}
+			for _, want := range c.contains {
+				if !strings.Contains(sp.Dockerfile, want) {
+					t.Errorf("Dockerfile missing %q:\n%s", want, sp.Dockerfile)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectPackageManager(t *testing.T) {
+	for fixture, want := range map[string]string{
+		"nextjs-pnpm":  "pnpm",
+		"vite-yarn":    "yarn",
+		"node-bun":     "bun",
+		"astro-static": "npm",
+	} {
+		if got := detectPackageManager(filepath.Join("testdata", "detect", fixture)).Name; got != want {
+			t.Errorf("%s: package manager = %s, want %s", fixture, got, want)
+		}
+	}
+}
+
+func TestBuildPresetsHaveDetectors(t *testing.T) {
+	for _, p := range settings.BuildPresets {
+		if p == "auto" || p == "docker" {
+			continue
+		}
+		if detectorByName(p) == nil {
+			t.Errorf("build preset %q has no detector", p)
+		}
+	}
+}
+
+func TestAppConfigOverrides(t *testing.T) {
+	cfg := &appconfig.Config{
+		InstallCommand: "pnpm install",
+		BuildCommand:   "pnpm run build:prod",
+		StartCommand:   "node server.js",
+		NodeVersion:    "20",
+		Port:           8080,
+	}
+	sp, err := detectSpec(filepath.Join("testdata", "detect", "nextjs-pnpm"), cfg)
+	if err != nil {
+		t.Fatalf("detectSpec: %v", err)
+	}
+	if sp.ServicePort != 8080 {
+		t.Errorf("port = %d, want 8080", sp.ServicePort)
+	}
+	for _, want := range []string{"FROM node:20-alpine AS build", "RUN pnpm install\n", "RUN pnpm run build:prod", `"node server.js"`, "EXPOSE 8080"} {
+		if !strings.Contains(sp.Dockerfile, want) {
+			t.Errorf("Dockerfile missing %q:\n%s", want, sp.Dockerfile)
+		}
+	}
+}
+
+func TestAppConfigTypesHaveDetectors(t *testing.T) {
+	for _, typ := range appconfig.Types {
+		if typ != "docker" && detectorByName(typ) == nil {
+			t.Errorf("opencel.json type %q has no detector", typ)
+		}
+	}
+}
+
+func TestNginxConfRoutes(t *testing.T) {
+	conf := nginxConf(true, &appconfig.Config{
+		Headers: []appconfig.Header{
+			{Source: "/*", Headers: map[string]string{"X-Frame-Options": "DENY"}},
+			{Source: "/assets/*", Headers: map[string]string{"Cache-Control": "public, max-age=31536000, immutable"}},
+		},
+		Redirects: []appconfig.Redirect{{Source: "/old", Destination: "/new", Permanent: true}},
+		Rewrites:  []appconfig.Rewrite{{Source: "/docs/*", Destination: "/docs/index.html"}},
+	})
+	for _, want := range []string{
+		"location ^~ /assets/ {\n        add_header Cache-Control \"public, max-age=31536000, immutable\" always;\n        add_header X-Frame-Options \"DENY\" always;\n        try_files $uri $uri/ /index.html;",
+		"location = /old {\n        add_header X-Frame-Options \"DENY\" always;\n        return 308 /new;",
+		"location ^~ /docs/ {\n        add_header X-Frame-Options \"DENY\" always;\n        rewrite ^ /docs/index.html break;",
+		"location / {\n        add_header X-Frame-Options \"DENY\" always;\n        try_files $uri $uri/ /index.html;\n    }\n}\n",
+	} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("nginx conf missing %q:\n%s", want, conf)
+		}
+	}
+	if strings.Count(conf, "location / ") != 1 {
+		t.Errorf("catch-all location must appear once:\n%s", conf)
+	}
+}
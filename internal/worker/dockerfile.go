@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opencel/opencel/internal/appconfig"
+)
+
+// defaultDockerfilePort is used when a repository Dockerfile neither EXPOSEs a
+// port nor has one configured; PORT is set to it so apps reading PORT agree.
+const defaultDockerfilePort = 3000
+
+// dockerfileSpec builds with the app's own Dockerfile: opencel.json's
+// "dockerfile" path (relative to the app dir) or ./Dockerfile. The service
+// port is opencel.json's "port", else the EXPOSE of the stage being built.
+func dockerfileSpec(appDir string, cfg *appconfig.Config) (*spec, error) {
+	rel := cfg.Dockerfile
+	if rel == "" {
+		rel = "Dockerfile"
+	}
+	path, err := resolveAppFile(appDir, rel)
+	if err != nil {
+		return nil, fmt.Errorf("dockerfile: %w", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("dockerfile: %w", err)
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = exposedPort(b, cfg.Target)
+	}
+	if port == 0 {
+		port = defaultDockerfilePort
+	}
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", port)
+	}
+	return &spec{
+		Type:           "docker",
+		ServicePort:    port,
+		DockerfilePath: path,
+		BuildArgs:      cfg.BuildArgs,
+		Target:         cfg.Target,
+	}, nil
+}
+
+// resolveAppFile resolves a file path given relative to appDir and makes
+// sure it does not leave it.
+func resolveAppFile(appDir, rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("%s must be relative to the app directory", rel)
+	}
+	root, err := filepath.EvalSymlinks(appDir)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", fmt.Errorf("%s not found", rel)
+	}
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s points outside the app directory", rel)
+	}
+	return path, nil
+}
+
+// exposedPort returns the first TCP port EXPOSEd by the target stage (the last
+// stage when target is empty), or 0. Ports given as build variables are skipped.
+func exposedPort(dockerfile []byte, target string) int {
+	type stage struct {
+		name string
+		port int
+	}
+	var stages []stage
+	for _, line := range dockerfileInstructions(dockerfile) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FROM":
+			st := stage{}
+			for i := 1; i+1 < len(fields); i++ {
+				if strings.EqualFold(fields[i], "AS") {
+					st.name = strings.ToLower(fields[i+1])
+				}
+			}
+			stages = append(stages, st)
+		case "EXPOSE":
+			if len(stages) == 0 || stages[len(stages)-1].port != 0 {
+				continue
+			}
+			for _, f := range fields[1:] {
+				num, proto, _ := strings.Cut(f, "/")
+				if proto != "" && !strings.EqualFold(proto, "tcp") {
+					continue
+				}
+				if n, err := strconv.Atoi(num); err == nil && n > 0 && n <= 65535 {
+					stages[len(stages)-1].port = n
+					break
+				}
+			}
+		}
+	}
+	if len(stages) == 0 {
+		return 0
+	}
+	if target != "" {
+		for _, st := range stages {
+			if st.name == strings.ToLower(target) {
+				return st.port
+			}
+		}
+		return 0
+	}
+	return stages[len(stages)-1].port
+}
+
+// dockerfileInstructions joins continuation lines and drops comments.
+func dockerfileInstructions(b []byte) []string {
+	var out []string
+	var cur strings.Builder
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if cont, ok := strings.CutSuffix(line, "\\"); ok {
+			cur.WriteString(cont)
+			cur.WriteString(" ")
+			continue
+		}
+		cur.WriteString(line)
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			out = append(out, s)
+		}
+		cur.Reset()
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+func dockerBuildArgs(sp *spec, dockerfilePath, imageRef, contextDir string) []string {
+	args := []string{"build", "-f", dockerfilePath, "-t", imageRef}
+	keys := make([]string, 0, len(sp.BuildArgs))
+	for k := range sp.BuildArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--build-arg", k+"="+sp.BuildArgs[k])
+	}
+	if sp.Target != "" {
+		args = append(args, "--target", sp.Target)
+	}
+	return append(args, contextDir)
+}
@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencel/opencel/internal/appconfig"
+)
+
+func TestExposedPort(t *testing.T) {
+	df := []byte(`# syntax=docker/dockerfile:1
+FROM golang:1.24 AS build
+EXPOSE 9000
+RUN go build \
+    -o /app ./cmd/server
+
+FROM gcr.io/distroless/base AS runtime
+EXPOSE 53/udp 8080/tcp
+CMD ["/app"]
+`)
+	if got := exposedPort(df, ""); got != 8080 {
+		t.Errorf("last stage port = %d, want 8080", got)
+	}
+	if got := exposedPort(df, "build"); got != 9000 {
+		t.Errorf("build stage port = %d, want 9000", got)
+	}
+	if got := exposedPort([]byte("FROM alpine\nEXPOSE $PORT\n"), ""); got != 0 {
+		t.Errorf("variable port = %d, want 0", got)
+	}
+}
+
+func TestDockerBuildArgs(t *testing.T) {
+	sp := &spec{BuildArgs: map[string]string{"B": "2", "A": "1"}, Target: "runtime"}
+	got := dockerBuildArgs(sp, "/src/Dockerfile", "reg/app:1", "/src")
+	want := []string{"build", "-f", "/src/Dockerfile", "-t", "reg/app:1", "--build-arg", "A=1", "--build-arg", "B=2", "--target", "runtime", "/src"}
+	if len(got) != len(want) {
+		t.Fatalf("args = %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("args = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDockerfileSpecFixture(t *testing.T) {
+	dir := filepath.Join("testdata", "detect", "dockerfile")
+	cases := []struct {
+		name string
+		cfg  *appconfig.Config
+		path string
+		port int
+	}{
+		// The repository's Dockerfile wins over the package.json next to it.
+		{"detected", nil, "Dockerfile", 8080},
+		{"target", &appconfig.Config{Target: "build"}, "Dockerfile", 9000},
+		{"custom path", &appconfig.Config{Dockerfile: "docker/Dockerfile.prod"}, "docker/Dockerfile.prod", 5000},
+		{"configured port", &appconfig.Config{Port: 4000}, "Dockerfile", 4000},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sp, err := detectSpec(dir, c.cfg)
+			if err != nil {
+				t.Fatalf("detectSpec: %v", err)
+			}
+			if sp.Type != "docker" || sp.ServicePort != c.port || sp.Dockerfile != "" {
+				t.Fatalf("got %s:%d (generated %q), want docker:%d", sp.Type, sp.ServicePort, sp.Dockerfile, c.port)
+			}
+			if !strings.HasSuffix(filepath.ToSlash(sp.DockerfilePath), "dockerfile/"+c.path) {
+				t.Errorf("DockerfilePath = %q, want .../%s", sp.DockerfilePath, c.path)
+			}
+		})
+	}
+	if _, err := detectSpec(dir, &appconfig.Config{Dockerfile: "Dockerfile.missing"}); err == nil {
+		t.Error("detectSpec accepted a missing Dockerfile")
+	}
+}
+
+func TestResolveAppFileRejectsEscapes(t *testing.T) {
+	root := t.TempDir()
+	appDir := filepath.Join(root, "app")
+	if err := os.Mkdir(appDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(root, "Dockerfile")
+	for _, f := range []string{outside, filepath.Join(appDir, "Dockerfile")} {
+		if err := os.WriteFile(f, []byte("FROM scratch\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../Dockerfile", filepath.Join(appDir, "Dockerfile.link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := resolveAppFile(appDir, "Dockerfile"); err != nil {
+		t.Fatalf("resolveAppFile(Dockerfile): %v", err)
+	}
+	for rel, want := range map[string]string{
+		"../Dockerfile":   "outside the app directory",
+		outside:           "must be relative",
+		"Dockerfile.link": "outside the app directory",
+	} {
+		if _, err := resolveAppFile(appDir, rel); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("resolveAppFile(%q) = %v, want an error containing %q", rel, err, want)
+		}
+	}
+	if _, err := dockerfileSpec(appDir, &appconfig.Config{Dockerfile: "Dockerfile.link"}); err == nil {
+		t.Error("dockerfileSpec followed a symlink out of the app directory")
+	}
+}
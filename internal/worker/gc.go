@@ -0,0 +1,170 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"time"
+
+	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/settings"
+	"github.com/opencel/opencel/internal/traefik"
+)
+
+// CollectGarbage applies the retention policy to every project: the production
+// deployment and the newest N READY deployments of each git ref are kept,
+// older ones and those of closed pull requests lose their container and image
+// and are marked EXPIRED. Refs left without deployments lose their build cache. Buildx
+// builders for build limits no project uses any more and runtime logs older
+// than RuntimeLogRetention are removed too.
+func (w *Worker) CollectGarbage(ctx context.Context) error {
+	projects, err := w.Store.ListProjects(ctx)
+	if err != nil {
+		return err
+	}
+	expired := 0
+	for i := range projects {
+		n, err := w.collectProject(ctx, &projects[i])
+		if err != nil {
+			log.Printf("gc: project %s: %v", projects[i].ID, err)
+		}
+		expired += n
+	}
+	if err := w.pruneBuilders(ctx, projects); err != nil {
+		log.Printf("gc: %v", err)
+	}
+	if n, err := w.Store.DeleteLogChunksBefore(ctx, "runtime", time.Now().Add(-w.Cfg.RuntimeLogRetention)); err != nil {
+		log.Printf("gc: runtime logs: %v", err)
+	} else if n > 0 {
+		log.Printf("gc: deleted %d runtime log chunks", n)
+	}
+	if expired > 0 {
+		// Drop routes to removed containers.
+		if err := traefik.Write(ctx, w.Cfg, w.Store); err != nil {
+			return fmt.Errorf("traefik config update failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// collectProject expires p's deployments outside the retention window and
+// returns how many it expired.
+func (w *Worker) collectProject(ctx context.Context, p *db.Project) (int, error) {
+	ps, err := settings.LoadProject(ctx, w.Store, p.ID)
+	if err != nil {
+		return 0, err
+	}
+	ds, err := w.Store.ListExpirableDeployments(ctx, p.ID)
+	if err != nil {
+		return 0, err
+	}
+	keep := ps.Retention(w.Cfg)
+	var expired []db.Deployment
+	for _, d := range expiredDeployments(ds, p.ProductionDeploymentID.String, keep) {
+		if err := w.expire(ctx, &d, keep); err != nil {
+			// Leave it as is; the next run retries.
+			_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("gc: %v\n", err))
+			continue
+		}
+		expired = append(expired, d)
+	}
+	for _, ref := range goneRefs(ds, expired, p.GitHubDefaultBranch.String) {
+		if err := w.deleteRegistryImage(ctx, w.cacheImage(p, ref)); err != nil {
+			log.Printf("gc: project %s: build cache of %s: %v", p.ID, ref, err)
+		}
+	}
+	return len(expired), nil
+}
+
+// goneRefs returns the git refs of ds whose deployments have all expired,
+// whose build cache is of no more use. The default branch keeps its cache,
+// since other branches start from it.
+func goneRefs(ds, expired []db.Deployment, defaultBranch string) []string {
+	left := map[string]int{}
+	for _, d := range ds {
+		left[d.GitRef]++
+	}
+	for _, d := range expired {
+		left[d.GitRef]--
+	}
+	var out []string
+	for _, d := range expired {
+		if left[d.GitRef] == 0 && d.GitRef != "refs/heads/"+defaultBranch {
+			out = append(out, d.GitRef)
+			left[d.GitRef] = -1
+		}
+	}
+	return out
+}
+
+// expiredDeployments picks the deployments outside the retention window. ds must
+// be ordered newest first. Only READY deployments count against a ref's quota,
+// so failed builds cannot push working ones out; a FAILED one expires once keep
+// READY deployments of its ref are newer. STOPPED deployments belong to closed
+// pull requests and always expire, as do FAILED ones of a ref that has STOPPED
+// deployments but no READY one left. The production deployment is never picked
+// and does not count.
+func expiredDeployments(ds []db.Deployment, productionID string, keep int) []db.Deployment {
+	closed := map[string]bool{}
+	for _, d := range ds {
+		if d.Status == "STOPPED" {
+			closed[d.GitRef] = true
+		}
+	}
+	for _, d := range ds {
+		if d.Status == "READY" {
+			delete(closed, d.GitRef)
+		}
+	}
+	var out []db.Deployment
+	ready := map[string]int{}
+	for _, d := range ds {
+		if d.ID == productionID {
+			continue
+		}
+		if d.Status != "READY" {
+			if d.Status == "STOPPED" || closed[d.GitRef] || ready[d.GitRef] >= keep {
+				out = append(out, d)
+			}
+			continue
+		}
+		ready[d.GitRef]++
+		if ready[d.GitRef] > keep {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func (w *Worker) expire(ctx context.Context, d *db.Deployment, keep int) error {
+	if d.ContainerName.Valid && d.ContainerName.String != "" {
+		// rm -f succeeds for containers that are already gone.
+		if out, err := exec.CommandContext(ctx, "docker", "rm", "-f", d.ContainerName.String).CombinedOutput(); err != nil {
+			return fmt.Errorf("remove container %s: %v: %s", d.ContainerName.String, err, out)
+		}
+	}
+	inUse := false
+	if d.ImageRef.Valid && d.ImageRef.String != "" {
+		var err error
+		if inUse, err = w.Store.ImageInUse(ctx, d.ImageRef.String, d.ID); err != nil {
+			return err
+		}
+	}
+	if d.ImageRef.Valid && d.ImageRef.String != "" && !inUse {
+		// The local copy is only a cache of the registry image.
+		_ = exec.CommandContext(ctx, "docker", "image", "rm", d.ImageRef.String).Run()
+		if err := w.deleteRegistryImage(ctx, d.ImageRef.String); err != nil {
+			return err
+		}
+	}
+	if err := w.Store.UpdateDeployment(ctx, d.ID, "EXPIRED", nil, nil, nil, nil); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Removed by retention policy (keeping %d per branch)", keep)
+	if d.Status == "STOPPED" {
+		msg = "Removed by retention policy (pull request closed)"
+	}
+	_ = w.Store.AddDeploymentEvent(ctx, d.ID, "EXPIRED", msg)
+	return nil
+}
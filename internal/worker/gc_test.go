@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencel/opencel/internal/config"
+	"github.com/opencel/opencel/internal/db"
+)
+
+func TestExpiredDeployments(t *testing.T) {
+	// Newest first, as ListExpirableDeployments returns them.
+	ds := []db.Deployment{
+		{ID: "m4", GitRef: "refs/heads/main", Status: "READY"},
+		{ID: "f2", GitRef: "refs/heads/feature", Status: "READY"},
+		{ID: "m3", GitRef: "refs/heads/main", Status: "READY"},
+		{ID: "m2", GitRef: "refs/heads/main", Status: "READY"},
+		{ID: "f1", GitRef: "refs/heads/feature", Status: "READY"},
+		{ID: "m1", GitRef: "refs/heads/main", Status: "READY"},
+		{ID: "m0", GitRef: "refs/heads/main", Status: "READY"},
+	}
+	var got []string
+	for _, d := range expiredDeployments(ds, "m1", 2) {
+		got = append(got, d.ID)
+	}
+	want := []string{"m2", "m0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expired = %v, want %v", got, want)
+	}
+}
+
+func TestExpiredDeploymentsCountsOnlyReady(t *testing.T) {
+	ds := []db.Deployment{
+		{ID: "f3", GitRef: "refs/heads/main", Status: "FAILED"},
+		{ID: "f2", GitRef: "refs/heads/main", Status: "FAILED"},
+		{ID: "r2", GitRef: "refs/heads/main", Status: "READY"},
+		{ID: "f1", GitRef: "refs/heads/main", Status: "FAILED"},
+		{ID: "r1", GitRef: "refs/heads/main", Status: "READY"},
+		{ID: "f0", GitRef: "refs/heads/main", Status: "FAILED"},
+		{ID: "r0", GitRef: "refs/heads/main", Status: "READY"},
+	}
+	var got []string
+	for _, d := range expiredDeployments(ds, "", 2) {
+		got = append(got, d.ID)
+	}
+	// Everything newer than r1, the second READY one, is kept.
+	want := []string{"f0", "r0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expired = %v, want %v", got, want)
+	}
+}
+
+func TestExpiredDeploymentsOfClosedPullRequests(t *testing.T) {
+	ds := []db.Deployment{
+		{ID: "p2", GitRef: "refs/pull/7/head", Status: "STOPPED"},
+		{ID: "m1", GitRef: "refs/heads/main", Status: "READY"},
+		{ID: "pf", GitRef: "refs/pull/7/head", Status: "FAILED"},
+		{ID: "p1", GitRef: "refs/pull/7/head", Status: "STOPPED"},
+		// Reopened: the new preview is kept, the stopped one still goes.
+		{ID: "q2", GitRef: "refs/pull/8/head", Status: "READY"},
+		{ID: "qf", GitRef: "refs/pull/8/head", Status: "FAILED"},
+		{ID: "q1", GitRef: "refs/pull/8/head", Status: "STOPPED"},
+	}
+	var got []string
+	for _, d := range expiredDeployments(ds, "m1", 2) {
+		got = append(got, d.ID)
+	}
+	want := []string{"p2", "pf", "p1", "q1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expired = %v, want %v", got, want)
+	}
+}
+
+func TestGoneRefs(t *testing.T) {
+	ds := []db.Deployment{
+		{ID: "m2", GitRef: "refs/heads/main", Status: "READY"},
+		{ID: "f2", GitRef: "refs/heads/feature", Status: "READY"},
+		{ID: "p2", GitRef: "refs/pull/7/head", Status: "STOPPED"},
+		{ID: "m1", GitRef: "refs/heads/main", Status: "READY"},
+		{ID: "p1", GitRef: "refs/pull/7/head", Status: "STOPPED"},
+		{ID: "f1", GitRef: "refs/heads/feature", Status: "READY"},
+		{ID: "o1", GitRef: "refs/heads/old", Status: "FAILED"},
+	}
+	expired := []db.Deployment{ds[2], ds[3], ds[4], ds[5], ds[6]}
+	want := []string{"refs/pull/7/head", "refs/heads/old"}
+	if got := goneRefs(ds, expired, "main"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("goneRefs = %v, want %v", got, want)
+	}
+	// The default branch keeps its cache even with nothing left.
+	if got := goneRefs(ds[3:4], ds[3:4], "main"); got != nil {
+		t.Fatalf("default branch: goneRefs = %v", got)
+	}
+}
+
+func TestCacheImage(t *testing.T) {
+	w := &Worker{Cfg: &config.Config{RegistryAddr: "localhost:5000"}}
+	p := &db.Project{Slug: "web"}
+	for ref, want := range map[string]string{
+		"refs/heads/Feature/X": "localhost:5000/opencel-cache/web:feature-x",
+		"refs/pull/7/head":     "localhost:5000/opencel-cache/web:pull-7-head",
+	} {
+		if got := w.cacheImage(p, ref); got != want {
+			t.Errorf("cacheImage(%q) = %q, want %q", ref, got, want)
+		}
+	}
+	// GC deletes what builds write.
+	d := &db.Deployment{GitRef: "refs/pull/7/head"}
+	if c := w.buildCacheFor(p, d); c.To != w.cacheImage(p, d.GitRef) {
+		t.Fatalf("buildCacheFor writes %q, GC deletes %q", c.To, w.cacheImage(p, d.GitRef))
+	}
+}
+
+func TestSplitImageRef(t *testing.T) {
+	cases := []struct {
+		ref, repo, tag string
+		ok             bool
+	}{
+		{"localhost:5000/opencel/web:abc123", "opencel/web", "abc123", true},
+		{"ghcr.io/opencel/web:abc123", "", "", false},
+		{"localhost:5000/opencel/web", "", "", false},
+	}
+	for _, c := range cases {
+		repo, tag, ok := splitImageRef("localhost:5000", c.ref)
+		if repo != c.repo || tag != c.tag || ok != c.ok {
+			t.Errorf("splitImageRef(%q) = %q, %q, %v", c.ref, repo, tag, ok)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opencel/opencel/internal/github"
+)
+
+const (
+	ghStatusContext = "opencel"
+	ghCheckRunName  = "OpenCel"
+)
+
+// statusReporter mirrors a deployment's progress onto the commit in GitHub,
+// both as a commit status and as a check run. It is a no-op until attach is
+// called, and reporting failures are logged but never fail the deployment.
+type statusReporter struct {
+	w            *Worker
+	deploymentID string
+	detailsURL   string
+
+	gh         *github.App
+	token      string
+	owner      string
+	repo       string
+	sha        string
+	checkRunID int64
+}
+
+func (w *Worker) newStatusReporter(deploymentID, projectID string) *statusReporter {
+	return &statusReporter{
+		w:            w,
+		deploymentID: deploymentID,
+		detailsURL:   fmt.Sprintf("%s://%s/projects/%s/deployments/%s", w.Cfg.PublicScheme, w.Cfg.BaseDomain, projectID, deploymentID),
+	}
+}
+
+func (r *statusReporter) attach(gh *github.App, token, owner, repo, sha string) {
+	r.gh, r.token, r.owner, r.repo, r.sha = gh, token, owner, repo, sha
+}
+
+func (r *statusReporter) pending(ctx context.Context) {
+	if r.gh == nil {
+		return
+	}
+	r.status(ctx, "pending", "Building deployment", r.detailsURL)
+	id, err := r.gh.CreateCheckRun(ctx, r.token, r.owner, r.repo, github.CheckRun{
+		Name:       ghCheckRunName,
+		HeadSHA:    r.sha,
+		Status:     "in_progress",
+		DetailsURL: r.detailsURL,
+		ExternalID: r.deploymentID,
+		Output:     &github.CheckRunOutput{Title: "Building", Summary: "OpenCel is building this commit."},
+	})
+	if err != nil {
+		r.logf(ctx, "GitHub check run: %v", err)
+		return
+	}
+	r.checkRunID = id
+}
+
+func (r *statusReporter) success(ctx context.Context, previewURL string) {
+	if r.gh == nil {
+		return
+	}
+	r.status(ctx, "success", "Deployment ready", previewURL)
+	r.completeCheckRun(ctx, "success", "Deployment ready", fmt.Sprintf("Preview: %s", previewURL))
+}
+
+func (r *statusReporter) failure(ctx context.Context, msg string) {
+	if r.gh == nil {
+		return
+	}
+	r.status(ctx, "failure", msg, r.detailsURL)
+	r.completeCheckRun(ctx, "failure", "Deployment failed", msg)
+}
+
+func (r *statusReporter) canceled(ctx context.Context) {
+	if r.gh == nil {
+		return
+	}
+	r.status(ctx, "error", "Deployment canceled", r.detailsURL)
+	r.completeCheckRun(ctx, "cancelled", "Deployment canceled", "The build was canceled before it finished.")
+}
+
+func (r *statusReporter) status(ctx context.Context, state, desc, targetURL string) {
+	err := r.gh.CreateCommitStatus(ctx, r.token, r.owner, r.repo, r.sha, github.CommitStatus{
+		State:       state,
+		TargetURL:   targetURL,
+		Description: desc,
+		Context:     ghStatusContext,
+	})
+	if err != nil {
+		r.logf(ctx, "GitHub commit status: %v", err)
+	}
+}
+
+func (r *statusReporter) completeCheckRun(ctx context.Context, conclusion, title, summary string) {
+	if r.checkRunID == 0 {
+		return
+	}
+	err := r.gh.UpdateCheckRun(ctx, r.token, r.owner, r.repo, r.checkRunID, github.CheckRun{
+		Status:     "completed",
+		Conclusion: conclusion,
+		DetailsURL: r.detailsURL,
+		Output:     &github.CheckRunOutput{Title: title, Summary: summary},
+	})
+	if err != nil {
+		r.logf(ctx, "GitHub check run: %v", err)
+	}
+}
+
+func (r *statusReporter) logf(ctx context.Context, format string, args ...any) {
+	_ = r.w.Store.AppendLogChunk(ctx, r.deploymentID, "system", fmt.Sprintf(format, args...)+"\n")
+}
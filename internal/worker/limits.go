@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/opencel/opencel/internal/settings"
+)
+
+// cpuPeriod is the CFS period CPU quotas are expressed in (docker's default).
+const cpuPeriod = 100000
+
+// runLimitArgs are the docker run flags for effective resources r. Containers
+// never gain privileges; with a read-only root filesystem, /tmp stays writable.
+func runLimitArgs(r settings.Resources) []string {
+	args := []string{"--security-opt", "no-new-privileges"}
+	if r.MemoryMB > 0 {
+		mem := fmt.Sprintf("%dm", r.MemoryMB)
+		// Equal swap limit: no swap on top of the memory limit.
+		args = append(args, "--memory", mem, "--memory-swap", mem)
+	}
+	if r.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(r.CPUs, 'f', -1, 64))
+	}
+	if r.PidsLimit > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(r.PidsLimit))
+	}
+	if r.RestartPolicy != "" {
+		args = append(args, "--restart", r.RestartPolicy)
+	}
+	if r.ReadOnlyRootFS != nil && *r.ReadOnlyRootFS {
+		args = append(args, "--read-only", "--tmpfs", "/tmp:rw,nosuid,nodev,size=64m")
+	}
+	return args
+}
+
+// buildLimitArgs are the docker build flags for r's build limits. Only the
+// legacy builder (DOCKER_BUILDKIT=0) honors them.
+func buildLimitArgs(r settings.Resources) []string {
+	var args []string
+	if r.BuildMemoryMB > 0 {
+		mem := fmt.Sprintf("%dm", r.BuildMemoryMB)
+		args = append(args, "--memory", mem, "--memory-swap", mem)
+	}
+	if r.BuildCPUs > 0 {
+		args = append(args, "--cpu-period", strconv.Itoa(cpuPeriod), "--cpu-quota", strconv.Itoa(int(r.BuildCPUs*cpuPeriod)))
+	}
+	return args
+}
+
+// builderDriverOpts limit the BuildKit container the same way. BuildKit runs
+// every build of a builder in its one container, so each distinct set of
+// limits gets its own builder, named by builderName. Builders are reused for
+// every project with the same limits; garbage collection removes unused ones.
+func builderDriverOpts(r settings.Resources) []string {
+	var opts []string
+	if r.BuildMemoryMB > 0 {
+		mem := fmt.Sprintf("%dm", r.BuildMemoryMB)
+		opts = append(opts, "memory="+mem, "memory-swap="+mem)
+	}
+	if r.BuildCPUs > 0 {
+		opts = append(opts, fmt.Sprintf("cpu-period=%d", cpuPeriod), fmt.Sprintf("cpu-quota=%d", int(r.BuildCPUs*cpuPeriod)))
+	}
+	return opts
+}
+
+func builderName(base string, r settings.Resources) string {
+	if r.BuildMemoryMB <= 0 && r.BuildCPUs <= 0 {
+		return base
+	}
+	return fmt.Sprintf("%s-m%d-c%d", base, r.BuildMemoryMB, int(r.BuildCPUs*1000))
+}
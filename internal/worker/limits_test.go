@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencel/opencel/internal/settings"
+)
+
+func TestRunLimitArgs(t *testing.T) {
+	ro := true
+	got := runLimitArgs(settings.Resources{MemoryMB: 512, CPUs: 0.5, PidsLimit: 256, RestartPolicy: "on-failure", ReadOnlyRootFS: &ro})
+	want := []string{
+		"--security-opt", "no-new-privileges",
+		"--memory", "512m", "--memory-swap", "512m",
+		"--cpus", "0.5",
+		"--pids-limit", "256",
+		"--restart", "on-failure",
+		"--read-only", "--tmpfs", "/tmp:rw,nosuid,nodev,size=64m",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("runLimitArgs:\n got %q\nwant %q", got, want)
+	}
+
+	if got := runLimitArgs(settings.Resources{}); !reflect.DeepEqual(got, []string{"--security-opt", "no-new-privileges"}) {
+		t.Fatalf("unlimited: %q", got)
+	}
+}
+
+func TestBuildLimits(t *testing.T) {
+	r := settings.Resources{BuildMemoryMB: 2048, BuildCPUs: 1.5}
+	if got, want := buildLimitArgs(r), []string{"--memory", "2048m", "--memory-swap", "2048m", "--cpu-period", "100000", "--cpu-quota", "150000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("buildLimitArgs = %q, want %q", got, want)
+	}
+	if got, want := builderDriverOpts(r), []string{"memory=2048m", "memory-swap=2048m", "cpu-period=100000", "cpu-quota=150000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("builderDriverOpts = %q, want %q", got, want)
+	}
+	if got := builderName("opencel", r); got != "opencel-m2048-c1500" {
+		t.Errorf("builderName = %q", got)
+	}
+	if got := builderName("opencel", settings.Resources{}); got != "opencel" {
+		t.Errorf("builderName without limits = %q", got)
+	}
+}
+
+func TestStaleBuilders(t *testing.T) {
+	names := []string{"opencel", "opencel-m2048-c1500", "opencel-m4096-c2000 *", "default", "other-m1-c1", ""}
+	got := staleBuilders(names, "opencel", map[string]bool{"opencel-m4096-c2000": true})
+	if want := []string{"opencel-m2048-c1500"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("staleBuilders = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/opencel/opencel/internal/deploy"
+	"github.com/opencel/opencel/internal/settings"
+)
+
+// Redeploy starts a new container for deploymentID from the image it copied
+// from sourceID, with the project's current env vars. Once healthy it becomes
+// READY, and if sourceID was serving production, production moves to it.
+func (w *Worker) Redeploy(ctx context.Context, deploymentID, sourceID string) error {
+	d, err := w.Store.GetDeployment(ctx, deploymentID)
+	if err != nil || d == nil {
+		return fmt.Errorf("deployment not found")
+	}
+	if d.Status == "CANCELED" {
+		return nil
+	}
+	p, err := w.Store.GetProject(ctx, d.ProjectID)
+	if err != nil || p == nil {
+		return fmt.Errorf("project not found")
+	}
+	if !d.ImageRef.Valid || d.ImageRef.String == "" {
+		return w.fail(ctx, d.ID, failInternal, "redeploy: no image to start")
+	}
+	_ = w.Store.AddDeploymentStatusEvent(ctx, d.ID, "BUILDING", fmt.Sprintf("Starting %s with current env vars", d.ImageRef.String), nil)
+	_ = w.Store.UpdateDeployment(ctx, d.ID, "BUILDING", nil, nil, nil, nil)
+
+	containerName := containerNameFor(d.ID)
+	previewURL, err := w.startContainer(ctx, d, containerName, d.ImageRef.String, d.ServicePort)
+	if err != nil {
+		return w.fail(ctx, d.ID, failStart, err.Error())
+	}
+
+	ps, err := settings.LoadProject(ctx, w.Store, d.ProjectID)
+	if err != nil {
+		return w.fail(ctx, d.ID, failConfig, fmt.Sprintf("settings: %v", err))
+	}
+	path, timeout, lenient := deploy.HealthCheck(w.Cfg, ps, d)
+	if err := deploy.Probe(ctx, containerName, d.ServicePort, path, timeout, lenient); err != nil {
+		_ = exec.CommandContext(context.WithoutCancel(ctx), "docker", "rm", "-f", containerName).Run()
+		return w.fail(ctx, d.ID, failStart, fmt.Sprintf("health check %s failed: %v", path, err))
+	}
+
+	if err := w.Store.UpdateDeployment(ctx, d.ID, "READY", nil, &containerName, nil, &previewURL); err != nil {
+		return w.fail(ctx, d.ID, failInternal, fmt.Sprintf("db update: %v", err))
+	}
+	_ = w.Store.AddDeploymentStatusEvent(ctx, d.ID, "READY", "Deployment is ready", nil)
+	w.updateBranchAlias(ctx, d, p)
+
+	if p.ProductionDeploymentID.Valid && p.ProductionDeploymentID.String == sourceID {
+		if d, err = w.Store.GetDeployment(ctx, d.ID); err != nil || d == nil {
+			return fmt.Errorf("reload deployment: %v", err)
+		}
+		if err := deploy.Promote(ctx, w.Cfg, w.Store, d); err != nil {
+			_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("promote: %v\n", err))
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var registryClient = &http.Client{Timeout: 30 * time.Second}
+
+// deleteRegistryImage removes imageRef's tag from the local registry via the
+// v2 API. It deletes by tag, not by digest: identical builds share a manifest,
+// and deleting the digest would take every other deployment's tag with it.
+// Tag deletes need registry 3 with REGISTRY_STORAGE_DELETE_ENABLED=true. This
+// frees no disk space by itself: the blobs stay until someone runs the
+// registry's garbage-collect, which is not safe during pushes and so is left
+// to the operator (see README). A missing image is not an error.
+func (w *Worker) deleteRegistryImage(ctx context.Context, imageRef string) error {
+	repo, tag, ok := splitImageRef(w.Cfg.RegistryAddr, imageRef)
+	if !ok {
+		return fmt.Errorf("image %s is not in the local registry", imageRef)
+	}
+	base := strings.TrimRight(w.Cfg.RegistryAPIURL, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("%s/v2/%s/manifests/%s", base, repo, tag), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("registry: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusMethodNotAllowed:
+		return fmt.Errorf("registry: deletes are disabled (set REGISTRY_STORAGE_DELETE_ENABLED=true)")
+	case http.StatusBadRequest:
+		// registry:2 only deletes by digest.
+		return fmt.Errorf("registry: delete %s: tag deletes are unsupported (use registry:3)", imageRef)
+	default:
+		return fmt.Errorf("registry: delete %s: status %d", imageRef, resp.StatusCode)
+	}
+}
+
+// splitImageRef splits <registryAddr>/<repo>:<tag> into repo and tag.
+func splitImageRef(registryAddr, imageRef string) (repo, tag string, ok bool) {
+	rest, ok := strings.CutPrefix(imageRef, registryAddr+"/")
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndex(rest, ":")
+	if i <= 0 || i == len(rest)-1 || strings.Contains(rest[i:], "/") {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
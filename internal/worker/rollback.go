@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/opencel/opencel/internal/deploy"
+)
+
+// Rollback makes an earlier deployment production again. If its container has
+// been stopped or removed it is recreated from the stored image_ref, with the
+// project's current env vars, before the usual health-checked promotion.
+func (w *Worker) Rollback(ctx context.Context, deploymentID string) error {
+	d, err := w.Store.GetDeployment(ctx, deploymentID)
+	if err != nil || d == nil {
+		return fmt.Errorf("deployment not found")
+	}
+	if !d.ImageRef.Valid || d.ImageRef.String == "" {
+		msg := "Rollback failed: deployment has no stored image"
+		_ = w.Store.AddDeploymentEvent(ctx, d.ID, "ROLLBACK_FAILED", msg)
+		return fmt.Errorf("%s", msg)
+	}
+	_ = w.Store.AddDeploymentEvent(ctx, d.ID, "ROLLBACK", "Rolling production back to this deployment")
+
+	containerName := d.ContainerName.String
+	if containerName == "" {
+		containerName = containerNameFor(d.ID)
+	}
+	if !containerRunning(ctx, containerName) {
+		// Clear out a stopped container with the same name before recreating it.
+		_ = exec.CommandContext(ctx, "docker", "rm", "-f", containerName).Run()
+		_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("recreating container %s from %s\n", containerName, d.ImageRef.String))
+		if _, err := w.startContainer(ctx, d, containerName, d.ImageRef.String, d.ServicePort); err != nil {
+			_ = w.Store.AddDeploymentEvent(ctx, d.ID, "ROLLBACK_FAILED", fmt.Sprintf("Rollback failed: %v", err))
+			return err
+		}
+		if err := w.Store.UpdateDeployment(ctx, d.ID, "READY", nil, &containerName, nil, nil); err != nil {
+			return err
+		}
+		if d, err = w.Store.GetDeployment(ctx, d.ID); err != nil || d == nil {
+			return fmt.Errorf("reload deployment: %v", err)
+		}
+	}
+
+	if err := deploy.Promote(ctx, w.Cfg, w.Store, d); err != nil {
+		_ = w.Store.AddDeploymentEvent(ctx, d.ID, "ROLLBACK_FAILED", fmt.Sprintf("Rollback failed: %v", err))
+		return err
+	}
+	return nil
+}
+
+// Promote makes a READY deployment production once its health check passes.
+// A failed check is recorded on the deployment by deploy.Promote.
+func (w *Worker) Promote(ctx context.Context, deploymentID string) error {
+	d, err := w.Store.GetDeployment(ctx, deploymentID)
+	if err != nil || d == nil {
+		return fmt.Errorf("deployment not found")
+	}
+	if err := deploy.Promote(ctx, w.Cfg, w.Store, d); err != nil {
+		if !errors.Is(err, deploy.ErrUnhealthy) {
+			_ = w.Store.AddDeploymentEvent(ctx, d.ID, "PROMOTION_REJECTED", fmt.Sprintf("Promotion failed: %v", err))
+		}
+		return err
+	}
+	return nil
+}
+
+func containerRunning(ctx context.Context, name string) bool {
+	out, err := exec.CommandContext(ctx, "docker", "inspect", "-f", "{{.State.Running}}", name).Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/opencel/opencel/internal/db"
+)
+
+// runtimeLogSyncInterval is how often the collector looks for containers to
+// follow or let go of.
+const runtimeLogSyncInterval = 5 * time.Second
+
+// CollectRuntimeLogs follows `docker logs` of every running deployment
+// container into the deployment's runtime log stream until ctx is done.
+// Containers are picked up on every sync, so following resumes after a worker
+// restart, from the newest stored runtime chunk on. Followers end when their
+// container stops or is removed, or the deployment is no longer READY.
+func (w *Worker) CollectRuntimeLogs(ctx context.Context) {
+	c := &logCollector{w: w, following: map[string]*follower{}}
+	t := time.NewTicker(runtimeLogSyncInterval)
+	defer t.Stop()
+	for {
+		c.sync(ctx)
+		select {
+		case <-ctx.Done():
+			c.wg.Wait()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+type follower struct {
+	cancel context.CancelFunc
+}
+
+type logCollector struct {
+	w         *Worker
+	mu        sync.Mutex
+	following map[string]*follower // by deployment ID
+	wg        sync.WaitGroup
+}
+
+func (c *logCollector) sync(ctx context.Context) {
+	ds, err := c.w.Store.ListRunningDeployments(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("runtime logs: %v", err)
+		}
+		return
+	}
+	running := make(map[string]bool, len(ds))
+	for _, d := range ds {
+		running[d.ID] = true
+		c.mu.Lock()
+		_, ok := c.following[d.ID]
+		c.mu.Unlock()
+		if !ok && containerRunning(ctx, d.ContainerName.String) {
+			c.follow(ctx, d)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, f := range c.following {
+		if !running[id] {
+			f.cancel()
+		}
+	}
+}
+
+func (c *logCollector) follow(ctx context.Context, d db.Deployment) {
+	fctx, cancel := context.WithCancel(ctx)
+	f := &follower{cancel: cancel}
+	c.mu.Lock()
+	c.following[d.ID] = f
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer func() {
+			cancel()
+			c.mu.Lock()
+			if c.following[d.ID] == f {
+				delete(c.following, d.ID)
+			}
+			c.mu.Unlock()
+		}()
+		if err := c.w.followContainer(fctx, d); err != nil && fctx.Err() == nil {
+			log.Printf("runtime logs %s: %v", d.ID, err)
+		}
+	}()
+}
+
+// followContainer streams d's container output into its runtime stream until
+// the container stops or ctx is done.
+func (w *Worker) followContainer(ctx context.Context, d db.Deployment) error {
+	args := []string{"logs", "--follow"}
+	since, err := w.Store.LastLogChunkTime(ctx, d.ID, "runtime")
+	if err != nil {
+		return err
+	}
+	if since.Valid {
+		// Picks up where the previous follower (or worker) stopped.
+		args = append(args, "--since", since.Time.Format(time.RFC3339Nano))
+	}
+	args = append(args, d.ContainerName.String)
+
+	// Flushes must still land after ctx is canceled.
+	lw := newLogWriter(context.WithoutCancel(ctx), w.Store, d.ID, "runtime")
+	return followInto(ctx, lw, "docker", args...)
+}
+
+// followInto runs name with args into lw until it exits or ctx is done, then
+// flushes what lw still buffers.
+func followInto(ctx context.Context, lw *logWriter, name string, args ...string) error {
+	defer lw.flush()
+	defer lw.flushEvery(time.Second)()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = lw
+	cmd.Stderr = lw
+	return cmd.Run()
+}
@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFollowIntoFlushesOnCancel(t *testing.T) {
+	var mu sync.Mutex
+	var chunks []string
+	ctx, cancel := context.WithCancel(context.Background())
+	lw := &logWriter{
+		// As in followContainer: the writer outlives the follow context.
+		ctx: context.WithoutCancel(ctx),
+		appendChunk: func(ctx context.Context, chunk string) error {
+			if ctx.Err() != nil {
+				t.Errorf("chunk %q appended with a canceled context", chunk)
+			}
+			mu.Lock()
+			chunks = append(chunks, chunk)
+			mu.Unlock()
+			return nil
+		},
+		lastFlush: time.Now(),
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- followInto(ctx, lw, "sh", "-c", "echo first; echo second >&2; exec sleep 30") }()
+	// Give the process time to write, but stop it before the 1s ticker flushes.
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("followInto did not return after cancel")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(chunks, ""); got != "first\nsecond\n" {
+		t.Fatalf("flushed %q", got)
+	}
+}
@@ -0,0 +1,261 @@
+package worker
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencel/opencel/internal/github"
+)
+
+// downloadZipball streams the repository archive at sha into a temp file,
+// bounded by SourceArchiveMaxBytes, and returns its path and a remove func.
+func (w *Worker) downloadZipball(ctx context.Context, gh *github.App, token, owner, repo, sha string) (string, func(), error) {
+	f, err := os.CreateTemp("", "opencel-src-*.zip")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() { _ = os.Remove(f.Name()) }
+	_, err = gh.DownloadZipball(ctx, token, owner, repo, sha, f, w.Cfg.SourceArchiveMaxBytes)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+	return f.Name(), remove, nil
+}
+
+// extractZip extracts the archive at zipPath into a new temp dir, bounded by
+// SourceExtractMaxBytes.
+func (w *Worker) extractZip(zipPath string) (string, func(), error) {
+	tmp, err := os.MkdirTemp("", "opencel-src-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.RemoveAll(tmp) }
+	if err := unzip(zipPath, tmp, w.Cfg.SourceExtractMaxBytes); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return tmp, cleanup, nil
+}
+
+// unzip extracts zipPath into dst, keeping file modes and symlinks. Entries
+// that would land outside dst, directly or through a symlink extracted
+// earlier, are rejected, as are symlinks pointing outside dst. It fails once
+// the extracted files would exceed maxBytes in total; zero means no limit.
+func unzip(zipPath, dst string, maxBytes int64) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	// The sizes in the archive's directory can lie, so the bytes written are
+	// counted as well; checking the declared total first just fails early.
+	if maxBytes > 0 {
+		var total uint64
+		for _, f := range zr.File {
+			total += f.UncompressedSize64
+			if total > uint64(maxBytes) {
+				return errExtractTooLarge(maxBytes)
+			}
+		}
+	}
+	remaining := maxBytes
+
+	// Symlinks are checked again once the tree is complete: a link that looks
+	// local can still escape through links extracted after it.
+	var links []*zip.File
+	for _, f := range zr.File {
+		name := strings.TrimSuffix(f.Name, "/")
+		if name == "" {
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) || strings.Contains(name, `\`) {
+			return fmt.Errorf("zip entry %q escapes the archive root", f.Name)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+		if err := checkNoSymlinkParents(dst, target); err != nil {
+			return fmt.Errorf("zip entry %q: %w", f.Name, err)
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, mode.Perm()|0o700); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			if err := extractSymlink(f, dst, target); err != nil {
+				return err
+			}
+			links = append(links, f)
+		case mode.IsRegular():
+			if err := extractFile(f, target, maxBytes, &remaining); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("zip entry %q: unsupported file type %s", f.Name, mode.Type())
+		}
+	}
+	for _, f := range links {
+		rel := filepath.FromSlash(strings.TrimSuffix(f.Name, "/"))
+		if err := resolveInTree(dst, rel); err != nil {
+			return fmt.Errorf("zip entry %q: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// maxLinkHops bounds symlink resolution, like the kernel's ELOOP limit.
+const maxLinkHops = 40
+
+// resolveInTree follows the path rel below root one component at a time,
+// reading symlinks from the tree as the kernel would, and fails if any step
+// leaves root. Components that do not exist are resolved lexically.
+func resolveInTree(root, rel string) error {
+	var cur []string
+	pending := strings.Split(rel, string(filepath.Separator))
+	for hops := 0; len(pending) > 0; {
+		c := pending[0]
+		pending = pending[1:]
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			if len(cur) == 0 {
+				return fmt.Errorf("symlink chain points outside the archive")
+			}
+			cur = cur[:len(cur)-1]
+			continue
+		}
+		cur = append(cur, c)
+		path := filepath.Join(append([]string{root}, cur...)...)
+		st, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if st.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if hops++; hops > maxLinkHops {
+			return fmt.Errorf("too many levels of symlinks")
+		}
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		cur = cur[:len(cur)-1]
+		if filepath.IsAbs(link) {
+			r, err := filepath.Rel(root, link)
+			if err != nil || !filepath.IsLocal(r) {
+				return fmt.Errorf("symlink chain points outside the archive")
+			}
+			cur, link = nil, r
+		}
+		pending = append(strings.Split(link, string(filepath.Separator)), pending...)
+	}
+	return nil
+}
+
+// checkNoSymlinkParents makes sure no directory between root and target is a
+// symlink, so writing target cannot be redirected elsewhere.
+func checkNoSymlinkParents(root, target string) error {
+	rel, err := filepath.Rel(root, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return err
+	}
+	cur := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		st, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if st.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("path goes through symlink %s", filepath.ToSlash(strings.TrimPrefix(cur, root+string(filepath.Separator))))
+		}
+	}
+	return nil
+}
+
+func errExtractTooLarge(maxBytes int64) error {
+	return fmt.Errorf("source archive extracts to more than %d MB", maxBytes>>20)
+}
+
+// extractFile writes f to target. With a limit, at most *remaining bytes are
+// written and *remaining is reduced by the file's size.
+func extractFile(f *zip.File, target string, maxBytes int64, remaining *int64) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	perm := f.Mode().Perm()
+	if perm == 0 {
+		// Archives without Unix modes.
+		perm = 0o644
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	// O_EXCL: never write through whatever already sits at target.
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm|0o600)
+	if err != nil {
+		return err
+	}
+	if maxBytes > 0 {
+		var n int64
+		n, err = io.Copy(out, io.LimitReader(rc, *remaining+1))
+		if *remaining -= n; err == nil && *remaining < 0 {
+			err = errExtractTooLarge(maxBytes)
+		}
+	} else {
+		_, err = io.Copy(out, rc)
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// The umask may have stripped bits such as group/other execute.
+	return os.Chmod(target, perm|0o600)
+}
+
+func extractSymlink(f *zip.File, root, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(io.LimitReader(rc, 4096))
+	_ = rc.Close()
+	if err != nil {
+		return err
+	}
+	link := string(b)
+	resolved := link
+	if !filepath.IsAbs(link) {
+		resolved = filepath.Join(filepath.Dir(target), link)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("zip entry %q: symlink to %q points outside the archive", f.Name, link)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	return os.Symlink(link, target)
+}
@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type zipEntry struct {
+	name string
+	mode os.FileMode
+	body string
+}
+
+func writeZip(t *testing.T, entries ...zipEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "src.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		h.SetMode(e.mode)
+		fw, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUnzipKeepsModesAndSymlinks(t *testing.T) {
+	zipPath := writeZip(t,
+		zipEntry{name: "repo-abc/", mode: os.ModeDir | 0o755},
+		zipEntry{name: "repo-abc/scripts/build.sh", mode: 0o755, body: "#!/bin/sh\necho ok\n"},
+		zipEntry{name: "repo-abc/README.md", mode: 0o644, body: "hi"},
+		zipEntry{name: "repo-abc/docs", mode: os.ModeSymlink | 0o777, body: "scripts"},
+	)
+	dst := t.TempDir()
+	if err := unzip(zipPath, dst, 0); err != nil {
+		t.Fatalf("unzip: %v", err)
+	}
+
+	st, err := os.Stat(filepath.Join(dst, "repo-abc", "scripts", "build.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != 0o755 {
+		t.Errorf("build.sh mode = %v, want 0755", st.Mode().Perm())
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "repo-abc", "docs")); err != nil || link != "scripts" {
+		t.Errorf("docs symlink = %q, %v", link, err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dst, "repo-abc", "README.md")); err != nil || string(b) != "hi" {
+		t.Errorf("README.md = %q, %v", b, err)
+	}
+}
+
+func TestUnzipRejectsEscapes(t *testing.T) {
+	cases := map[string][]zipEntry{
+		"dot-dot":   {{name: "repo/../../evil.txt", mode: 0o644, body: "x"}},
+		"absolute":  {{name: "/tmp/evil.txt", mode: 0o644, body: "x"}},
+		"backslash": {{name: `repo\..\..\evil.txt`, mode: 0o644, body: "x"}},
+		"symlink target": {
+			{name: "repo/passwd", mode: os.ModeSymlink | 0o777, body: "/etc/passwd"},
+		},
+		"relative symlink target": {
+			{name: "repo/up", mode: os.ModeSymlink | 0o777, body: "../../.."},
+		},
+		"symlink chain": {
+			{name: "repo/x", mode: os.ModeSymlink | 0o777, body: "."},
+			{name: "repo/y", mode: os.ModeSymlink | 0o777, body: "x/../.."},
+		},
+		"symlink chain, link first": {
+			{name: "repo/y", mode: os.ModeSymlink | 0o777, body: "x/../.."},
+			{name: "repo/x", mode: os.ModeSymlink | 0o777, body: "."},
+		},
+		"symlink loop": {
+			{name: "repo/a", mode: os.ModeSymlink | 0o777, body: "b"},
+			{name: "repo/b", mode: os.ModeSymlink | 0o777, body: "a"},
+		},
+		"through symlink": {
+			{name: "repo/link", mode: os.ModeSymlink | 0o777, body: "sub"},
+			{name: "repo/link/file.txt", mode: 0o644, body: "x"},
+		},
+	}
+	for name, entries := range cases {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "out")
+			if err := os.Mkdir(dst, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			err := unzip(writeZip(t, entries...), dst, 0)
+			if err == nil {
+				t.Fatal("unzip accepted an escaping entry")
+			}
+			if _, err := os.Stat(filepath.Join(parent, "evil.txt")); err == nil {
+				t.Fatal("file written outside the destination")
+			}
+			if !strings.Contains(err.Error(), "zip entry") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnzipLimitsExtractedSize(t *testing.T) {
+	// 2 MiB of zeros compresses to a few KiB.
+	bomb := strings.Repeat("\x00", 2<<20)
+	zipPath := writeZip(t,
+		zipEntry{name: "repo/a.bin", mode: 0o644, body: bomb},
+		zipEntry{name: "repo/b.bin", mode: 0o644, body: bomb},
+	)
+	if st, err := os.Stat(zipPath); err != nil || st.Size() > 1<<20 {
+		t.Fatalf("archive size: %v %v", st, err)
+	}
+	if err := unzip(zipPath, t.TempDir(), 3<<20); err == nil || !strings.Contains(err.Error(), "more than 3 MB") {
+		t.Fatalf("unzip over the limit: %v", err)
+	}
+	if err := unzip(zipPath, t.TempDir(), 4<<20); err != nil {
+		t.Fatalf("unzip at the limit: %v", err)
+	}
+
+	// The bytes written count too, whatever the archive declares.
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	remaining := int64(1 << 20)
+	if err := extractFile(zr.File[0], filepath.Join(t.TempDir(), "a.bin"), 3<<20, &remaining); err == nil {
+		t.Fatal("extractFile wrote past the remaining budget")
+	}
+}
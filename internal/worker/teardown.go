@@ -0,0 +1,49 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/opencel/opencel/internal/github"
+)
+
+// TeardownPullRequest removes the preview containers and build cache of a
+// closed pull request.
+func (w *Worker) TeardownPullRequest(ctx context.Context, projectID string, prNumber int) error {
+	ds, err := w.Store.ListDeploymentsByPR(ctx, projectID, prNumber)
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		if d.Status != "READY" || !d.ContainerName.Valid || d.ContainerName.String == "" {
+			continue
+		}
+		if err := w.runDocker(ctx, d.ID, "system", "rm", "-f", d.ContainerName.String); err != nil {
+			return fmt.Errorf("remove container %s: %w", d.ContainerName.String, err)
+		}
+		_ = w.Store.UpdateDeployment(ctx, d.ID, "STOPPED", nil, nil, nil, nil)
+		_ = w.Store.AddDeploymentEvent(ctx, d.ID, "STOPPED", fmt.Sprintf("Preview removed after pull request #%d was closed", prNumber))
+	}
+	// Garbage collection expires the stopped previews later; their build
+	// cache is of no use from now on.
+	p, err := w.Store.GetProject(ctx, projectID)
+	if err != nil || p == nil {
+		return err
+	}
+	if err := w.deleteRegistryImage(ctx, w.cacheImage(p, fmt.Sprintf("refs/pull/%d/head", prNumber))); err != nil {
+		// Not worth retrying the teardown for.
+		log.Printf("teardown: project %s: build cache of #%d: %v", projectID, prNumber, err)
+	}
+	return nil
+}
+
+// pullRequestClosed reports whether GitHub says pull request number is closed.
+// A failed lookup counts as open, so a GitHub outage does not cancel builds.
+func (w *Worker) pullRequestClosed(ctx context.Context, gh *github.App, token, owner, repo string, number int) bool {
+	pr, err := gh.GetPullRequest(ctx, token, owner, repo, number)
+	if err != nil {
+		return false
+	}
+	return pr.State == "closed"
+}
@@ -1,24 +1,29 @@
 package worker
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
-	"encoding/json"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/hibiken/asynq"
+	"github.com/opencel/opencel/internal/appconfig"
 	"github.com/opencel/opencel/internal/config"
 	"github.com/opencel/opencel/internal/crypto/envcrypt"
 	"github.com/opencel/opencel/internal/db"
+	"github.com/opencel/opencel/internal/deploy"
+	"github.com/opencel/opencel/internal/github"
 	"github.com/opencel/opencel/internal/integrations"
 	"github.com/opencel/opencel/internal/settings"
+	"github.com/opencel/opencel/internal/traefik"
 )
 
 type Worker struct {
@@ -45,66 +50,209 @@ func (w *Worker) BuildAndDeploy(ctx context.Context, deploymentID string) error
 	if err != nil || p == nil {
 		return fmt.Errorf("project not found")
 	}
-	_ = w.Store.AddDeploymentEvent(ctx, d.ID, "BUILDING", "Build started")
+
+	if d.Status == "CANCELED" {
+		// Canceled while still queued; nothing to do.
+		return nil
+	}
+
+	rep := w.newStatusReporter(d.ID, p.ID)
+	previewURL, err := w.buildAndDeploy(ctx, d, p, rep)
+	if errors.Is(err, errCanceled) {
+		// Returning nil keeps asynq from retrying a build the user stopped.
+		rep.canceled(context.WithoutCancel(ctx))
+		return nil
+	}
+	if errors.Is(err, errInterrupted) {
+		// asynq runs it again; the status stays pending until then.
+		return err
+	}
+	if err != nil {
+		rep.failure(ctx, err.Error())
+		return err
+	}
+	rep.success(ctx, previewURL)
+	return nil
+}
+
+func (w *Worker) buildAndDeploy(ctx context.Context, d *db.Deployment, p *db.Project, rep *statusReporter) (string, error) {
+	_ = w.Store.AddDeploymentStatusEvent(ctx, d.ID, "BUILDING", "Build started", nil)
 	_ = w.Store.UpdateDeployment(ctx, d.ID, "BUILDING", nil, nil, nil, nil)
+	started := time.Now()
 
 	gh, cfgd, err := w.GHProvider.Get(ctx)
 	if err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("GitHub config error: %v", err))
+		return "", w.fail(ctx, d.ID, failSource, fmt.Sprintf("GitHub config error: %v", err))
 	}
 	if !cfgd || gh == nil {
-		return w.fail(ctx, d.ID, "GitHub not configured")
+		return "", w.fail(ctx, d.ID, failSource, "GitHub not configured")
 	}
 	if !p.GitHubInstallationID.Valid {
-		return w.fail(ctx, d.ID, "Project missing GitHub installation id")
+		return "", w.fail(ctx, d.ID, failSource, "Project missing GitHub installation id")
 	}
 
 	parts := strings.Split(p.RepoFullName, "/")
 	if len(parts) != 2 {
-		return w.fail(ctx, d.ID, "Invalid repo_full_name")
+		return "", w.fail(ctx, d.ID, failSource, "Invalid repo_full_name")
 	}
 	owner, repo := parts[0], parts[1]
 
 	token, err := gh.CreateInstallationToken(ctx, p.GitHubInstallationID.Int64)
 	if err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("GitHub token: %v", err))
+		return "", w.fail(ctx, d.ID, failSource, fmt.Sprintf("GitHub token: %v", err))
+	}
+	rep.attach(gh, token, owner, repo, d.GitSHA)
+	rep.pending(ctx)
+	if !d.CommitMessage.Valid {
+		w.recordCommit(ctx, d, gh, token, owner, repo)
 	}
-	zipb, err := gh.DownloadZipball(ctx, token, owner, repo, d.GitSHA)
+
+	zipPath, removeZip, err := w.downloadZipball(ctx, gh, token, owner, repo, d.GitSHA)
 	if err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("GitHub zipball: %v", err))
+		return "", w.fail(ctx, d.ID, failSource, fmt.Sprintf("GitHub zipball: %v", err))
 	}
 
-	workDir, cleanup, err := w.extractZip(zipb)
+	workDir, cleanup, err := w.extractZip(zipPath)
+	removeZip()
 	if err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("extract: %v", err))
+		return "", w.fail(ctx, d.ID, failSource, fmt.Sprintf("extract: %v", err))
 	}
 	defer cleanup()
 
-	appDir, err := w.findRepoRoot(workDir)
+	repoRoot, err := w.findRepoRoot(workDir)
 	if err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("repo root: %v", err))
+		return "", w.fail(ctx, d.ID, failSource, fmt.Sprintf("repo root: %v", err))
 	}
 
-	spec, err := detectSpec(appDir)
+	ps, err := settings.LoadProject(ctx, w.Store, p.ID)
+	if err != nil {
+		return "", w.fail(ctx, d.ID, failConfig, fmt.Sprintf("project settings: %v", err))
+	}
+	appDir, err := resolveRootDir(repoRoot, ps.RootDir)
 	if err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("detect: %v", err))
+		return "", w.fail(ctx, d.ID, failConfig, fmt.Sprintf("root_dir: %v", err))
 	}
 
-	dockerfilePath := filepath.Join(appDir, ".opencel.Dockerfile")
-	if err := os.WriteFile(dockerfilePath, []byte(spec.Dockerfile), 0o644); err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("write dockerfile: %v", err))
+	preset := ps.BuildPreset
+	if !settings.ValidBuildPreset(preset) {
+		// Older imports stored template names the worker never supported.
+		_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("unknown build_preset %q; detecting the build type instead\n", preset))
+		preset = ""
+	}
+	sourceDone := time.Now()
+	appCfg, err := appconfig.Load(appDir)
+	if err != nil {
+		return "", w.fail(ctx, d.ID, failConfig, err.Error())
+	}
+	d.HealthCheckPath = sql.NullString{String: appCfg.HealthCheckPath, Valid: appCfg.HealthCheckPath != ""}
+	d.EnvDefaults = appCfg.Env
+	if err := w.Store.SetDeploymentAppConfig(ctx, d.ID, appCfg.HealthCheckPath, appCfg.Env); err != nil {
+		return "", w.fail(ctx, d.ID, failInternal, fmt.Sprintf("db update: %v", err))
+	}
+
+	spec, err := specForPreset(appDir, preset, appCfg)
+	if err != nil {
+		return "", w.fail(ctx, d.ID, failConfig, fmt.Sprintf("detect: %v", err))
+	}
+	_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("building %s app from %s\n", spec.Type, displayRootDir(ps.RootDir)))
+	if !spec.Static && len(appCfg.Headers)+len(appCfg.Redirects)+len(appCfg.Rewrites) > 0 {
+		_ = w.Store.AppendLogChunk(ctx, d.ID, "system", "opencel.json: headers, redirects and rewrites only apply to static sites; ignoring them\n")
+	}
+
+	if err := writeSpecFiles(appDir, spec); err != nil {
+		return "", w.fail(ctx, d.ID, failInternal, fmt.Sprintf("write build files: %v", err))
+	}
+	dockerfilePath := spec.DockerfilePath
+	if dockerfilePath == "" {
+		dockerfilePath = filepath.Join(appDir, ".opencel.Dockerfile")
+		if err := os.WriteFile(dockerfilePath, []byte(spec.Dockerfile), 0o644); err != nil {
+			return "", w.fail(ctx, d.ID, failInternal, fmt.Sprintf("write dockerfile: %v", err))
+		}
 	}
 
-	containerName := "opencel-deploy-" + strings.ReplaceAll(d.ID, "-", "")
+	containerName := containerNameFor(d.ID)
 	imageRef := fmt.Sprintf("%s/opencel/%s:%s", w.Cfg.RegistryAddr, p.Slug, strings.ReplaceAll(d.ID, "-", ""))
 
-	if err := w.runDocker(ctx, d.ID, "build", []string{"build", "-f", dockerfilePath, "-t", imageRef, appDir}...); err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("docker build: %v", err))
+	buildStart := time.Now()
+	if err := w.build(ctx, d, p, spec, ps.Resources.Effective(w.Cfg), dockerfilePath, imageRef, appDir); err != nil {
+		return "", w.fail(ctx, d.ID, failBuild, fmt.Sprintf("docker build: %v", err))
 	}
 
 	// Push to local registry (required so future runs can re-use images / pull by digest).
 	_ = w.runDocker(ctx, d.ID, "build", []string{"push", imageRef}...)
 
+	// The pull request may have closed while this built; its teardown has
+	// already run, so a container started now would never be removed.
+	if d.PRNumber.Valid && w.pullRequestClosed(ctx, gh, token, owner, repo, int(d.PRNumber.Int64)) {
+		_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("pull request #%d was closed during the build\n", d.PRNumber.Int64))
+		return "", w.canceled(ctx, d.ID)
+	}
+
+	startStart := time.Now()
+	previewURL, err := w.startContainer(ctx, d, containerName, imageRef, spec.ServicePort)
+	if err != nil {
+		return "", w.fail(ctx, d.ID, failStart, err.Error())
+	}
+
+	if err := w.Store.UpdateDeployment(ctx, d.ID, "READY", &imageRef, &containerName, &spec.ServicePort, &previewURL); err != nil {
+		return "", w.fail(ctx, d.ID, failInternal, fmt.Sprintf("db update: %v", err))
+	}
+	_ = w.Store.AddDeploymentStatusEvent(ctx, d.ID, "READY", "Deployment is ready", map[string]any{
+		"source_ms": sourceDone.Sub(started).Milliseconds(),
+		"build_ms":  startStart.Sub(buildStart).Milliseconds(),
+		"start_ms":  time.Since(startStart).Milliseconds(),
+	})
+	w.updateBranchAlias(ctx, d, p)
+	if d.Type == "production" {
+		w.autoPromote(ctx, d.ID)
+	}
+	return previewURL, nil
+}
+
+// recordCommit stores the message and author of d's commit for the timeline.
+// Deployments from push webhooks already have them; a failed lookup is only
+// logged.
+func (w *Worker) recordCommit(ctx context.Context, d *db.Deployment, gh *github.App, token, owner, repo string) {
+	c, err := gh.GetCommit(ctx, token, owner, repo, d.GitSHA)
+	if err != nil {
+		_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("commit details unavailable: %v\n", err))
+		return
+	}
+	_ = w.Store.SetDeploymentCommit(ctx, d.ID, c.Commit.Message, c.Commit.Author.Name)
+}
+
+// autoPromote promotes a freshly READY production deployment when the project
+// has auto_promote on. It never fails the deployment: a rejected promotion is
+// recorded by deploy.Promote and production stays where it was.
+func (w *Worker) autoPromote(ctx context.Context, deploymentID string) {
+	d, err := w.Store.GetDeployment(ctx, deploymentID)
+	if err != nil || d == nil {
+		return
+	}
+	ps, err := settings.LoadProject(ctx, w.Store, d.ProjectID)
+	if err != nil || !ps.AutoPromote {
+		return
+	}
+	// Builds can finish out of order; never replace a newer production deployment.
+	p, err := w.Store.GetProject(ctx, d.ProjectID)
+	if err != nil || p == nil {
+		return
+	}
+	if p.ProductionDeploymentID.Valid && p.ProductionDeploymentID.String != d.ID {
+		cur, err := w.Store.GetDeployment(ctx, p.ProductionDeploymentID.String)
+		if err == nil && cur != nil && cur.CreatedAt.After(d.CreatedAt) {
+			_ = w.Store.AppendLogChunk(ctx, d.ID, "system", "auto-promote skipped: production already runs a newer deployment\n")
+			return
+		}
+	}
+	if err := deploy.Promote(ctx, w.Cfg, w.Store, d); err != nil {
+		_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("auto-promote failed: %v\n", err))
+	}
+}
+
+// startContainer runs imageRef as d's container with the project's current env,
+// resource limits and the per-deployment preview route, returning the preview URL.
+func (w *Worker) startContainer(ctx context.Context, d *db.Deployment, containerName, imageRef string, servicePort int) (string, error) {
 	previewHost := fmt.Sprintf("%s.preview.%s", strings.ReplaceAll(d.ID, "-", ""), w.Cfg.BaseDomain)
 	previewURL := fmt.Sprintf("%s://%s", w.Cfg.PublicScheme, previewHost)
 
@@ -112,7 +260,7 @@ func (w *Worker) BuildAndDeploy(ctx context.Context, deploymentID string) error
 		"traefik.enable=true",
 		fmt.Sprintf("traefik.http.routers.%s.rule=Host(\"%s\")", containerName, previewHost),
 		fmt.Sprintf("traefik.http.routers.%s.entrypoints=%s", containerName, w.Cfg.TraefikEntrypoint),
-		fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port=%d", containerName, spec.ServicePort),
+		fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port=%d", containerName, servicePort),
 	}
 	if w.Cfg.TraefikTLS {
 		labels = append(labels, fmt.Sprintf("traefik.http.routers.%s.tls=true", containerName))
@@ -121,31 +269,51 @@ func (w *Worker) BuildAndDeploy(ctx context.Context, deploymentID string) error
 		}
 	}
 
+	ps, err := settings.LoadProject(ctx, w.Store, d.ProjectID)
+	if err != nil {
+		return "", fmt.Errorf("project settings: %v", err)
+	}
 	args := []string{"run", "-d", "--name", containerName, "--network", w.Cfg.DockerNetwork}
+	args = append(args, runLimitArgs(ps.Resources.Effective(w.Cfg))...)
 	for _, l := range labels {
 		args = append(args, "--label", l)
 	}
 
-	envs, err := w.loadEnv(ctx, p.ID, d.Type)
+	envs, err := w.loadEnv(ctx, d.ProjectID, d.Type)
 	if err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("env vars: %v", err))
+		return "", fmt.Errorf("env vars: %v", err)
 	}
-	// Always provide PORT; apps may ignore it.
-	envs = append(envs, "PORT=3000")
+	envs = withEnvDefaults(envs, d.EnvDefaults)
+	// Always provide PORT so apps that honor it listen where Traefik routes; apps may ignore it.
+	envs = append(envs, fmt.Sprintf("PORT=%d", servicePort))
 	for _, ev := range envs {
 		args = append(args, "-e", ev)
 	}
 	args = append(args, imageRef)
 
 	if err := w.runDocker(ctx, d.ID, "system", args...); err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("docker run: %v", err))
+		return "", fmt.Errorf("docker run: %v", err)
 	}
+	return previewURL, nil
+}
 
-	if err := w.Store.UpdateDeployment(ctx, d.ID, "READY", &imageRef, &containerName, &spec.ServicePort, &previewURL); err != nil {
-		return w.fail(ctx, d.ID, fmt.Sprintf("db update: %v", err))
+// updateBranchAlias re-points the stable <branch>-<project>-<org> preview host
+// at d now that it is the branch's newest READY deployment.
+func (w *Worker) updateBranchAlias(ctx context.Context, d *db.Deployment, p *db.Project) {
+	branch, ok := traefik.BranchFromRef(d.GitRef)
+	if !ok {
+		return
 	}
-	_ = w.Store.AddDeploymentEvent(ctx, d.ID, "READY", "Deployment is ready")
-	return nil
+	org, err := w.Store.GetOrganization(ctx, p.OrgID)
+	if err != nil || org == nil {
+		return
+	}
+	if err := traefik.Write(ctx, w.Cfg, w.Store); err != nil {
+		_ = w.Store.AppendLogChunk(ctx, d.ID, "system", fmt.Sprintf("traefik config update failed: %v\n", err))
+		return
+	}
+	aliasURL := fmt.Sprintf("%s://%s", w.Cfg.PublicScheme, traefik.BranchAliasHost(w.Cfg, branch, p.Slug, org.Slug))
+	_ = w.Store.AddDeploymentEvent(ctx, d.ID, "ALIASED", fmt.Sprintf("Branch alias %s now points to this deployment", aliasURL))
 }
 
 func (w *Worker) loadEnv(ctx context.Context, projectID string, deployType string) ([]string, error) {
@@ -168,55 +336,87 @@ func (w *Worker) loadEnv(ctx context.Context, projectID string, deployType strin
 	return out, nil
 }
 
-func (w *Worker) fail(ctx context.Context, deploymentID, msg string) error {
+// withEnvDefaults adds opencel.json's env defaults that the project does not set.
+func withEnvDefaults(envs []string, defaults map[string]string) []string {
+	set := make(map[string]bool, len(envs))
+	for _, ev := range envs {
+		k, _, _ := strings.Cut(ev, "=")
+		set[k] = true
+	}
+	keys := make([]string, 0, len(defaults))
+	for k := range defaults {
+		if !set[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		envs = append(envs, k+"="+defaults[k])
+	}
+	return envs
+}
+
+// errCanceled is returned by buildAndDeploy when the build was canceled.
+var errCanceled = errors.New("build canceled")
+
+// errInterrupted is returned by buildAndDeploy when the task context ended
+// without a cancel request, e.g. on worker shutdown, so asynq retries it.
+var errInterrupted = errors.New("build interrupted")
+
+func containerNameFor(deploymentID string) string {
+	return "opencel-deploy-" + strings.ReplaceAll(deploymentID, "-", "")
+}
+
+// Failure categories, recorded as the "category" of FAILED events.
+const (
+	failSource   = "source"   // getting the code from GitHub
+	failConfig   = "config"   // project settings, opencel.json, build detection
+	failBuild    = "build"    // the image build
+	failStart    = "start"    // starting the container, health checks
+	failInternal = "internal" // opencel itself, e.g. a database write
+)
+
+func (w *Worker) fail(ctx context.Context, deploymentID, category, msg string) error {
+	if ctx.Err() != nil {
+		// The step failed because the task's context ended, not on its own.
+		return w.interrupted(ctx, deploymentID, category, msg)
+	}
 	_ = w.Store.AppendLogChunk(ctx, deploymentID, "system", msg+"\n")
-	_ = w.Store.AddDeploymentEvent(ctx, deploymentID, "FAILED", msg)
+	_ = w.Store.AddDeploymentStatusEvent(ctx, deploymentID, "FAILED", msg, map[string]any{"category": category})
 	_ = w.Store.UpdateDeployment(ctx, deploymentID, "FAILED", nil, nil, nil, nil)
 	return errors.New(msg)
 }
 
-func (w *Worker) extractZip(b []byte) (string, func(), error) {
-	tmp, err := os.MkdirTemp("", "opencel-src-*")
-	if err != nil {
-		return "", nil, err
-	}
-	cleanup := func() { _ = os.RemoveAll(tmp) }
+// interrupted handles a step that failed because the task context ended. Only
+// a build someone canceled is marked CANCELED; any other interruption is
+// returned as errInterrupted for asynq to retry, unless no retries are left.
+func (w *Worker) interrupted(ctx context.Context, deploymentID, category, msg string) error {
+	ctx = context.WithoutCancel(ctx)
+	if ok, err := w.Store.DeploymentCancelRequested(ctx, deploymentID); err == nil && ok {
+		return w.canceled(ctx, deploymentID)
+	}
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	if retried >= maxRetry {
+		return w.fail(ctx, deploymentID, category, msg)
+	}
+	// The retry starts over; a leftover container would block its docker run.
+	_ = exec.CommandContext(ctx, "docker", "rm", "-f", containerNameFor(deploymentID)).Run()
+	_ = w.Store.AppendLogChunk(ctx, deploymentID, "system", "build interrupted, it will be retried\n")
+	_ = w.Store.UpdateDeployment(ctx, deploymentID, "QUEUED", nil, nil, nil, nil)
+	_ = w.Store.AddDeploymentStatusEvent(ctx, deploymentID, "QUEUED", "Build interrupted; retrying", nil)
+	return fmt.Errorf("%w: %s", errInterrupted, msg)
+}
 
-	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
-	if err != nil {
-		cleanup()
-		return "", nil, err
-	}
-	for _, f := range zr.File {
-		if f.FileInfo().IsDir() {
-			continue
-		}
-		rc, err := f.Open()
-		if err != nil {
-			cleanup()
-			return "", nil, err
-		}
-		dst := filepath.Join(tmp, f.Name)
-		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
-			_ = rc.Close()
-			cleanup()
-			return "", nil, err
-		}
-		out, err := os.Create(dst)
-		if err != nil {
-			_ = rc.Close()
-			cleanup()
-			return "", nil, err
-		}
-		_, err = io.Copy(out, rc)
-		_ = out.Close()
-		_ = rc.Close()
-		if err != nil {
-			cleanup()
-			return "", nil, err
-		}
-	}
-	return tmp, cleanup, nil
+// canceled records a canceled build and removes the container it may have
+// half-created.
+func (w *Worker) canceled(ctx context.Context, deploymentID string) error {
+	ctx = context.WithoutCancel(ctx)
+	_ = exec.CommandContext(ctx, "docker", "rm", "-f", containerNameFor(deploymentID)).Run()
+	_ = w.Store.AppendLogChunk(ctx, deploymentID, "system", "build canceled\n")
+	_ = w.Store.UpdateDeployment(ctx, deploymentID, "CANCELED", nil, nil, nil, nil)
+	_ = w.Store.AddDeploymentStatusEvent(ctx, deploymentID, "CANCELED", "Build canceled", nil)
+	return errCanceled
 }
 
 func (w *Worker) findRepoRoot(tmp string) (string, error) {
@@ -232,127 +432,135 @@ func (w *Worker) findRepoRoot(tmp string) (string, error) {
 	return "", fmt.Errorf("no root dir found")
 }
 
-type spec struct {
-	Type        string
-	ServicePort int
-	Dockerfile  string
-}
-
-type opencelJSON struct {
-	Type      string `json:"type"`
-	OutputDir string `json:"outputDir"`
-}
-
-func detectSpec(appDir string) (*spec, error) {
-	// Optional explicit config.
-	if b, err := os.ReadFile(filepath.Join(appDir, "opencel.json")); err == nil {
-		var cfg opencelJSON
-		if err := json.Unmarshal(b, &cfg); err == nil && cfg.Type != "" {
-			if cfg.Type == "static" {
-				outDir := cfg.OutputDir
-				if outDir == "" {
-					outDir = "dist"
-				}
-				return &spec{
-					Type:        "static",
-					ServicePort: 80,
-					Dockerfile:  staticDockerfile(outDir),
-				}, nil
-			}
-		}
+// resolveRootDir returns the app directory for a project's root_dir setting,
+// making sure it exists and, after resolving symlinks, is still inside the repo.
+func resolveRootDir(repoRoot, rootDir string) (string, error) {
+	rel, err := settings.CleanRootDir(rootDir)
+	if err != nil {
+		return "", err
 	}
-
-	// Heuristic: package.json implies node app.
-	if _, err := os.Stat(filepath.Join(appDir, "package.json")); err == nil {
-		return &spec{
-			Type:        "node",
-			ServicePort: 3000,
-			Dockerfile:  nodeDockerfile(),
-		}, nil
+	if rel == "" {
+		return repoRoot, nil
 	}
-
-	// Fallback static (serving repo contents as html).
-	return &spec{
-		Type:        "static",
-		ServicePort: 80,
-		Dockerfile:  staticDockerfile("."),
-	}, nil
-}
-
-func nodeDockerfile() string {
-	return `FROM node:22-alpine AS build
-WORKDIR /app
-COPY package*.json ./
-RUN npm ci
-COPY . .
-RUN if [ -f package.json ] && node -e "const p=require('./package.json'); process.exit(p.scripts&&p.scripts.build?0:1)"; then npm run build; else echo "no build script"; fi
-
-FROM node:22-alpine
-WORKDIR /app
-ENV NODE_ENV=production
-COPY --from=build /app /app
-EXPOSE 3000
-CMD ["npm","run","start"]
-`
+	root, err := filepath.EvalSymlinks(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", fmt.Errorf("%s not found in repository", rel)
+	}
+	if dir != root && !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s points outside the repository", rel)
+	}
+	st, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !st.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", rel)
+	}
+	return dir, nil
 }
 
-func staticDockerfile(outputDir string) string {
-	return fmt.Sprintf(`FROM node:22-alpine AS build
-WORKDIR /app
-COPY package*.json ./
-RUN if [ -f package.json ]; then npm ci; fi
-COPY . .
-RUN if [ -f package.json ] && node -e "const p=require('./package.json'); process.exit(p.scripts&&p.scripts.build?0:1)"; then npm run build; else echo "no build script"; fi
-
-FROM nginx:alpine
-COPY --from=build /app/%s /usr/share/nginx/html
-EXPOSE 80
-`, outputDir)
+func displayRootDir(rootDir string) string {
+	if rel, err := settings.CleanRootDir(rootDir); err == nil && rel != "" {
+		return rel
+	}
+	return "repository root"
 }
 
+// logWriter batches output into deployment log chunks. It is safe for
+// concurrent use, so a flushEvery ticker can run next to the writer.
 type logWriter struct {
-	ctx          context.Context
-	store        *db.Store
-	deploymentID string
-	stream       string
-	buf          []byte
-	lastFlush    time.Time
+	ctx context.Context
+	// appendChunk stores one chunk; newLogWriter points it at the store.
+	appendChunk func(ctx context.Context, chunk string) error
+
+	mu        sync.Mutex
+	buf       []byte
+	lastFlush time.Time
 }
 
 func newLogWriter(ctx context.Context, store *db.Store, deploymentID, stream string) *logWriter {
 	return &logWriter{
-		ctx:          ctx,
-		store:        store,
-		deploymentID: deploymentID,
-		stream:       stream,
-		lastFlush:    time.Now(),
+		ctx: ctx,
+		appendChunk: func(ctx context.Context, chunk string) error {
+			return store.AppendLogChunk(ctx, deploymentID, stream, chunk)
+		},
+		lastFlush: time.Now(),
 	}
 }
 
 func (lw *logWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
 	lw.buf = append(lw.buf, p...)
 	// Flush periodically or when buffer is large.
 	if len(lw.buf) > 8*1024 || time.Since(lw.lastFlush) > 500*time.Millisecond {
-		lw.flush()
+		lw.flushLocked()
 	}
 	return len(p), nil
 }
 
 func (lw *logWriter) flush() {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.flushLocked()
+}
+
+func (lw *logWriter) flushLocked() {
 	if len(lw.buf) == 0 {
 		return
 	}
-	_ = lw.store.AppendLogChunk(lw.ctx, lw.deploymentID, lw.stream, string(lw.buf))
+	_ = lw.appendChunk(lw.ctx, string(lw.buf))
 	lw.buf = lw.buf[:0]
 	lw.lastFlush = time.Now()
 }
 
+// flushEvery flushes buffered output every d, so a quiet process's last lines
+// do not wait for its next write. Call the returned func to stop it.
+func (lw *logWriter) flushEvery(d time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(d)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				lw.flush()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
 func (w *Worker) runDocker(ctx context.Context, deploymentID, stream string, args ...string) error {
+	return w.runDockerTee(ctx, deploymentID, stream, nil, args...)
+}
+
+// runDockerTee is runDocker that also copies the output to tee, if not nil.
+func (w *Worker) runDockerTee(ctx context.Context, deploymentID, stream string, tee io.Writer, args ...string) error {
+	return w.runDockerEnv(ctx, deploymentID, stream, tee, nil, args...)
+}
+
+// runDockerEnv is runDockerTee with extra environment variables for docker.
+func (w *Worker) runDockerEnv(ctx context.Context, deploymentID, stream string, tee io.Writer, env []string, args ...string) error {
 	cmd := exec.CommandContext(ctx, "docker", args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	lw := newLogWriter(ctx, w.Store, deploymentID, stream)
 	defer lw.flush()
-	cmd.Stdout = lw
-	cmd.Stderr = lw
+	defer lw.flushEvery(time.Second)()
+	var out io.Writer = lw
+	if tee != nil {
+		out = io.MultiWriter(lw, tee)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
 	err := cmd.Run()
 	if err != nil {
 		lw.flush()
@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- Preview deployments built from pull_request webhooks remember their PR.
+ALTER TABLE deployments
+  ADD COLUMN IF NOT EXISTS pr_number int;
+
+CREATE INDEX IF NOT EXISTS idx_deployments_project_pr_number ON deployments(project_id, pr_number)
+  WHERE pr_number IS NOT NULL;
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_deployments_project_pr_number;
+
+ALTER TABLE deployments
+  DROP COLUMN IF EXISTS pr_number;
@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- Custom domains. A domain only gets a Traefik router once DNS ownership is verified.
+CREATE TABLE IF NOT EXISTS project_domains (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  project_id uuid NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+  domain text NOT NULL UNIQUE,
+  target text NOT NULL DEFAULT 'production' CHECK (target IN ('production','branch')),
+  branch text NULL,
+  verification_token text NOT NULL,
+  verified_at timestamptz NULL,
+  last_checked_at timestamptz NULL,
+  last_error text NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  CHECK (target <> 'branch' OR branch IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS project_domains_project_id_idx ON project_domains(project_id);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS project_domains;
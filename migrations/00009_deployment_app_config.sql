@@ -0,0 +1,13 @@
+-- +goose Up
+
+-- Runtime settings from the opencel.json a deployment was built with, kept so
+-- promotions, rollbacks and redeploys use them without the source tree.
+ALTER TABLE deployments
+  ADD COLUMN IF NOT EXISTS health_check_path text,
+  ADD COLUMN IF NOT EXISTS env_defaults jsonb;
+
+-- +goose Down
+
+ALTER TABLE deployments
+  DROP COLUMN IF EXISTS env_defaults,
+  DROP COLUMN IF EXISTS health_check_path;
@@ -0,0 +1,12 @@
+-- +goose Up
+
+-- Build cache statistics of BuildKit builds.
+ALTER TABLE deployments
+  ADD COLUMN IF NOT EXISTS build_steps int,
+  ADD COLUMN IF NOT EXISTS build_cached_steps int;
+
+-- +goose Down
+
+ALTER TABLE deployments
+  DROP COLUMN IF EXISTS build_cached_steps,
+  DROP COLUMN IF EXISTS build_steps;
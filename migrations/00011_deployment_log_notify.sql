@@ -0,0 +1,39 @@
+-- +goose Up
+
+-- Wake log streams (LISTEN deployment_logs) when a deployment gets new log
+-- chunks or changes status. The payload is the deployment id.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_deployment_log_chunk() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('deployment_logs', NEW.deployment_id::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_deployment_status() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('deployment_logs', NEW.id::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS deployment_log_chunks_notify ON deployment_log_chunks;
+CREATE TRIGGER deployment_log_chunks_notify
+  AFTER INSERT ON deployment_log_chunks
+  FOR EACH ROW EXECUTE FUNCTION notify_deployment_log_chunk();
+
+DROP TRIGGER IF EXISTS deployments_status_notify ON deployments;
+CREATE TRIGGER deployments_status_notify
+  AFTER UPDATE OF status ON deployments
+  FOR EACH ROW WHEN (OLD.status IS DISTINCT FROM NEW.status)
+  EXECUTE FUNCTION notify_deployment_status();
+
+-- +goose Down
+
+DROP TRIGGER IF EXISTS deployments_status_notify ON deployments;
+DROP TRIGGER IF EXISTS deployment_log_chunks_notify ON deployment_log_chunks;
+DROP FUNCTION IF EXISTS notify_deployment_status();
+DROP FUNCTION IF EXISTS notify_deployment_log_chunk();
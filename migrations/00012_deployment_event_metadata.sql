@@ -0,0 +1,25 @@
+-- +goose Up
+
+-- Structured event details for the deployment timeline and activity feed.
+ALTER TABLE deployment_events
+  ADD COLUMN IF NOT EXISTS actor_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX IF NOT EXISTS deployment_events_deployment_at_idx ON deployment_events (deployment_id, at);
+
+-- The commit a deployment was built from, as GitHub reports it.
+ALTER TABLE deployments
+  ADD COLUMN IF NOT EXISTS commit_message TEXT,
+  ADD COLUMN IF NOT EXISTS commit_author TEXT;
+
+-- +goose Down
+
+ALTER TABLE deployments
+  DROP COLUMN IF EXISTS commit_author,
+  DROP COLUMN IF EXISTS commit_message;
+
+DROP INDEX IF EXISTS deployment_events_deployment_at_idx;
+
+ALTER TABLE deployment_events
+  DROP COLUMN IF EXISTS metadata,
+  DROP COLUMN IF EXISTS actor_user_id;
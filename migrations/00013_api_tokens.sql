@@ -0,0 +1,25 @@
+-- +goose Up
+
+-- API tokens for scripts and CI, sent as "Authorization: Bearer ocl_...".
+-- Only a SHA-256 hash of the token is stored. A token acts as its user; with
+-- org_id set it is limited to that org.
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  org_id uuid NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  name text NOT NULL,
+  token_hash text NOT NULL UNIQUE,
+  token_prefix text NOT NULL,
+  scopes text NOT NULL DEFAULT '',
+  expires_at timestamptz NULL,
+  last_used_at timestamptz NULL,
+  revoked_at timestamptz NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens(user_id);
+CREATE INDEX IF NOT EXISTS api_tokens_org_id_idx ON api_tokens(org_id);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS api_tokens;
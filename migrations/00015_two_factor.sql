@@ -0,0 +1,31 @@
+-- +goose Up
+
+-- TOTP two-factor authentication. The secret is encrypted with
+-- OPENCEL_ENV_KEY_B64; enabled_at stays NULL until the user confirms a code.
+-- last_counter is the last time step used, so a code cannot be replayed.
+CREATE TABLE IF NOT EXISTS user_totp (
+  user_id uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  secret_enc bytea NOT NULL,
+  enabled_at timestamptz NULL,
+  last_counter bigint NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- One-time recovery codes, stored as sha256 hex.
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash text NOT NULL,
+  used_at timestamptz NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_id_idx ON user_recovery_codes(user_id);
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS require_2fa boolean NOT NULL DEFAULT false;
+
+-- +goose Down
+
+ALTER TABLE organizations DROP COLUMN IF EXISTS require_2fa;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
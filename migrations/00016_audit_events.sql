@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- Security-relevant events, e.g. login lockouts. subject names what the event
+-- is about (an email for lockouts); actor_user_id is who caused it, if known.
+CREATE TABLE IF NOT EXISTS audit_events (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  at timestamptz NOT NULL DEFAULT now(),
+  type text NOT NULL,
+  actor_user_id uuid NULL REFERENCES users(id) ON DELETE SET NULL,
+  subject text NOT NULL DEFAULT '',
+  ip text NOT NULL DEFAULT '',
+  metadata jsonb NOT NULL DEFAULT '{}'::jsonb
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_at_idx ON audit_events(at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS audit_events_type_at_idx ON audit_events(type, at DESC);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS audit_events;
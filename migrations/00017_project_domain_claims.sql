@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- Unverified domains are claims, not ownership: any project may add a domain,
+-- and only the first to pass DNS verification gets it. Before this a pending
+-- claim blocked the domain for every other project indefinitely.
+ALTER TABLE project_domains DROP CONSTRAINT IF EXISTS project_domains_domain_key;
+CREATE UNIQUE INDEX IF NOT EXISTS project_domains_project_domain_idx ON project_domains(project_id, domain);
+CREATE UNIQUE INDEX IF NOT EXISTS project_domains_verified_domain_idx ON project_domains(domain) WHERE verified_at IS NOT NULL;
+
+-- +goose Down
+
+DROP INDEX IF EXISTS project_domains_verified_domain_idx;
+DROP INDEX IF EXISTS project_domains_project_domain_idx;
+-- Keep the verified (or else the oldest) claim for each domain.
+DELETE FROM project_domains d
+USING project_domains o
+WHERE d.domain = o.domain AND d.id <> o.id
+  AND ((o.verified_at IS NOT NULL AND d.verified_at IS NULL)
+       OR ((o.verified_at IS NULL) = (d.verified_at IS NULL) AND (o.created_at, o.id) < (d.created_at, d.id)));
+ALTER TABLE project_domains ADD CONSTRAINT project_domains_domain_key UNIQUE (domain);
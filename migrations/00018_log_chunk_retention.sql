@@ -0,0 +1,8 @@
+-- +goose Up
+
+-- Garbage collection deletes runtime log chunks by age.
+CREATE INDEX IF NOT EXISTS deployment_log_chunks_runtime_ts_idx ON deployment_log_chunks(ts) WHERE stream = 'runtime';
+
+-- +goose Down
+
+DROP INDEX IF EXISTS deployment_log_chunks_runtime_ts_idx;
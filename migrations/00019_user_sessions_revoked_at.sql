@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- Cookies from before sessions carry no session id, so revoking sessions does
+-- not reach them. They are refused once issued before this.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS sessions_revoked_at timestamptz;
+
+-- +goose Down
+
+ALTER TABLE users DROP COLUMN IF EXISTS sessions_revoked_at;